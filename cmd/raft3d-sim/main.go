@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/raft3d/pkg/printer"
+)
+
+// raft3d-sim runs a virtual printer behind a Moonraker compatible API. Point a
+// printer connection with driver "moonraker" at it to exercise the connector
+// without hardware.
+func main() {
+	var (
+		listen      = flag.String("listen", "127.0.0.1:7125", "Address to serve the Moonraker API on")
+		speed       = flag.Float64("speed", 1, "Print speed multiplier")
+		failureRate = flag.Float64("failure-rate", 0, "Probability that a print fails part way through")
+		seed        = flag.Int64("seed", 0, "Random seed for failure injection (0 picks one)")
+	)
+	flag.Parse()
+
+	if *speed <= 0 {
+		log.Fatal("speed must be positive")
+	}
+	if *failureRate < 0 || *failureRate > 1 {
+		log.Fatal("failure rate must be between 0 and 1")
+	}
+
+	sim := printer.NewSimulator(printer.SimulatorOptions{
+		Speed:       *speed,
+		FailureRate: *failureRate,
+		Seed:        *seed,
+		NozzleTempC: 210,
+		BedTempC:    60,
+	})
+
+	log.Printf("Simulated printer listening on %s (speed x%g, failure rate %g)", *listen, *speed, *failureRate)
+	log.Fatal(http.ListenAndServe(*listen, printer.NewMoonrakerServer(sim)))
+}
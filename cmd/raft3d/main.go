@@ -1,133 +1,393 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
-	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/raft3d/internal/fsm"
+	"github.com/raft3d/pkg/alerts"
 	"github.com/raft3d/pkg/api"
+	"github.com/raft3d/pkg/blob"
+	"github.com/raft3d/pkg/config"
+	"github.com/raft3d/pkg/discovery"
+	"github.com/raft3d/pkg/events"
+	"github.com/raft3d/pkg/logging"
+	"github.com/raft3d/pkg/metrics"
+	"github.com/raft3d/pkg/printer"
 	raft_pkg "github.com/raft3d/pkg/raft"
+	"github.com/raft3d/pkg/tlsutil"
+	"github.com/raft3d/pkg/tracing"
+	"github.com/raft3d/pkg/webhooks"
 )
 
 func main() {
-	// Parse command line flags
-	var (
-		nodeID       = flag.String("id", "", "Node ID (must be unique)")
-		httpAddr     = flag.String("http", "127.0.0.1:8000", "HTTP API address")
-		raftAddr     = flag.String("raft", "127.0.0.1:7000", "Raft address")
-		dataDir      = flag.String("data", "data", "Data directory")
-		bootstrap    = flag.Bool("bootstrap", false, "Bootstrap the cluster with this node")
-		clusterNodes = flag.String("nodes", "", "Comma-separated list of all nodes in the cluster (format: node1=raft_addr1,node2=raft_addr2,...)")
-	)
+	// Settings come from the defaults, then the config file, then RAFT3D_*
+	// environment variables and finally command line flags
+	cfg := config.Default()
+	if path := config.PathFromArgs(os.Args[1:]); path != "" {
+		if err := cfg.LoadFile(path); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	if err := cfg.LoadEnv(os.LookupEnv); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	flag.String("config", "", "YAML config file (also RAFT3D_CONFIG)")
+	flag.StringVar(&cfg.NodeID, "id", cfg.NodeID, "Node ID (must be unique)")
+	flag.StringVar(&cfg.HTTPAddr, "http", cfg.HTTPAddr, "HTTP API address")
+	flag.StringVar(&cfg.RaftAddr, "raft", cfg.RaftAddr, "Raft address")
+	flag.StringVar(&cfg.DataDir, "data", cfg.DataDir, "Data directory")
+	flag.BoolVar(&cfg.Bootstrap, "bootstrap", cfg.Bootstrap, "Bootstrap the cluster with this node")
+	flag.Var(&cfg.Nodes, "nodes", "Comma-separated list of all nodes in the cluster (format: node1=raft_addr1,node2=raft_addr2,...)")
+	flag.BoolVar(&cfg.Auth, "auth", cfg.Auth, "Require API tokens for HTTP requests")
+	flag.StringVar(&cfg.AdminToken, "admin-token", cfg.AdminToken, "Bootstrap admin API token (implies -auth)")
+	flag.StringVar(&cfg.PeerToken, "peer-token", cfg.PeerToken, "Token nodes use to fetch files from each other under -auth, unless they use TLS client certificates, and to join through discovery")
+	flag.StringVar(&cfg.TLS.Cert, "tls-cert", cfg.TLS.Cert, "PEM certificate for this node; enables HTTPS on the API")
+	flag.StringVar(&cfg.TLS.Key, "tls-key", cfg.TLS.Key, "PEM private key for -tls-cert")
+	flag.StringVar(&cfg.TLS.CA, "tls-ca", cfg.TLS.CA, "PEM CA bundle used to verify peer and client certificates")
+	flag.BoolVar(&cfg.TLS.Raft, "raft-tls", cfg.TLS.Raft, "Use mutual TLS on the Raft transport (requires -tls-cert, -tls-key and -tls-ca)")
+	flag.StringVar(&cfg.HTTPAdvertise, "http-advertise", cfg.HTTPAdvertise, "Base URL other nodes use to reach this node's API (defaults to the -http address)")
+	flag.DurationVar(&cfg.Snapshot.Interval, "snapshot-interval", cfg.Snapshot.Interval, "How often the leader takes a snapshot; 0 disables periodic snapshots")
+	flag.Uint64Var(&cfg.Snapshot.Threshold, "snapshot-threshold", cfg.Snapshot.Threshold, "Log entries to accumulate before Raft takes a snapshot")
+	flag.IntVar(&cfg.Snapshot.Retain, "snapshot-retain", cfg.Snapshot.Retain, "Snapshots to keep on disk")
+	flag.StringVar(&cfg.Raft.Preset, "raft-preset", cfg.Raft.Preset, "Raft timing preset: lan or wan; the -raft-* settings below override it")
+	flag.DurationVar(&cfg.Raft.HeartbeatTimeout, "raft-heartbeat-timeout", cfg.Raft.HeartbeatTimeout, "Time without contact from the leader before a follower starts an election")
+	flag.DurationVar(&cfg.Raft.ElectionTimeout, "raft-election-timeout", cfg.Raft.ElectionTimeout, "Time a candidate waits for votes before starting a new election")
+	flag.DurationVar(&cfg.Raft.LeaderLeaseTimeout, "raft-leader-lease-timeout", cfg.Raft.LeaderLeaseTimeout, "Time a leader keeps leading without reaching a quorum")
+	flag.DurationVar(&cfg.Raft.CommitTimeout, "raft-commit-timeout", cfg.Raft.CommitTimeout, "Time without new entries before the leader sends a heartbeat")
+	flag.IntVar(&cfg.Raft.MaxAppendEntries, "raft-max-append-entries", cfg.Raft.MaxAppendEntries, "Log entries sent in one AppendEntries RPC (at most 1024)")
+	flag.Uint64Var(&cfg.Raft.TrailingLogs, "raft-trailing-logs", cfg.Raft.TrailingLogs, "Log entries kept after a snapshot for lagging followers")
+	flag.IntVar(&cfg.Raft.TransportPoolSize, "raft-transport-pool", cfg.Raft.TransportPoolSize, "Connections pooled to each peer")
+	flag.DurationVar(&cfg.Raft.TransportTimeout, "raft-transport-timeout", cfg.Raft.TransportTimeout, "I/O deadline of Raft RPCs")
+	flag.BoolVar(&cfg.Raft.AllowLegacyPeers, "raft-allow-legacy-peers", cfg.Raft.AllowLegacyPeers, "Talk to nodes that predate the cluster handshake, during a rolling upgrade")
+	flag.Int64Var(&cfg.Files.MaxUploadMB, "max-upload-mb", cfg.Files.MaxUploadMB, "Maximum size of uploaded files in megabytes")
+	flag.DurationVar(&cfg.Files.GCGrace, "file-gc-grace", cfg.Files.GCGrace, "How long unreferenced files are kept before being garbage collected")
+	flag.StringVar(&cfg.Log.Level, "log-level", cfg.Log.Level, "Log level: trace, debug, info, warn or error")
+	flag.StringVar(&cfg.Log.Format, "log-format", cfg.Log.Format, "Log format: text or json")
+	flag.StringVar(&cfg.Tracing.OTLPEndpoint, "otlp-endpoint", cfg.Tracing.OTLPEndpoint, "OTLP/HTTP collector URL to export traces to, for example http://localhost:4318")
+	flag.Float64Var(&cfg.Tracing.SampleRatio, "trace-sample-ratio", cfg.Tracing.SampleRatio, "Fraction of new traces to sample when exporting traces")
+	flag.Uint64Var(&cfg.ReadyMaxLag, "ready-max-lag", cfg.ReadyMaxLag, "Committed log entries a node may have left to apply and still report ready")
+	flag.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout, "How long to wait for in-flight HTTP requests on shutdown")
+	flag.Var(&cfg.Discovery.Seeds, "join", "Comma-separated base URLs of cluster nodes to join through")
+	flag.StringVar(&cfg.Discovery.SRV, "discovery-srv", cfg.Discovery.SRV, "DNS name whose SRV records point at the APIs of cluster nodes to join through")
+	flag.StringVar(&cfg.Discovery.DNS, "discovery-dns", cfg.Discovery.DNS, "DNS name whose A/AAAA records are cluster nodes to join through")
+	flag.IntVar(&cfg.Discovery.DNSPort, "discovery-dns-port", cfg.Discovery.DNSPort, "API port of the nodes found through -discovery-dns")
 	flag.Parse()
 
-	if *nodeID == "" {
-		log.Fatal("Node ID is required")
+	cfg.Normalize()
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+
+	logger, err := logging.New(os.Stderr, cfg.Log.Format, cfg.Log.Level)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging configuration: %v\n", err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+
+	fatal := func(msg string, args ...any) {
+		logger.Error(msg, args...)
+		os.Exit(1)
+	}
+
+	logger = logger.With("node", cfg.NodeID)
+
+	// Export traces to an OpenTelemetry collector
+	shutdownTracing := func(context.Context) error { return nil }
+	if cfg.Tracing.OTLPEndpoint != "" {
+		shutdownTracing, err = tracing.Setup(context.Background(), cfg.Tracing.OTLPEndpoint, cfg.NodeID, cfg.Tracing.SampleRatio)
+		if err != nil {
+			fatal("failed to set up tracing", "err", err)
+		}
 	}
 
 	// Setup data directory
-	nodeDataDir := filepath.Join(*dataDir, *nodeID)
+	nodeDataDir := filepath.Join(cfg.DataDir, cfg.NodeID)
 	raftDir := filepath.Join(nodeDataDir, "raft")
 
 	// Create directories if they don't exist
 	os.MkdirAll(raftDir, 0755)
 
-	// Parse cluster nodes
-	var nodes []string
-	if *clusterNodes != "" {
-		nodeList := strings.Split(*clusterNodes, ",")
-		for _, node := range nodeList {
-			parts := strings.Split(node, "=")
-			if len(parts) == 1 {
-				// If no address is provided, construct the default one
-				nodeID := parts[0]
-				portBase := 7000
-				if nodeID == "node1" {
-					portBase = 7001
-				} else if nodeID == "node2" {
-					portBase = 7002
-				} else if nodeID == "node3" {
-					portBase = 7003
-				}
-				nodeAddr := fmt.Sprintf("%s=127.0.0.1:%d", nodeID, portBase)
-				nodes = append(nodes, nodeAddr)
-			} else {
-				nodes = append(nodes, node)
-			}
+	// Load TLS material, reloading it whenever the files change
+	var reloader *tlsutil.Reloader
+	tlsOptions := tlsutil.Config{CertFile: cfg.TLS.Cert, KeyFile: cfg.TLS.Key, CAFile: cfg.TLS.CA}
+	if tlsOptions.Enabled() {
+		reloader, err = tlsutil.NewReloader(tlsOptions)
+		if err != nil {
+			fatal("failed to load TLS configuration", "err", err)
 		}
+		go reloader.Watch(30*time.Second, nil, func(err error) {
+			logger.Error("failed to reload TLS certificates", "err", err)
+		})
 	}
 
 	// Create and initialize Raft FSM and server
 	fsmInstance := fsm.NewFSM()
+	fsmInstance.SetLogger(logger.With("component", "fsm"))
+
+	// Publish what the state machine applies to local event stream clients
+	eventBroker := events.NewBroker(1000)
+	fsmInstance.SetPublisher(eventBroker)
 
 	// Configure Raft server
 	raftConfig := &raft_pkg.Config{
-		NodeID:            *nodeID,
-		RaftAddr:          *raftAddr,
-		RaftDir:           raftDir,
-		SnapshotInterval:  30 * time.Second,
-		SnapshotThreshold: 1000,
-		ClusterNodes:      nodes,
-		Bootstrap:         *bootstrap,
+		NodeID:             cfg.NodeID,
+		RaftAddr:           cfg.RaftAddr,
+		RaftDir:            raftDir,
+		SnapshotInterval:   cfg.Snapshot.Interval,
+		SnapshotThreshold:  cfg.Snapshot.Threshold,
+		ClusterNodes:       cfg.Nodes,
+		Bootstrap:          cfg.Bootstrap,
+		HeartbeatTimeout:   cfg.Raft.HeartbeatTimeout,
+		ElectionTimeout:    cfg.Raft.ElectionTimeout,
+		LeaderLeaseTimeout: cfg.Raft.LeaderLeaseTimeout,
+		CommitTimeout:      cfg.Raft.CommitTimeout,
+		MaxAppendEntries:   cfg.Raft.MaxAppendEntries,
+		TrailingLogs:       cfg.Raft.TrailingLogs,
+		SnapshotRetain:     cfg.Snapshot.Retain,
+		TransportPoolSize:  cfg.Raft.TransportPoolSize,
+		TransportTimeout:   cfg.Raft.TransportTimeout,
+		AllowLegacyPeers:   cfg.Raft.AllowLegacyPeers,
+		Logger:             logger,
+	}
+	if cfg.TLS.Raft {
+		raftConfig.TLS = reloader
 	}
 
 	// Create Raft server
 	raftServer, err := raft_pkg.NewServer(raftConfig, fsmInstance)
 	if err != nil {
-		log.Fatalf("Failed to create Raft server: %v", err)
+		fatal("failed to create Raft server", "err", err)
 	}
 
 	// Start Raft server
 	if err := raftServer.Start(); err != nil {
-		log.Fatalf("Failed to start Raft server: %v", err)
+		fatal("failed to start Raft server", "err", err)
+	}
+
+	// Background components run until stopCh is closed on shutdown
+	stopCh := make(chan struct{})
+	var components sync.WaitGroup
+	run := func(loop func(<-chan struct{})) {
+		components.Add(1)
+		go func() {
+			defer components.Done()
+			loop(stopCh)
+		}()
 	}
 
 	// Create and start API server
 	apiHandler := api.NewHandler(raftServer, fsmInstance)
+	apiHandler.ReadyMaxLag = cfg.ReadyMaxLag
+	apiHandler.Logger = logger.With("component", "api")
+	if cfg.Auth {
+		apiHandler.EnableAuth(cfg.AdminToken)
+		apiHandler.EnablePeerToken(cfg.PeerToken)
+		if cfg.PeerToken == "" && (reloader == nil || cfg.TLS.CA == "") {
+			logger.Warn("files cannot be replicated between nodes: authentication requires peer_token or TLS client certificates")
+		}
+	}
+
+	// Replicate uploaded files between nodes
+	advertiseURL := cfg.HTTPAdvertise
+	if advertiseURL == "" {
+		scheme := "http"
+		if reloader != nil {
+			scheme = "https"
+		}
+		advertiseURL = fmt.Sprintf("%s://%s", scheme, cfg.HTTPAddr)
+	}
+
+	blobStore, err := blob.NewStore(filepath.Join(nodeDataDir, "blobs"))
+	if err != nil {
+		fatal("failed to create file store", "err", err)
+	}
+
+	// Files are only fetched from members of the cluster
+	peerClient := &http.Client{Timeout: 5 * time.Minute}
+	if reloader != nil {
+		peerClient.Transport = &http.Transport{TLSClientConfig: reloader.ClientConfig(func(nodeID string) error {
+			if !raftServer.IsMember(nodeID) {
+				return fmt.Errorf("node %q is not a member of the cluster", nodeID)
+			}
+			return nil
+		})}
+	}
+
+	replicator := blob.NewReplicator(blobStore, raftServer, fsmInstance, peerClient)
+	replicator.AuthToken = cfg.PeerToken
+	replicator.GracePeriod = cfg.Files.GCGrace
+	replicator.MaxSize = cfg.Files.MaxUploadMB << 20
+	replicator.Logger = logger.With("component", "files")
+	run(replicator.Run)
+
+	apiHandler.EnableFiles(blobStore, replicator, advertiseURL)
+
+	// Find the cluster and ask its leader to admit this node
+	if cfg.Discovery.Enabled() {
+		scheme := "http"
+		discoveryClient := &http.Client{Timeout: 10 * time.Second}
+		if reloader != nil {
+			scheme = "https"
+			// The members are not known yet; any node of the CA will do
+			discoveryClient.Transport = &http.Transport{TLSClientConfig: reloader.ClientConfig(tlsutil.AnyNode)}
+		}
+		discoverer := discovery.NewDiscoverer(discovery.Config{
+			Seeds:   cfg.Discovery.Seeds,
+			SRV:     cfg.Discovery.SRV,
+			DNS:     cfg.Discovery.DNS,
+			DNSPort: cfg.Discovery.DNSPort,
+			Scheme:  scheme,
+		}, discoveryClient)
+		// Discovered hosts only get the peer token, which lets them list the
+		// servers and join but nothing else, and only over TLS
+		if cfg.PeerToken != "" {
+			if reloader != nil {
+				discoverer.AuthToken = cfg.PeerToken
+			} else {
+				logger.Warn("not sending peer_token to discovered nodes without TLS; joining an authenticated cluster requires -tls-cert and -tls-key")
+			}
+		}
+		discoverer.Interval = cfg.Discovery.Interval
+		discoverer.OnMembers = func(members []discovery.Member) {
+			for _, member := range members {
+				raftServer.ExpectPeer(member.ID, member.Address)
+			}
+		}
+		discoverer.Logger = logger.With("component", "discovery")
+		run(func(stopCh <-chan struct{}) {
+			discoverer.JoinCluster(cfg.NodeID, cfg.RaftAddr, stopCh)
+		})
+	}
+
+	// Drive connected printers while this node is the leader
+	printerManager := printer.NewManager(raftServer, fsmInstance, blobStore, replicator, nil)
+	printerManager.Logger = logger.With("component", "printers")
+	run(printerManager.Run)
+
+	apiHandler.EnablePrinters(printerManager)
+
+	// Deliver low stock alerts while this node is the leader
+	alertDispatcher := alerts.NewDispatcher(raftServer, fsmInstance)
+	alertDispatcher.Logger = logger.With("component", "alerts")
+	run(alertDispatcher.Run)
+
+	// Post events to webhook subscribers while this node is the leader
+	webhookDeliverer := webhooks.NewDeliverer(raftServer, fsmInstance, nil)
+	webhookDeliverer.Logger = logger.With("component", "webhooks")
+	run(webhookDeliverer.Run)
+
+	apiHandler.EnableEvents(eventBroker)
+
+	// Export Raft, HTTP and domain metrics to Prometheus
+	nodeMetrics, err := metrics.New(raftServer, fsmInstance, printerManager)
+	if err != nil {
+		fatal("failed to set up metrics", "err", err)
+	}
+	apiHandler.EnableMetrics(nodeMetrics)
+
+	var httpTLS *tls.Config
+	if reloader != nil {
+		httpTLS = reloader.ServerConfig(tls.VerifyClientCertIfGiven, nil)
+	}
+
+	// Reload certificates on SIGHUP
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	go func() {
+		for range hupCh {
+			if reloader == nil {
+				continue
+			}
+			if err := reloader.Reload(); err != nil {
+				logger.Error("failed to reload TLS certificates", "err", err)
+			} else {
+				logger.Info("reloaded TLS certificates")
+			}
+		}
+	}()
 
 	// Capture signals for graceful shutdown
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
 
 	// Start HTTP server in a goroutine
+	httpServer := api.NewServer(apiHandler, cfg.HTTPAddr, httpTLS)
 	go func() {
-		log.Printf("Starting HTTP server on %s", *httpAddr)
-		if err := api.StartServer(apiHandler, *httpAddr); err != nil {
-			log.Fatalf("HTTP server failed: %v", err)
+		logger.Info("starting HTTP server", "addr", cfg.HTTPAddr)
+		if err := api.Serve(httpServer); err != nil {
+			fatal("HTTP server failed", "err", err)
 		}
 	}()
 
-	// Print node status information
-	go func() {
+	// Log node status, at info level whenever it changes
+	run(func(stopCh <-chan struct{}) {
 		ticker := time.NewTicker(5 * time.Second)
 		defer ticker.Stop()
 
+		var lastState, lastLeader string
 		for {
 			select {
+			case <-stopCh:
+				return
 			case <-ticker.C:
-				isLeader := raftServer.IsLeader()
 				state := raftServer.GetState().String()
 				leaderAddr := raftServer.LeaderAddr()
 
-				fmt.Printf("Node %s | State: %s | Leader: %t | Leader Address: %s\n",
-					*nodeID, state, isLeader, leaderAddr)
+				level := slog.LevelDebug
+				if state != lastState || leaderAddr != lastLeader {
+					level = slog.LevelInfo
+				}
+				lastState, lastLeader = state, leaderAddr
+
+				logger.Log(context.Background(), level, "node status",
+					"state", state, "leader", raftServer.IsLeader(), "leader_addr", leaderAddr)
 			}
 		}
-	}()
+	})
 
 	// Wait for termination signal
 	<-sigCh
-	fmt.Println("Shutting down...")
+	logger.Info("shutting down")
+
+	// Refuse writes and wait for in-flight requests to finish
+	apiHandler.Drain()
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	if err := httpServer.Shutdown(ctx); err != nil {
+		logger.Error("failed to drain HTTP requests", "err", err)
+	}
+	cancel()
 
-	// Shutdown Raft server
+	// Stop background components before Raft goes away under them
+	close(stopCh)
+	components.Wait()
+
+	// Hand over leadership, take a final snapshot and close Raft
 	if err := raftServer.Shutdown(); err != nil {
-		log.Printf("Error shutting down Raft server: %v", err)
+		logger.Error("failed to shut down Raft server", "err", err)
+	}
+
+	// Flush buffered spans
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error("failed to flush traces", "err", err)
 	}
+
+	logger.Info("shut down")
 }
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const usage = `Usage: raft3dctl [flags] <command> [arguments]
+
+Commands:
+  cluster                        Show the members of the cluster and their replication progress
+  transfer-leadership [node-id]  Hand leadership to node-id, or to the most up-to-date follower
+
+Flags:
+`
+
+// raft3dctl administers a running cluster through the HTTP API of its nodes.
+// Commands that must run on the leader are sent to each -addr in turn until
+// the leader accepts them.
+func main() {
+	var (
+		addrs   = flag.String("addr", envOr("RAFT3D_ADDR", "http://127.0.0.1:8001"), "Comma-separated base URLs of cluster nodes (also RAFT3D_ADDR)")
+		token   = flag.String("token", os.Getenv("RAFT3D_TOKEN"), "Admin API token (also RAFT3D_TOKEN)")
+		caFile  = flag.String("ca", "", "PEM CA bundle used to verify HTTPS nodes")
+		timeout = flag.Duration("timeout", 30*time.Second, "Request timeout")
+	)
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	log.SetFlags(0)
+
+	client, err := newClient(strings.Split(*addrs, ","), *token, *caFile, *timeout)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch flag.Arg(0) {
+	case "cluster":
+		err = showCluster(client)
+	case "transfer-leadership":
+		err = transferLeadership(client, flag.Arg(1))
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+type client struct {
+	addrs []string
+	token string
+	http  *http.Client
+}
+
+func newClient(addrs []string, token, caFile string, timeout time.Duration) (*client, error) {
+	c := &client{token: token, http: &http.Client{
+		Timeout: timeout,
+		// Redirects from followers are answered by trying the next node
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}}
+	for _, addr := range addrs {
+		if addr = strings.TrimRight(strings.TrimSpace(addr), "/"); addr != "" {
+			c.addrs = append(c.addrs, addr)
+		}
+	}
+	if len(c.addrs) == 0 {
+		return nil, fmt.Errorf("no node addresses given")
+	}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		c.http.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	}
+	return c, nil
+}
+
+// do sends a request to each node in turn and decodes the first successful
+// answer into result. Nodes that are unreachable or not the leader are
+// skipped.
+func (c *client) do(method, path string, body, result interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	var errs []string
+	for _, addr := range c.addrs {
+		req, err := http.NewRequest(method, addr+path, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", addr, err))
+			continue
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusTemporaryRedirect:
+			errs = append(errs, fmt.Sprintf("%s: not the leader", addr))
+			continue
+		case resp.StatusCode >= 300:
+			return fmt.Errorf("%s: %s: %s", addr, resp.Status, strings.TrimSpace(string(data)))
+		}
+		return json.Unmarshal(data, result)
+	}
+	return fmt.Errorf("no node accepted the request: %s", strings.Join(errs, "; "))
+}
+
+type member struct {
+	ID             string  `json:"id"`
+	Address        string  `json:"address"`
+	Suffrage       string  `json:"suffrage"`
+	Leader         bool    `json:"leader"`
+	ReplicationLag *uint64 `json:"replication_lag"`
+}
+
+type cluster struct {
+	ID       string   `json:"cluster_id"`
+	NodeID   string   `json:"node_id"`
+	State    string   `json:"state"`
+	LeaderID string   `json:"leader_id"`
+	Term     uint64   `json:"term"`
+	Servers  []member `json:"servers"`
+}
+
+func showCluster(c *client) error {
+	var view cluster
+	if err := c.do("GET", "/api/v1/cluster", nil, &view); err != nil {
+		return err
+	}
+
+	if view.ID != "" {
+		fmt.Printf("Cluster %s\n", view.ID)
+	}
+	fmt.Printf("Leader %s, term %d (as seen by %s)\n\n", view.LeaderID, view.Term, view.NodeID)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tADDRESS\tSUFFRAGE\tROLE\tLAG")
+	for _, m := range view.Servers {
+		role, lag := "follower", "-"
+		if m.Leader {
+			role = "leader"
+		}
+		if m.ReplicationLag != nil {
+			lag = fmt.Sprint(*m.ReplicationLag)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", m.ID, m.Address, m.Suffrage, role, lag)
+	}
+	return w.Flush()
+}
+
+func transferLeadership(c *client, nodeID string) error {
+	var result struct {
+		LeaderID string `json:"leader_id"`
+	}
+	if err := c.do("POST", "/api/v1/cluster/leadership/transfer", map[string]string{"node_id": nodeID}, &result); err != nil {
+		return err
+	}
+	fmt.Printf("Leadership transferred to %s\n", result.LeaderID)
+	return nil
+}
@@ -0,0 +1,140 @@
+package fsm
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/raft3d/pkg/events"
+	"github.com/raft3d/pkg/models"
+)
+
+// OpDeliver marks an alert as delivered by the leader.
+const OpDeliver = "deliver"
+
+// lowStockThreshold returns the effective low stock threshold of a filament,
+// or zero if it has none.
+func (f *FSM) lowStockThreshold(filament *models.Filament) int {
+	if filament.LowStockThresholdGrams > 0 {
+		return filament.LowStockThresholdGrams
+	}
+	if material, exists := f.store.materials[filament.Type]; exists {
+		return material.LowStockThresholdGrams
+	}
+	return 0
+}
+
+// checkLowStock raises an alert when a filament is at or below its threshold
+// and has not raised one since it was last above it. Filaments refilled above
+// the threshold are armed again.
+func (f *FSM) checkLowStock(filament *models.Filament) {
+	key := scopedKey(filament.TenantID, filament.ID)
+	threshold := f.lowStockThreshold(filament)
+
+	if threshold == 0 || filament.RemainingWeightInGrams > threshold {
+		delete(f.store.lowStock, key)
+		return
+	}
+	if f.store.lowStock[key] {
+		return
+	}
+
+	f.store.lowStock[key] = true
+
+	alert := &models.Alert{
+		ID:             fmt.Sprintf("%d-%s", f.index, filament.ID),
+		TenantID:       filament.TenantID,
+		FilamentID:     filament.ID,
+		Material:       filament.Type,
+		Color:          filament.Color,
+		ThresholdGrams: threshold,
+		RemainingGrams: filament.RemainingWeightInGrams,
+		Status:         models.AlertPending,
+		RaisedAt:       f.now,
+	}
+	f.store.alerts[scopedKey(alert.TenantID, alert.ID)] = alert
+}
+
+func (f *FSM) applyAlertCommand(cmd *Command) interface{} {
+	switch cmd.Op {
+	case OpDeliver:
+		ref, err := decodeRef(cmd.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal ID: %v", err)
+		}
+
+		alert, exists := f.store.alerts[scopedKey(ref.TenantID, ref.ID)]
+		if !exists {
+			return fmt.Errorf("alert not found: %s", ref.ID)
+		}
+
+		// A leader that failed over mid delivery may deliver twice; only
+		// the first delivery counts.
+		if alert.Status == models.AlertDelivered {
+			return nil
+		}
+
+		alert.Status = models.AlertDelivered
+		alert.DeliveredAt = cmd.Timestamp
+		f.emit(events.TypeFilamentLowStock, alert.TenantID, alert)
+		return nil
+
+	case OpDelete:
+		ref, err := decodeRef(cmd.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal ID: %v", err)
+		}
+
+		key := scopedKey(ref.TenantID, ref.ID)
+		if _, exists := f.store.alerts[key]; !exists {
+			return fmt.Errorf("alert not found: %s", ref.ID)
+		}
+
+		delete(f.store.alerts, key)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown alert operation: %s", cmd.Op)
+	}
+}
+
+// GetAlerts returns copies of a tenant's alerts, oldest first.
+func (s *Store) GetAlerts(tenantID string) []models.Alert {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	alerts := make([]models.Alert, 0)
+	for _, a := range s.alerts {
+		if a.TenantID == tenantID {
+			alerts = append(alerts, *a)
+		}
+	}
+
+	sortAlerts(alerts)
+	return alerts
+}
+
+// GetPendingAlerts returns copies of the alerts of every tenant that have not
+// been delivered yet, oldest first.
+func (s *Store) GetPendingAlerts() []models.Alert {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	alerts := make([]models.Alert, 0)
+	for _, a := range s.alerts {
+		if a.Status == models.AlertPending {
+			alerts = append(alerts, *a)
+		}
+	}
+
+	sortAlerts(alerts)
+	return alerts
+}
+
+func sortAlerts(alerts []models.Alert) {
+	sort.Slice(alerts, func(a, b int) bool {
+		if !alerts[a].RaisedAt.Equal(alerts[b].RaisedAt) {
+			return alerts[a].RaisedAt.Before(alerts[b].RaisedAt)
+		}
+		return alerts[a].ID < alerts[b].ID
+	})
+}
@@ -0,0 +1,370 @@
+package fsm
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/raft3d/pkg/events"
+	"github.com/raft3d/pkg/models"
+)
+
+const (
+	// OpCancel cancels every unfinished print job of a batch.
+	OpCancel = "cancel"
+	// OpAddDependency and OpRemoveDependency edit the dependencies of a
+	// queued print job.
+	OpAddDependency    = "add_dependency"
+	OpRemoveDependency = "remove_dependency"
+)
+
+// DependencyChange adds or removes the edge "JobID runs after DependsOn".
+type DependencyChange struct {
+	TenantID  string `json:"tenant_id,omitempty"`
+	JobID     string `json:"job_id"`
+	DependsOn string `json:"depends_on"`
+}
+
+func (f *FSM) applyBatchCommand(cmd *Command) interface{} {
+	switch cmd.Op {
+	case OpCreate:
+		var batch models.Batch
+		if err := json.Unmarshal(cmd.Payload, &batch); err != nil {
+			return fmt.Errorf("failed to unmarshal batch: %v", err)
+		}
+
+		normalizeTenant(&batch.TenantID)
+		if err := batch.Validate(); err != nil {
+			return err
+		}
+
+		if err := f.requireTenant(batch.TenantID); err != nil {
+			return err
+		}
+
+		key := scopedKey(batch.TenantID, batch.ID)
+		if _, exists := f.store.batches[key]; exists {
+			return fmt.Errorf("batch already exists: %s", batch.ID)
+		}
+
+		batch.CreatedAt = cmd.Timestamp
+		f.store.batches[key] = &batch
+		return nil
+
+	case OpUpdate:
+		var batch models.Batch
+		if err := json.Unmarshal(cmd.Payload, &batch); err != nil {
+			return fmt.Errorf("failed to unmarshal batch: %v", err)
+		}
+
+		normalizeTenant(&batch.TenantID)
+		if err := batch.Validate(); err != nil {
+			return err
+		}
+
+		key := scopedKey(batch.TenantID, batch.ID)
+		existing, exists := f.store.batches[key]
+		if !exists {
+			return fmt.Errorf("batch not found: %s", batch.ID)
+		}
+
+		batch.CreatedAt = existing.CreatedAt
+		f.store.batches[key] = &batch
+		return nil
+
+	case OpCancel:
+		ref, err := decodeRef(cmd.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal ID: %v", err)
+		}
+
+		if _, exists := f.store.batches[scopedKey(ref.TenantID, ref.ID)]; !exists {
+			return fmt.Errorf("batch not found: %s", ref.ID)
+		}
+
+		var cancelled []*models.PrintJob
+		for _, j := range f.store.printJobs {
+			if j.TenantID == ref.TenantID && j.BatchID == ref.ID &&
+				(j.Status == models.StatusQueued || j.Status == models.StatusRunning) {
+				cancelled = append(cancelled, j)
+			}
+		}
+		sortBySequence(cancelled)
+
+		for _, j := range cancelled {
+			j.Status = models.StatusCancelled
+			f.emit(events.TypePrintJobStatusChanged, j.TenantID, j)
+		}
+		for _, j := range cancelled {
+			f.cancelDependents(j.TenantID, j.ID)
+		}
+		f.emit(events.TypeBatchCancelled, ref.TenantID, ref)
+		return nil
+
+	case OpDelete:
+		ref, err := decodeRef(cmd.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal ID: %v", err)
+		}
+
+		key := scopedKey(ref.TenantID, ref.ID)
+		if _, exists := f.store.batches[key]; !exists {
+			return fmt.Errorf("batch not found: %s", ref.ID)
+		}
+
+		for _, j := range f.store.printJobs {
+			if j.TenantID == ref.TenantID && j.BatchID == ref.ID {
+				return fmt.Errorf("batch %s still has print jobs", ref.ID)
+			}
+		}
+
+		delete(f.store.batches, key)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown batch operation: %s", cmd.Op)
+	}
+}
+
+// applyDependencyCommand edits the dependencies of a queued print job.
+func (f *FSM) applyDependencyCommand(cmd *Command) interface{} {
+	var change DependencyChange
+	if err := json.Unmarshal(cmd.Payload, &change); err != nil {
+		return fmt.Errorf("failed to unmarshal dependency change: %v", err)
+	}
+
+	normalizeTenant(&change.TenantID)
+	job, exists := f.store.printJobs[scopedKey(change.TenantID, change.JobID)]
+	if !exists {
+		return fmt.Errorf("print job not found: %s", change.JobID)
+	}
+
+	if job.Status != models.StatusQueued {
+		return fmt.Errorf("dependencies of %s print job %s cannot change", job.Status, job.ID)
+	}
+
+	switch cmd.Op {
+	case OpAddDependency:
+		if containsString(job.DependsOn, change.DependsOn) {
+			return nil
+		}
+
+		dependsOn := append(append([]string(nil), job.DependsOn...), change.DependsOn)
+		if err := f.checkDependencies(change.TenantID, job.ID, dependsOn); err != nil {
+			return err
+		}
+
+		job.DependsOn = dependsOn
+		return nil
+
+	case OpRemoveDependency:
+		dependsOn := make([]string, 0, len(job.DependsOn))
+		for _, dep := range job.DependsOn {
+			if dep != change.DependsOn {
+				dependsOn = append(dependsOn, dep)
+			}
+		}
+		if len(dependsOn) == len(job.DependsOn) {
+			return fmt.Errorf("print job %s does not depend on %s", job.ID, change.DependsOn)
+		}
+
+		job.DependsOn = dependsOn
+		return nil
+
+	default:
+		return fmt.Errorf("unknown print job operation: %s", cmd.Op)
+	}
+}
+
+// checkDependencies rejects dependencies on missing or cancelled jobs and
+// dependencies that would make jobID transitively depend on itself.
+func (f *FSM) checkDependencies(tenantID, jobID string, dependsOn []string) error {
+	for _, dep := range dependsOn {
+		if dep == jobID {
+			return fmt.Errorf("print job cannot depend on itself")
+		}
+
+		j, exists := f.store.printJobs[scopedKey(tenantID, dep)]
+		if !exists {
+			return fmt.Errorf("dependency not found: %s", dep)
+		}
+		if j.Status == models.StatusCancelled {
+			return fmt.Errorf("dependency %s is cancelled", dep)
+		}
+	}
+
+	visited := make(map[string]bool)
+	var reaches func(id string) bool
+	reaches = func(id string) bool {
+		if id == jobID {
+			return true
+		}
+		if visited[id] {
+			return false
+		}
+		visited[id] = true
+
+		j, exists := f.store.printJobs[scopedKey(tenantID, id)]
+		if !exists {
+			return false
+		}
+		for _, dep := range j.DependsOn {
+			if reaches(dep) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, dep := range dependsOn {
+		if reaches(dep) {
+			return fmt.Errorf("dependency on %s would create a cycle", dep)
+		}
+	}
+	return nil
+}
+
+// blockedBy returns the dependencies of a job that are not Done yet.
+func blockedBy(printJobs map[string]*models.PrintJob, job *models.PrintJob) []string {
+	var pending []string
+	for _, dep := range job.DependsOn {
+		j, exists := printJobs[scopedKey(job.TenantID, dep)]
+		if !exists || j.Status != models.StatusDone {
+			pending = append(pending, dep)
+		}
+	}
+	return pending
+}
+
+// cancelDependents cancels the queued jobs that depend on a cancelled job,
+// directly or through other jobs, as they could never start.
+func (f *FSM) cancelDependents(tenantID, jobID string) {
+	pending := []string{jobID}
+	for len(pending) > 0 {
+		id := pending[0]
+		pending = pending[1:]
+
+		var dependents []*models.PrintJob
+		for _, j := range f.store.printJobs {
+			if j.TenantID == tenantID && j.Status == models.StatusQueued && containsString(j.DependsOn, id) {
+				dependents = append(dependents, j)
+			}
+		}
+		sortBySequence(dependents)
+
+		for _, j := range dependents {
+			j.Status = models.StatusCancelled
+			f.emit(events.TypePrintJobStatusChanged, j.TenantID, j)
+			pending = append(pending, j.ID)
+		}
+	}
+}
+
+// sortBySequence puts jobs in submission order, so that the events of jobs
+// changed together are emitted in the same order on every node.
+func sortBySequence(jobs []*models.PrintJob) {
+	sort.Slice(jobs, func(a, b int) bool {
+		return jobs[a].Sequence < jobs[b].Sequence
+	})
+}
+
+// hasDependents reports whether an unfinished job depends on the given job.
+func (f *FSM) hasDependents(tenantID, jobID string) bool {
+	return f.hasActiveJob(func(j *models.PrintJob) bool {
+		return j.TenantID == tenantID && containsString(j.DependsOn, jobID)
+	})
+}
+
+func (s *Store) GetBatches(tenantID string) []*models.Batch {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	batches := make([]*models.Batch, 0)
+	for _, b := range s.batches {
+		if b.TenantID == tenantID {
+			batches = append(batches, b)
+		}
+	}
+
+	return batches
+}
+
+func (s *Store) GetBatch(tenantID, id string) (*models.Batch, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	batch, found := s.batches[scopedKey(tenantID, id)]
+	return batch, found
+}
+
+// GetBatchJobs returns copies of the print jobs of a batch in submission
+// order.
+func (s *Store) GetBatchJobs(tenantID, batchID string) []models.PrintJob {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	printJobs := make([]models.PrintJob, 0)
+	for _, j := range s.printJobs {
+		if j.TenantID == tenantID && j.BatchID == batchID {
+			printJobs = append(printJobs, *j)
+		}
+	}
+
+	sort.Slice(printJobs, func(a, b int) bool {
+		return printJobs[a].Sequence < printJobs[b].Sequence
+	})
+	return printJobs
+}
+
+// GetBatchProgress summarises the print jobs of a batch.
+func (s *Store) GetBatchProgress(tenantID, batchID string) models.BatchProgress {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var progress models.BatchProgress
+	for _, j := range s.printJobs {
+		if j.TenantID != tenantID || j.BatchID != batchID {
+			continue
+		}
+
+		progress.Total++
+		if j.Status != models.StatusCancelled {
+			progress.TotalGrams += j.PrintWeightInGrams
+		}
+
+		switch j.Status {
+		case models.StatusQueued:
+			progress.Queued++
+			progress.RemainingGrams += j.PrintWeightInGrams
+			if len(blockedBy(s.printJobs, j)) > 0 {
+				progress.Blocked++
+			}
+		case models.StatusRunning:
+			progress.Running++
+			progress.RemainingGrams += j.PrintWeightInGrams
+		case models.StatusDone:
+			progress.Done++
+		case models.StatusCancelled:
+			progress.Cancelled++
+		}
+	}
+
+	switch {
+	case progress.Total == 0:
+		progress.Status = models.BatchEmpty
+	case progress.Done == progress.Total:
+		progress.Status = models.BatchDone
+	case progress.Queued+progress.Running == 0:
+		progress.Status = models.BatchCancelled
+	case progress.Running+progress.Done == 0:
+		progress.Status = models.BatchQueued
+	default:
+		progress.Status = models.BatchInProgress
+	}
+
+	if active := progress.Total - progress.Cancelled; active > 0 {
+		progress.PercentDone = float64(progress.Done) * 100 / float64(active)
+	}
+
+	return progress
+}
@@ -0,0 +1,157 @@
+package fsm
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/raft3d/pkg/models"
+)
+
+func TestDependencyCycles(t *testing.T) {
+	tests := []struct {
+		name      string
+		job       string
+		dependsOn string
+		wantErr   bool
+	}{
+		{"on itself", "c", "c", true},
+		{"direct cycle", "b", "c", true},
+		{"transitive cycle", "a", "c", true},
+		{"independent job", "c", "d", false},
+		{"already implied", "c", "a", false},
+		{"missing job", "c", "nope", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// c depends on b, which depends on a; d stands alone
+			tf := newTestFSM(t)
+			tf.addPrinter(models.DefaultTenant, "p1")
+			for _, id := range []string{"a", "b", "c", "d"} {
+				j := job("", id, "p1")
+				switch id {
+				case "b":
+					j.DependsOn = []string{"a"}
+				case "c":
+					j.DependsOn = []string{"b"}
+				}
+				tf.mustApply(OpCreate, EntityPrintJob, j)
+			}
+
+			err := tf.apply(OpAddDependency, EntityPrintJob, DependencyChange{JobID: tt.job, DependsOn: tt.dependsOn})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("adding dependency of %s on %s: err = %v, want error %v", tt.job, tt.dependsOn, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDependencyOrdering(t *testing.T) {
+	tf := newTestFSM(t)
+	tf.addPrinter(models.DefaultTenant, "p1")
+	tf.addPrinter(models.DefaultTenant, "p2")
+	tf.mustApply(OpCreate, EntityPrintJob, job("", "base", "p1"))
+	top := job("", "top", "p2")
+	top.DependsOn = []string{"base"}
+	tf.mustApply(OpCreate, EntityPrintJob, top)
+
+	queueIDs := func() []string {
+		var ids []string
+		for _, j := range tf.store.GetQueue(models.DefaultTenant, "", "") {
+			ids = append(ids, j.ID)
+		}
+		return ids
+	}
+
+	steps := []struct {
+		job, status string
+		wantErr     bool
+		queue       []string
+		blocked     int
+	}{
+		{"top", models.StatusRunning, true, []string{"base"}, 1},
+		{"base", models.StatusRunning, false, nil, 1},
+		{"top", models.StatusRunning, true, nil, 1},
+		{"base", models.StatusDone, false, []string{"top"}, 0},
+		{"top", models.StatusRunning, false, nil, 0},
+	}
+	for _, step := range steps {
+		err := tf.setStatus("", step.job, step.status)
+		if (err != nil) != step.wantErr {
+			t.Fatalf("%s -> %s: err = %v, want error %v", step.job, step.status, err, step.wantErr)
+		}
+		if got := queueIDs(); !reflect.DeepEqual(got, step.queue) {
+			t.Errorf("after %s -> %s: queue = %v, want %v", step.job, step.status, got, step.queue)
+		}
+		if got := tf.store.GetBlockedJobs(models.DefaultTenant, "", ""); len(got) != step.blocked {
+			t.Errorf("after %s -> %s: %d blocked jobs, want %d", step.job, step.status, len(got), step.blocked)
+		}
+	}
+}
+
+func TestBlockedJobsReportPendingDependencies(t *testing.T) {
+	tf := newTestFSM(t)
+	tf.addPrinter(models.DefaultTenant, "p1")
+	tf.mustApply(OpCreate, EntityPrintJob, job("", "a", "p1"))
+	tf.mustApply(OpCreate, EntityPrintJob, job("", "b", "p1"))
+	c := job("", "c", "p1")
+	c.DependsOn = []string{"a", "b"}
+	tf.mustApply(OpCreate, EntityPrintJob, c)
+
+	tf.mustApply(OpUpdate, EntityPrintJob, PrintJobStatusChange{ID: "a", Status: models.StatusRunning})
+	tf.mustApply(OpUpdate, EntityPrintJob, PrintJobStatusChange{ID: "a", Status: models.StatusDone})
+
+	blocked := tf.store.GetBlockedJobs(models.DefaultTenant, "", "")
+	if len(blocked) != 1 || blocked[0].ID != "c" || !reflect.DeepEqual(blocked[0].BlockedBy, []string{"b"}) {
+		t.Errorf("blocked jobs = %+v, want c blocked by [b]", blocked)
+	}
+}
+
+func TestCancelCascadesToDependents(t *testing.T) {
+	tests := []struct {
+		name   string
+		cancel func(tf *testFSM)
+	}{
+		{"job", func(tf *testFSM) {
+			tf.mustApply(OpUpdate, EntityPrintJob, PrintJobStatusChange{ID: "a", Status: models.StatusCancelled})
+		}},
+		{"batch", func(tf *testFSM) {
+			tf.mustApply(OpCancel, EntityBatch, EntityRef{ID: "order"})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// b and c depend on a through a chain; d is unrelated and
+			// outside the batch
+			tf := newTestFSM(t)
+			tf.addPrinter(models.DefaultTenant, "p1")
+			tf.mustApply(OpCreate, EntityBatch, models.Batch{ID: "order", Name: "Order"})
+			a := job("", "a", "p1")
+			a.BatchID = "order"
+			tf.mustApply(OpCreate, EntityPrintJob, a)
+			b := job("", "b", "p1")
+			b.DependsOn = []string{"a"}
+			tf.mustApply(OpCreate, EntityPrintJob, b)
+			c := job("", "c", "p1")
+			c.DependsOn = []string{"b"}
+			tf.mustApply(OpCreate, EntityPrintJob, c)
+			tf.mustApply(OpCreate, EntityPrintJob, job("", "d", "p1"))
+
+			tt.cancel(tf)
+
+			want := map[string]string{
+				"a": models.StatusCancelled,
+				"b": models.StatusCancelled,
+				"c": models.StatusCancelled,
+				"d": models.StatusQueued,
+			}
+			for id, status := range want {
+				if got := tf.status(models.DefaultTenant, id); got != status {
+					t.Errorf("%s is %s, want %s", id, got, status)
+				}
+			}
+			if blocked := tf.store.GetBlockedJobs(models.DefaultTenant, "", ""); len(blocked) != 0 {
+				t.Errorf("%d jobs left blocked", len(blocked))
+			}
+		})
+	}
+}
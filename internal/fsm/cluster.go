@@ -0,0 +1,46 @@
+package fsm
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// EntityCluster commands record the ID of the cluster, which the leader
+// proposes once so that every member learns it through the log.
+const EntityCluster = "cluster"
+
+type ClusterInfo struct {
+	ID string `json:"id"`
+}
+
+func (f *FSM) applyClusterCommand(cmd *Command) interface{} {
+	switch cmd.Op {
+	case OpCreate:
+		var info ClusterInfo
+		if err := json.Unmarshal(cmd.Payload, &info); err != nil {
+			return fmt.Errorf("failed to unmarshal cluster info: %v", err)
+		}
+		if info.ID == "" {
+			return fmt.Errorf("cluster ID cannot be empty")
+		}
+
+		// Two leaders may both propose an ID around a failover; the first
+		// one committed wins
+		if f.store.clusterID != "" && f.store.clusterID != info.ID {
+			return fmt.Errorf("cluster already has ID %s", f.store.clusterID)
+		}
+		f.store.clusterID = info.ID
+		return nil
+
+	default:
+		return fmt.Errorf("unknown cluster operation: %s", cmd.Op)
+	}
+}
+
+// ClusterID returns the ID recorded in the log, or "" until the leader has
+// recorded one.
+func (s *Store) ClusterID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.clusterID
+}
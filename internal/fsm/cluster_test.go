@@ -0,0 +1,40 @@
+package fsm
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+)
+
+func TestClusterIDIsRecordedOnce(t *testing.T) {
+	tf := newTestFSM(t)
+	if id := tf.store.ClusterID(); id != "" {
+		t.Fatalf("new FSM has cluster ID %q", id)
+	}
+
+	tf.mustApply(OpCreate, EntityCluster, ClusterInfo{ID: "first"})
+	tf.mustApply(OpCreate, EntityCluster, ClusterInfo{ID: "first"})
+	if err := tf.apply(OpCreate, EntityCluster, ClusterInfo{ID: "second"}); err == nil {
+		t.Error("a second cluster ID replaced the first")
+	}
+	if err := tf.apply(OpCreate, EntityCluster, ClusterInfo{}); err == nil {
+		t.Error("an empty cluster ID was accepted")
+	}
+
+	snapshot, err := tf.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := newTestFSM(t)
+	if err := restored.Restore(io.NopCloser(bytes.NewReader(data))); err != nil {
+		t.Fatal(err)
+	}
+	if id := restored.store.ClusterID(); id != "first" {
+		t.Errorf("restored cluster ID = %q, want first", id)
+	}
+}
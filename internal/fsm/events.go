@@ -0,0 +1,49 @@
+package fsm
+
+import (
+	"encoding/json"
+
+	"github.com/raft3d/pkg/events"
+)
+
+// Publisher receives the events produced by applied commands.
+type Publisher interface {
+	Publish(events.Event)
+}
+
+// SetPublisher routes the events of applied commands to p. It must be called
+// before the FSM is handed to Raft.
+func (f *FSM) SetPublisher(p Publisher) {
+	f.publisher = p
+}
+
+// emit queues an event to be published once the command being applied has
+// succeeded.
+func (f *FSM) emit(eventType, tenantID string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+
+	f.pending = append(f.pending, events.Event{
+		Index:    f.index,
+		Seq:      len(f.pending),
+		Type:     eventType,
+		TenantID: tenantID,
+		Time:     f.now,
+		Data:     payload,
+	})
+}
+
+// publish hands the events of the command just applied to the publisher.
+func (f *FSM) publish() {
+	pending := f.pending
+	f.pending = nil
+
+	if f.publisher == nil {
+		return
+	}
+	for _, e := range pending {
+		f.publisher.Publish(e)
+	}
+}
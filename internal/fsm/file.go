@@ -0,0 +1,271 @@
+package fsm
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/raft3d/pkg/models"
+)
+
+func (f *FSM) applyFileCommand(cmd *Command) interface{} {
+	switch cmd.Op {
+	case OpCreate:
+		var manifest models.FileManifest
+		if err := json.Unmarshal(cmd.Payload, &manifest); err != nil {
+			return fmt.Errorf("failed to unmarshal file manifest: %v", err)
+		}
+
+		normalizeOwners(&manifest)
+		if err := manifest.Validate(); err != nil {
+			return err
+		}
+
+		for _, o := range manifest.Owners {
+			if err := f.requireTenant(o.TenantID); err != nil {
+				return err
+			}
+		}
+
+		// Uploading the same content again only records the new sources and
+		// owners. The stored manifest is replaced rather than changed, as
+		// readers may still hold it.
+		if existing, exists := f.store.files[manifest.Hash]; exists {
+			merged := *existing
+			merged.Sources = append([]string(nil), existing.Sources...)
+			for _, source := range manifest.Sources {
+				if !containsString(merged.Sources, source) {
+					merged.Sources = append(merged.Sources, source)
+				}
+			}
+			merged.Owners = withoutOwners(existing.Owners, manifest.Owners)
+			merged.Owners = append(merged.Owners, manifest.Owners...)
+
+			f.store.files[manifest.Hash] = &merged
+			return nil
+		}
+
+		f.store.files[manifest.Hash] = &manifest
+		return nil
+
+	case OpDelete:
+		ref, err := decodeRef(cmd.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal ID: %v", err)
+		}
+
+		manifest, exists := f.store.files[ref.ID]
+		if !exists {
+			return fmt.Errorf("file not found: %s", ref.ID)
+		}
+		owner, owned := manifest.Owner(ref.TenantID)
+		if !owned {
+			return fmt.Errorf("file not found: %s", ref.ID)
+		}
+
+		if f.fileReferenced(ref.TenantID, ref.ID) {
+			return fmt.Errorf("file %s is referenced by a print job", ref.ID)
+		}
+
+		f.dropFileOwner(manifest, owner)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown file operation: %s", cmd.Op)
+	}
+}
+
+func (f *FSM) fileReferenced(tenantID, hash string) bool {
+	for _, j := range f.store.printJobs {
+		if j.TenantID == tenantID && j.FileHash == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeOwners gives manifests written before tenants owned files to the
+// default tenant.
+func normalizeOwners(manifest *models.FileManifest) {
+	if len(manifest.Owners) == 0 {
+		manifest.Owners = []models.FileOwner{{
+			TenantID:   models.DefaultTenant,
+			Name:       manifest.Name,
+			UploadedAt: manifest.UploadedAt,
+		}}
+	}
+}
+
+// withoutOwners returns owners minus the tenants listed in removed.
+func withoutOwners(owners, removed []models.FileOwner) []models.FileOwner {
+	kept := make([]models.FileOwner, 0, len(owners))
+	for _, o := range owners {
+		drop := false
+		for _, r := range removed {
+			drop = drop || o.TenantID == r.TenantID
+		}
+		if !drop {
+			kept = append(kept, o)
+		}
+	}
+	return kept
+}
+
+// dropFileOwner removes a tenant's upload of a file, and the manifest with
+// the last one.
+func (f *FSM) dropFileOwner(manifest *models.FileManifest, owner models.FileOwner) {
+	owners := withoutOwners(manifest.Owners, []models.FileOwner{owner})
+	if len(owners) == 0 {
+		delete(f.store.files, manifest.Hash)
+		return
+	}
+
+	updated := *manifest
+	updated.Owners = owners
+	f.store.files[manifest.Hash] = &updated
+}
+
+// dropTenantFiles removes every upload of a deleted tenant.
+func (f *FSM) dropTenantFiles(tenantID string) {
+	for _, m := range f.store.files {
+		if owner, owned := m.Owner(tenantID); owned {
+			f.dropFileOwner(m, owner)
+		}
+	}
+}
+
+// weightTolerance is how far below the weight derived from a G-code file a
+// user supplied print weight may be before the job is rejected.
+const weightTolerance = 0.1
+
+// deriveFromFile fills in the print weight, duration and model dimensions of
+// a job from the analysis of its G-code file, and rejects jobs that claim to
+// need noticeably less filament than the file extrudes.
+func (f *FSM) deriveFromFile(job *models.PrintJob, filament *models.Filament, manifest *models.FileManifest) error {
+	analysis := manifest.Analysis
+	if analysis == nil {
+		if job.PrintWeightInGrams == 0 {
+			return fmt.Errorf("print weight is required: file %s has no G-code analysis", manifest.Hash)
+		}
+		return nil
+	}
+
+	// The analysis does not tell tools apart, so multi-material jobs must
+	// state the weight of every slot themselves.
+	if len(job.Filaments) <= 1 {
+		material, exists := f.store.materials[filament.Type]
+		if !exists {
+			return fmt.Errorf("unknown filament material: %s", filament.Type)
+		}
+
+		derived := analysis.WeightGrams(filament.Diameter(), material.DensityGPerCm3)
+		if job.PrintWeightInGrams == 0 {
+			job.PrintWeightInGrams = int(math.Ceil(derived))
+			if job.PrintWeightInGrams == 0 {
+				return fmt.Errorf("file %s does not extrude any filament", manifest.Hash)
+			}
+		} else if float64(job.PrintWeightInGrams) < derived*(1-weightTolerance) {
+			return fmt.Errorf("print weight %d g is below the %.1f g extruded by file %s",
+				job.PrintWeightInGrams, derived, manifest.Hash)
+		}
+
+		if len(job.Filaments) == 1 {
+			job.Filaments[0].WeightInGrams = job.PrintWeightInGrams
+		}
+	}
+
+	if job.EstimatedDurationSeconds == 0 {
+		job.EstimatedDurationSeconds = int(math.Ceil(analysis.EstimatedSeconds))
+	}
+
+	if job.ModelDimensions == nil && analysis.LayerCount > 0 {
+		size := analysis.Size()
+		job.ModelDimensions = &size
+	}
+
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// GetFiles returns every manifest with all of its owners, for replication.
+func (s *Store) GetFiles() []*models.FileManifest {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	files := make([]*models.FileManifest, 0, len(s.files))
+	for _, m := range s.files {
+		files = append(files, m)
+	}
+
+	return files
+}
+
+func (s *Store) GetFile(hash string) (*models.FileManifest, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	manifest, found := s.files[hash]
+	return manifest, found
+}
+
+// GetTenantFiles returns the files a tenant uploaded, as the tenant sees
+// them.
+func (s *Store) GetTenantFiles(tenantID string) []*models.FileManifest {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	files := make([]*models.FileManifest, 0)
+	for _, m := range s.files {
+		if view, owned := m.ForTenant(tenantID); owned {
+			files = append(files, view)
+		}
+	}
+
+	return files
+}
+
+// GetTenantFile returns a file as the tenant that uploaded it sees it.
+func (s *Store) GetTenantFile(tenantID, hash string) (*models.FileManifest, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	manifest, found := s.files[hash]
+	if !found {
+		return nil, false
+	}
+	return manifest.ForTenant(tenantID)
+}
+
+// GetUnreferencedFiles returns the uploads no print job of the uploading
+// tenant points at, each as that tenant sees the file.
+func (s *Store) GetUnreferencedFiles() []*models.FileManifest {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	referenced := make(map[string]bool)
+	for _, j := range s.printJobs {
+		if j.FileHash != "" {
+			referenced[scopedKey(j.TenantID, j.FileHash)] = true
+		}
+	}
+
+	files := make([]*models.FileManifest, 0)
+	for hash, m := range s.files {
+		for _, o := range m.Owners {
+			if !referenced[scopedKey(o.TenantID, hash)] {
+				view, _ := m.ForTenant(o.TenantID)
+				files = append(files, view)
+			}
+		}
+	}
+
+	return files
+}
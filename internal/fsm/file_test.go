@@ -0,0 +1,117 @@
+package fsm
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raft3d/pkg/models"
+)
+
+var testHash = strings.Repeat("ab", 32)
+
+func upload(tenantID, name, source string, at time.Time) models.FileManifest {
+	return models.FileManifest{
+		Hash: testHash, Name: name, Size: 1024, ContentType: "text/x-gcode",
+		UploadedAt: at, Sources: []string{source},
+		Owners: []models.FileOwner{{TenantID: tenantID, Name: name, UploadedAt: at}},
+	}
+}
+
+func TestFilesAreScopedToTenants(t *testing.T) {
+	tf := newTestFSM(t)
+	tf.mustApply(OpCreate, EntityTenant, models.Tenant{ID: "acme", Name: "Acme"})
+	tf.mustApply(OpCreate, EntityTenant, models.Tenant{ID: "globex", Name: "Globex"})
+	tf.addPrinter("acme", "p1")
+	tf.addPrinter("globex", "p1")
+
+	tf.mustApply(OpCreate, EntityFile, upload("acme", "bracket.gcode", "http://node1", tf.now))
+
+	if files := tf.store.GetTenantFiles("globex"); len(files) != 0 {
+		t.Errorf("globex lists %d files of acme", len(files))
+	}
+	if _, found := tf.store.GetTenantFile("globex", testHash); found {
+		t.Error("globex can read the manifest of acme's upload")
+	}
+
+	j := job("globex", "job1", "p1")
+	j.FileHash = testHash
+	if err := tf.apply(OpCreate, EntityPrintJob, j); err == nil {
+		t.Error("globex queued a job for acme's upload")
+	}
+	if err := tf.apply(OpDelete, EntityFile, EntityRef{TenantID: "globex", ID: testHash}); err == nil {
+		t.Error("globex deleted acme's upload")
+	}
+
+	// The same contents uploaded by globex share the manifest but keep
+	// their own name
+	tf.mustApply(OpCreate, EntityFile, upload("globex", "spacer.gcode", "http://node2", tf.now))
+	view, found := tf.store.GetTenantFile("globex", testHash)
+	if !found || view.Name != "spacer.gcode" || len(view.Owners) != 1 {
+		t.Fatalf("globex sees %+v", view)
+	}
+	tf.mustApply(OpCreate, EntityPrintJob, j)
+
+	tf.mustApply(OpDelete, EntityFile, EntityRef{TenantID: "acme", ID: testHash})
+	if _, found := tf.store.GetTenantFile("acme", testHash); found {
+		t.Error("acme still owns the file after deleting it")
+	}
+	if _, found := tf.store.GetFile(testHash); !found {
+		t.Fatal("deleting acme's upload removed globex's")
+	}
+	if err := tf.apply(OpDelete, EntityFile, EntityRef{TenantID: "globex", ID: testHash}); err == nil {
+		t.Error("globex deleted a file its print job references")
+	}
+}
+
+func TestFileUploadReplacesManifest(t *testing.T) {
+	tf := newTestFSM(t)
+	tf.mustApply(OpCreate, EntityFile, upload(models.DefaultTenant, "part.gcode", "http://node1", tf.now))
+	before, _ := tf.store.GetFile(testHash)
+
+	tf.mustApply(OpCreate, EntityFile, upload(models.DefaultTenant, "part.gcode", "http://node2", tf.now))
+	after, _ := tf.store.GetFile(testHash)
+
+	if len(before.Sources) != 1 {
+		t.Errorf("manifest held by a reader changed to sources %v", before.Sources)
+	}
+	if len(after.Sources) != 2 || len(after.Owners) != 1 {
+		t.Errorf("manifest has sources %v and owners %v, want 2 sources and 1 owner", after.Sources, after.Owners)
+	}
+}
+
+func TestUnreferencedFilesPerOwner(t *testing.T) {
+	tf := newTestFSM(t)
+	tf.mustApply(OpCreate, EntityTenant, models.Tenant{ID: "acme", Name: "Acme"})
+	tf.addPrinter(models.DefaultTenant, "p1")
+
+	old := tf.now.Add(-2 * time.Hour)
+	tf.mustApply(OpCreate, EntityFile, upload(models.DefaultTenant, "part.gcode", "http://node1", old))
+	tf.mustApply(OpCreate, EntityFile, upload("acme", "part.gcode", "http://node1", tf.now))
+
+	j := job("", "job1", "p1")
+	j.FileHash = testHash
+	tf.mustApply(OpCreate, EntityPrintJob, j)
+
+	unreferenced := tf.store.GetUnreferencedFiles()
+	if len(unreferenced) != 1 || unreferenced[0].Owners[0].TenantID != "acme" || !unreferenced[0].UploadedAt.Equal(tf.now) {
+		t.Errorf("unreferenced uploads = %+v, want acme's only", unreferenced)
+	}
+
+	// Dropping the tenant drops its upload as well
+	tf.mustApply(OpDelete, EntityTenant, EntityRef{ID: "acme"})
+	if len(tf.store.GetUnreferencedFiles()) != 0 {
+		t.Error("deleted tenant still owns its upload")
+	}
+}
+
+func TestLegacyManifestsBelongToDefaultTenant(t *testing.T) {
+	tf := newTestFSM(t)
+	legacy := upload(models.DefaultTenant, "old.gcode", "http://node1", tf.now)
+	legacy.Owners = nil
+	tf.mustApply(OpCreate, EntityFile, legacy)
+
+	if _, found := tf.store.GetTenantFile(models.DefaultTenant, testHash); !found {
+		t.Error("legacy upload is not visible to the default tenant")
+	}
+}
@@ -1,25 +1,66 @@
 package fsm
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/raft"
+	"github.com/raft3d/pkg/events"
 	"github.com/raft3d/pkg/models"
+	"github.com/raft3d/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Command struct {
 	Op         string          `json:"op"`
 	EntityType string          `json:"entity_type"`
 	Payload    json.RawMessage `json:"payload"`
+	// Timestamp is stamped by the leader when the command is proposed so
+	// that time dependent state is identical on every node.
+	Timestamp time.Time `json:"timestamp,omitempty"`
+	// RequestID is the ID of the API request that proposed the command, if
+	// any, so that every node's logs can be correlated with it.
+	RequestID string `json:"request_id,omitempty"`
+	// TraceContext carries the W3C trace context of the proposal, so that
+	// every node's apply span joins the trace of the originating request.
+	TraceContext map[string]string `json:"trace_context,omitempty"`
+	// Version is the CommandVersion of the node that proposed the command.
+	Version int `json:"version,omitempty"`
+}
+
+// CommandVersion is stamped on every command this node proposes. Checks
+// added to the FSM only apply to commands of the version that introduced
+// them, so that replaying an older log rebuilds the state it built when its
+// entries were first applied. Commands written before commands carried a
+// version have version 0.
+const CommandVersion = 1
+
+// legacy reports whether cmd was proposed before commands carried a version.
+func legacy(cmd *Command) bool {
+	return cmd.Version < 1
 }
 
 const (
 	EntityPrinter  = "printer"
 	EntityFilament = "filament"
 	EntityPrintJob = "print_job"
+	EntityAPIToken = "api_token"
+	EntityTenant   = "tenant"
+	EntityMaterial = "material"
+	EntityFile     = "file"
+	EntityBatch    = "batch"
+	EntitySpool    = "spool"
+	EntityAlert    = "alert"
+	EntityWebhook  = "webhook"
+	// EntityWebhookDelivery commands record delivery attempts.
+	EntityWebhookDelivery = "webhook_delivery"
 )
 
 const (
@@ -28,9 +69,49 @@ const (
 	OpDelete = "delete"
 )
 
+// OpClearBed records that the last print was taken off a printer's bed.
+const OpClearBed = "clear_bed"
+
 type PrintJobStatusChange struct {
-	ID     string `json:"id"`
-	Status string `json:"status"`
+	ID       string `json:"id"`
+	TenantID string `json:"tenant_id,omitempty"`
+	Status   string `json:"status"`
+}
+
+// EntityRef identifies an entity within a tenant. Delete commands carry an
+// EntityRef; commands written before tenants existed carry a bare ID string.
+type EntityRef struct {
+	TenantID string `json:"tenant_id,omitempty"`
+	ID       string `json:"id"`
+}
+
+func decodeRef(payload json.RawMessage) (EntityRef, error) {
+	var ref EntityRef
+	if err := json.Unmarshal(payload, &ref.ID); err == nil {
+		ref.TenantID = models.DefaultTenant
+		return ref, nil
+	}
+
+	if err := json.Unmarshal(payload, &ref); err != nil {
+		return ref, err
+	}
+	if ref.TenantID == "" {
+		ref.TenantID = models.DefaultTenant
+	}
+	return ref, nil
+}
+
+// scopedKey is the key tenant owned entities are stored under, so that IDs
+// only need to be unique within a tenant. Validation keeps '/' out of IDs,
+// so keys of different tenants cannot collide.
+func scopedKey(tenantID, id string) string {
+	return tenantID + "/" + id
+}
+
+func normalizeTenant(tenantID *string) {
+	if *tenantID == "" {
+		*tenantID = models.DefaultTenant
+	}
 }
 
 type Store struct {
@@ -38,47 +119,163 @@ type Store struct {
 	printers  map[string]*models.Printer
 	filaments map[string]*models.Filament
 	printJobs map[string]*models.PrintJob
+	tokens    map[string]*models.APIToken
+	tenants   map[string]*models.Tenant
+	materials map[string]*models.Material
+	files     map[string]*models.FileManifest
+	batches   map[string]*models.Batch
+	spools    map[string]*models.SpoolLoad
+	alerts    map[string]*models.Alert
+	webhooks  map[string]*models.Webhook
+	// deliveries holds pending webhook deliveries and a log of finished ones.
+	deliveries map[string]*models.WebhookDelivery
+	// lowStock holds the filaments that raised a low stock alert and have
+	// not been refilled above their threshold since.
+	lowStock map[string]bool
+	// usage holds grams of filament consumed per tenant and usage period.
+	usage map[string]map[string]int
+	// sequence numbers print jobs in submission order and served records,
+	// per job owner, the sequence at which they last had a job started.
+	sequence uint64
+	served   map[string]uint64
+	// clusterID identifies the cluster the log belongs to.
+	clusterID string
 }
 
 func NewStore() *Store {
 	return &Store{
-		printers:  make(map[string]*models.Printer),
-		filaments: make(map[string]*models.Filament),
-		printJobs: make(map[string]*models.PrintJob),
+		printers:   make(map[string]*models.Printer),
+		filaments:  make(map[string]*models.Filament),
+		printJobs:  make(map[string]*models.PrintJob),
+		tokens:     make(map[string]*models.APIToken),
+		tenants:    defaultTenants(),
+		materials:  defaultMaterials(),
+		files:      make(map[string]*models.FileManifest),
+		batches:    make(map[string]*models.Batch),
+		spools:     make(map[string]*models.SpoolLoad),
+		alerts:     make(map[string]*models.Alert),
+		webhooks:   make(map[string]*models.Webhook),
+		deliveries: make(map[string]*models.WebhookDelivery),
+		lowStock:   make(map[string]bool),
+		usage:      make(map[string]map[string]int),
+		served:     make(map[string]uint64),
+	}
+}
+
+func defaultTenants() map[string]*models.Tenant {
+	return map[string]*models.Tenant{
+		models.DefaultTenant: {ID: models.DefaultTenant, Name: "Default"},
 	}
 }
 
 type FSM struct {
-	store *Store
+	store  *Store
+	logger *slog.Logger
+
+	publisher Publisher
+	// index and now are the log index and leader timestamp of the command
+	// being applied, and pending the events it produced so far.
+	index   uint64
+	now     time.Time
+	pending []events.Event
 }
 
 func NewFSM() *FSM {
 	return &FSM{
-		store: NewStore(),
+		store:  NewStore(),
+		logger: slog.Default(),
 	}
 }
 
+// SetLogger routes the FSM's logs to logger. It must be called before the
+// FSM is handed to Raft.
+func (f *FSM) SetLogger(logger *slog.Logger) {
+	f.logger = logger
+}
+
 func (f *FSM) Apply(log *raft.Log) interface{} {
 	var cmd Command
 	if err := json.Unmarshal(log.Data, &cmd); err != nil {
+		f.logger.Error("failed to unmarshal command", "index", log.Index, "err", err)
 		return fmt.Errorf("failed to unmarshal command: %v", err)
 	}
 
+	_, span := tracing.Tracer().Start(tracing.Extract(context.Background(), cmd.TraceContext), "fsm.apply",
+		trace.WithAttributes(
+			attribute.Int64("raft.index", int64(log.Index)),
+			attribute.String("raft3d.op", cmd.Op),
+			attribute.String("raft3d.entity", cmd.EntityType),
+		))
+	defer span.End()
+
 	f.store.mu.Lock()
-	defer f.store.mu.Unlock()
+	f.index = log.Index
+	f.now = cmd.Timestamp
+	f.pending = nil
+
+	result := f.apply(&cmd)
+	if result != nil {
+		f.pending = nil
+	} else {
+		f.queueDeliveries()
+	}
+	f.store.mu.Unlock()
 
+	attrs := []any{"index", log.Index, "op", cmd.Op, "entity", cmd.EntityType}
+	if cmd.RequestID != "" {
+		attrs = append(attrs, "request_id", cmd.RequestID)
+	}
+	if err, ok := result.(error); ok {
+		span.SetStatus(codes.Error, err.Error())
+		f.logger.Info("rejected command", append(attrs, "err", err)...)
+	} else {
+		f.logger.Debug("applied command", attrs...)
+	}
+
+	f.publish()
+	return result
+}
+
+func (f *FSM) apply(cmd *Command) interface{} {
 	switch cmd.EntityType {
 	case EntityPrinter:
-		return f.applyPrinterCommand(&cmd)
+		return f.applyPrinterCommand(cmd)
 	case EntityFilament:
-		return f.applyFilamentCommand(&cmd)
+		return f.applyFilamentCommand(cmd)
 	case EntityPrintJob:
-		return f.applyPrintJobCommand(&cmd)
+		return f.applyPrintJobCommand(cmd)
+	case EntityAPIToken:
+		return f.applyAPITokenCommand(cmd)
+	case EntityTenant:
+		return f.applyTenantCommand(cmd)
+	case EntityMaterial:
+		return f.applyMaterialCommand(cmd)
+	case EntityFile:
+		return f.applyFileCommand(cmd)
+	case EntityBatch:
+		return f.applyBatchCommand(cmd)
+	case EntitySpool:
+		return f.applySpoolCommand(cmd)
+	case EntityAlert:
+		return f.applyAlertCommand(cmd)
+	case EntityWebhook:
+		return f.applyWebhookCommand(cmd)
+	case EntityWebhookDelivery:
+		return f.applyDeliveryCommand(cmd)
+	case EntityCluster:
+		return f.applyClusterCommand(cmd)
 	default:
 		return fmt.Errorf("unknown entity type: %s", cmd.EntityType)
 	}
 }
 
+func (f *FSM) requireTenant(tenantID string) error {
+	if _, exists := f.store.tenants[tenantID]; !exists {
+		return fmt.Errorf("tenant not found: %s", tenantID)
+	}
+	return nil
+}
+
 func (f *FSM) applyPrinterCommand(cmd *Command) interface{} {
 	switch cmd.Op {
 	case OpCreate:
@@ -87,11 +284,21 @@ func (f *FSM) applyPrinterCommand(cmd *Command) interface{} {
 			return fmt.Errorf("failed to unmarshal printer: %v", err)
 		}
 
+		normalizeTenant(&printer.TenantID)
 		if err := printer.Validate(); err != nil {
 			return err
 		}
 
-		f.store.printers[printer.ID] = &printer
+		if err := f.requireTenant(printer.TenantID); err != nil {
+			return err
+		}
+
+		if err := f.checkSpoolsFit(&printer); err != nil {
+			return err
+		}
+
+		printer.NeedsClearing = false
+		f.store.printers[scopedKey(printer.TenantID, printer.ID)] = &printer
 		return nil
 
 	case OpUpdate:
@@ -100,28 +307,64 @@ func (f *FSM) applyPrinterCommand(cmd *Command) interface{} {
 			return fmt.Errorf("failed to unmarshal printer: %v", err)
 		}
 
+		normalizeTenant(&printer.TenantID)
 		if err := printer.Validate(); err != nil {
 			return err
 		}
 
-		if _, exists := f.store.printers[printer.ID]; !exists {
+		key := scopedKey(printer.TenantID, printer.ID)
+		existing, exists := f.store.printers[key]
+		if !exists {
 			return fmt.Errorf("printer not found: %s", printer.ID)
 		}
 
-		f.store.printers[printer.ID] = &printer
+		if err := f.checkSpoolsFit(&printer); err != nil {
+			return err
+		}
+
+		printer.NeedsClearing = existing.NeedsClearing
+		f.store.printers[key] = &printer
+		return nil
+
+	case OpClearBed:
+		ref, err := decodeRef(cmd.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal ID: %v", err)
+		}
+
+		printer, exists := f.store.printers[scopedKey(ref.TenantID, ref.ID)]
+		if !exists {
+			return fmt.Errorf("printer not found: %s", ref.ID)
+		}
+
+		if f.hasActiveJob(func(j *models.PrintJob) bool {
+			return j.Status == models.StatusRunning && j.TenantID == ref.TenantID && j.PrinterID == ref.ID
+		}) {
+			return fmt.Errorf("printer %s is printing", ref.ID)
+		}
+
+		printer.NeedsClearing = false
 		return nil
 
 	case OpDelete:
-		var id string
-		if err := json.Unmarshal(cmd.Payload, &id); err != nil {
+		ref, err := decodeRef(cmd.Payload)
+		if err != nil {
 			return fmt.Errorf("failed to unmarshal ID: %v", err)
 		}
 
-		if _, exists := f.store.printers[id]; !exists {
-			return fmt.Errorf("printer not found: %s", id)
+		key := scopedKey(ref.TenantID, ref.ID)
+		if _, exists := f.store.printers[key]; !exists {
+			return fmt.Errorf("printer not found: %s", ref.ID)
+		}
+
+		if f.hasActiveJob(func(j *models.PrintJob) bool {
+			return j.TenantID == ref.TenantID && j.PrinterID == ref.ID
+		}) {
+			return fmt.Errorf("printer %s has queued or running print jobs", ref.ID)
 		}
 
-		delete(f.store.printers, id)
+		f.unloadPrinter(ref.TenantID, ref.ID)
+		delete(f.store.printers, key)
 		return nil
 
 	default:
@@ -137,11 +380,22 @@ func (f *FSM) applyFilamentCommand(cmd *Command) interface{} {
 			return fmt.Errorf("failed to unmarshal filament: %v", err)
 		}
 
+		normalizeTenant(&filament.TenantID)
 		if err := filament.Validate(); err != nil {
 			return err
 		}
 
-		f.store.filaments[filament.ID] = &filament
+		if err := f.requireMaterial(filament.Type); err != nil {
+			return err
+		}
+
+		if err := f.requireTenant(filament.TenantID); err != nil {
+			return err
+		}
+
+		f.store.filaments[scopedKey(filament.TenantID, filament.ID)] = &filament
+		f.emit(events.TypeFilamentUpdated, filament.TenantID, &filament)
+		f.checkLowStock(&filament)
 		return nil
 
 	case OpUpdate:
@@ -150,28 +404,48 @@ func (f *FSM) applyFilamentCommand(cmd *Command) interface{} {
 			return fmt.Errorf("failed to unmarshal filament: %v", err)
 		}
 
+		normalizeTenant(&filament.TenantID)
 		if err := filament.Validate(); err != nil {
 			return err
 		}
 
-		if _, exists := f.store.filaments[filament.ID]; !exists {
+		if err := f.requireMaterial(filament.Type); err != nil {
+			return err
+		}
+
+		key := scopedKey(filament.TenantID, filament.ID)
+		if _, exists := f.store.filaments[key]; !exists {
 			return fmt.Errorf("filament not found: %s", filament.ID)
 		}
 
-		f.store.filaments[filament.ID] = &filament
+		f.store.filaments[key] = &filament
+		f.emit(events.TypeFilamentUpdated, filament.TenantID, &filament)
+		f.checkLowStock(&filament)
 		return nil
 
 	case OpDelete:
-		var id string
-		if err := json.Unmarshal(cmd.Payload, &id); err != nil {
+		ref, err := decodeRef(cmd.Payload)
+		if err != nil {
 			return fmt.Errorf("failed to unmarshal ID: %v", err)
 		}
 
-		if _, exists := f.store.filaments[id]; !exists {
-			return fmt.Errorf("filament not found: %s", id)
+		key := scopedKey(ref.TenantID, ref.ID)
+		if _, exists := f.store.filaments[key]; !exists {
+			return fmt.Errorf("filament not found: %s", ref.ID)
+		}
+
+		if f.hasActiveJob(func(j *models.PrintJob) bool {
+			return j.TenantID == ref.TenantID && j.UsesFilament(ref.ID)
+		}) {
+			return fmt.Errorf("filament %s has queued or running print jobs", ref.ID)
+		}
+
+		if l, loaded := f.spoolLoaded(ref.TenantID, ref.ID); loaded {
+			return fmt.Errorf("filament %s is loaded on printer %s; unload it first", ref.ID, l.PrinterID)
 		}
 
-		delete(f.store.filaments, id)
+		delete(f.store.filaments, key)
+		delete(f.store.lowStock, key)
 		return nil
 
 	default:
@@ -188,26 +462,86 @@ func (f *FSM) applyPrintJobCommand(cmd *Command) interface{} {
 		}
 
 		printJob.Status = models.StatusQueued
+		normalizeTenant(&printJob.TenantID)
+		if printJob.Priority == "" {
+			printJob.Priority = models.PriorityNormal
+		}
+		printJob.NormalizeFilaments()
 
 		if err := printJob.Validate(); err != nil {
 			return err
 		}
 
-		if _, exists := f.store.printers[printJob.PrinterID]; !exists {
+		printer, exists := f.store.printers[scopedKey(printJob.TenantID, printJob.PrinterID)]
+		if !exists {
 			return fmt.Errorf("printer not found: %s", printJob.PrinterID)
 		}
 
-		filament, exists := f.store.filaments[printJob.FilamentID]
-		if !exists {
-			return fmt.Errorf("filament not found: %s", printJob.FilamentID)
+		filaments := make([]*models.Filament, len(printJob.Filaments))
+		for i, slot := range printJob.Filaments {
+			filament, exists := f.store.filaments[scopedKey(printJob.TenantID, slot.FilamentID)]
+			if !exists {
+				return fmt.Errorf("filament not found: %s", slot.FilamentID)
+			}
+			filaments[i] = filament
+		}
+
+		if printJob.BatchID != "" {
+			if _, exists := f.store.batches[scopedKey(printJob.TenantID, printJob.BatchID)]; !exists {
+				return fmt.Errorf("batch not found: %s", printJob.BatchID)
+			}
+		}
+
+		if err := f.checkDependencies(printJob.TenantID, printJob.ID, printJob.DependsOn); err != nil {
+			return err
 		}
 
-		if printJob.PrintWeightInGrams > filament.RemainingWeightInGrams {
-			return fmt.Errorf("insufficient filament: required %d g, available %d g",
-				printJob.PrintWeightInGrams, filament.RemainingWeightInGrams)
+		if printJob.FileHash != "" {
+			// Tenants may only print files they uploaded themselves
+			manifest, exists := f.store.files[printJob.FileHash]
+			if !exists {
+				return fmt.Errorf("file not found: %s", printJob.FileHash)
+			}
+			if _, owned := manifest.Owner(printJob.TenantID); !owned {
+				return fmt.Errorf("file not found: %s", printJob.FileHash)
+			}
+
+			if err := f.deriveFromFile(&printJob, filaments[0], manifest); err != nil {
+				return err
+			}
 		}
 
-		f.store.printJobs[printJob.ID] = &printJob
+		if legacy(cmd) {
+			// Jobs were only checked against their filament's remaining
+			// weight when these commands were written
+			if printJob.PrintWeightInGrams > filaments[0].RemainingWeightInGrams {
+				return fmt.Errorf("insufficient filament: required %d g, available %d g",
+					printJob.PrintWeightInGrams, filaments[0].RemainingWeightInGrams)
+			}
+		} else {
+			if err := f.checkCompatibility(printer, filaments, &printJob); err != nil {
+				return err
+			}
+
+			if err := f.checkFilamentReserves(&printJob, filaments); err != nil {
+				return err
+			}
+
+			if err := checkSpoolsLoaded(f.store.spools, &printJob); err != nil {
+				return err
+			}
+
+			if err := f.checkQuota(&printJob, cmd.Timestamp); err != nil {
+				return err
+			}
+		}
+
+		f.store.sequence++
+		printJob.Sequence = f.store.sequence
+		printJob.SubmittedAt = cmd.Timestamp
+
+		f.store.printJobs[scopedKey(printJob.TenantID, printJob.ID)] = &printJob
+		f.emit(events.TypePrintJobCreated, printJob.TenantID, &printJob)
 		return nil
 
 	case OpUpdate:
@@ -216,7 +550,8 @@ func (f *FSM) applyPrintJobCommand(cmd *Command) interface{} {
 			return fmt.Errorf("failed to unmarshal status change: %v", err)
 		}
 
-		printJob, exists := f.store.printJobs[statusChange.ID]
+		normalizeTenant(&statusChange.TenantID)
+		printJob, exists := f.store.printJobs[scopedKey(statusChange.TenantID, statusChange.ID)]
 		if !exists {
 			return fmt.Errorf("print job not found: %s", statusChange.ID)
 		}
@@ -225,39 +560,231 @@ func (f *FSM) applyPrintJobCommand(cmd *Command) interface{} {
 			return err
 		}
 
+		if statusChange.Status == models.StatusRunning {
+			if pending := blockedBy(f.store.printJobs, printJob); len(pending) > 0 {
+				return fmt.Errorf("print job %s is waiting for %v", printJob.ID, pending)
+			}
+
+			if !legacy(cmd) {
+				if err := checkSpoolsLoaded(f.store.spools, printJob); err != nil {
+					return err
+				}
+
+				if err := f.checkPrinterFree(printJob); err != nil {
+					return err
+				}
+			}
+		}
+
 		if statusChange.Status == models.StatusDone {
-			filament, exists := f.store.filaments[printJob.FilamentID]
-			if !exists {
-				return fmt.Errorf("filament not found: %s", printJob.FilamentID)
+			slots := printJob.Slots()
+			filaments := make([]*models.Filament, len(slots))
+			for i, slot := range slots {
+				filament, exists := f.store.filaments[scopedKey(printJob.TenantID, slot.FilamentID)]
+				if !exists {
+					return fmt.Errorf("filament not found: %s", slot.FilamentID)
+				}
+				filaments[i] = filament
+			}
+
+			for i, filament := range filaments {
+				filament.RemainingWeightInGrams -= slots[i].WeightInGrams
+				if filament.RemainingWeightInGrams < 0 {
+					filament.RemainingWeightInGrams = 0
+				}
+				f.emit(events.TypeFilamentUpdated, filament.TenantID, filament)
+				f.checkLowStock(filament)
 			}
 
-			filament.RemainingWeightInGrams -= printJob.PrintWeightInGrams
-			if filament.RemainingWeightInGrams < 0 {
-				filament.RemainingWeightInGrams = 0
+			f.recordUsage(printJob.TenantID, cmd.Timestamp, printJob.PrintWeightInGrams)
+		}
+
+		if statusChange.Status == models.StatusRunning {
+			f.store.sequence++
+			f.store.served[ownerKey(printJob)] = f.store.sequence
+			printJob.StartedAt = cmd.Timestamp
+		}
+
+		if printJob.Status == models.StatusRunning {
+			// The print, or what was printed of it, is on the bed now
+			if printer, exists := f.store.printers[scopedKey(printJob.TenantID, printJob.PrinterID)]; exists {
+				printer.NeedsClearing = true
 			}
 		}
 
 		printJob.Status = statusChange.Status
+		f.emit(events.TypePrintJobStatusChanged, printJob.TenantID, printJob)
+		if printJob.Status == models.StatusCancelled {
+			f.cancelDependents(printJob.TenantID, printJob.ID)
+		}
 		return nil
 
 	case OpDelete:
-		var id string
-		if err := json.Unmarshal(cmd.Payload, &id); err != nil {
+		ref, err := decodeRef(cmd.Payload)
+		if err != nil {
 			return fmt.Errorf("failed to unmarshal ID: %v", err)
 		}
 
-		if _, exists := f.store.printJobs[id]; !exists {
-			return fmt.Errorf("print job not found: %s", id)
+		key := scopedKey(ref.TenantID, ref.ID)
+		if _, exists := f.store.printJobs[key]; !exists {
+			return fmt.Errorf("print job not found: %s", ref.ID)
 		}
 
-		delete(f.store.printJobs, id)
+		if f.hasDependents(ref.TenantID, ref.ID) {
+			return fmt.Errorf("other print jobs depend on print job %s", ref.ID)
+		}
+
+		delete(f.store.printJobs, key)
 		return nil
 
+	case OpAddDependency, OpRemoveDependency:
+		return f.applyDependencyCommand(cmd)
+
 	default:
 		return fmt.Errorf("unknown print job operation: %s", cmd.Op)
 	}
 }
 
+// checkCompatibility rejects jobs the printer cannot physically print, based
+// on its capabilities and the materials of the filaments.
+func (f *FSM) checkCompatibility(printer *models.Printer, filaments []*models.Filament, job *models.PrintJob) error {
+	caps := printer.Capabilities
+	if caps == nil {
+		return nil
+	}
+
+	if len(job.Filaments) > caps.Units() {
+		return fmt.Errorf("printer %s can feed %d filaments, job %s uses %d",
+			printer.ID, caps.Units(), job.ID, len(job.Filaments))
+	}
+
+	for i, slot := range job.Filaments {
+		if slot.Slot >= caps.Units() {
+			return fmt.Errorf("printer %s has no filament slot %d", printer.ID, slot.Slot)
+		}
+
+		filament := filaments[i]
+		if material, exists := f.store.materials[filament.Type]; exists {
+			if err := caps.CheckMaterial(material); err != nil {
+				return fmt.Errorf("printer %s cannot print filament %s: %v", printer.ID, filament.ID, err)
+			}
+		}
+	}
+
+	if job.ModelDimensions != nil {
+		if err := caps.CheckDimensions(job.ModelDimensions); err != nil {
+			return fmt.Errorf("printer %s cannot print job %s: %v", printer.ID, job.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// checkFilamentReserves rejects a job if any of its filaments does not have
+// enough left once the weight reserved by other queued and running jobs is
+// set aside.
+func (f *FSM) checkFilamentReserves(job *models.PrintJob, filaments []*models.Filament) error {
+	key := scopedKey(job.TenantID, job.ID)
+
+	for i, slot := range job.Filaments {
+		filament := filaments[i]
+
+		reserved := 0
+		for k, j := range f.store.printJobs {
+			if k == key || j.TenantID != job.TenantID ||
+				(j.Status != models.StatusQueued && j.Status != models.StatusRunning) {
+				continue
+			}
+			for _, other := range j.Slots() {
+				if other.FilamentID == filament.ID {
+					reserved += other.WeightInGrams
+				}
+			}
+		}
+
+		available := filament.RemainingWeightInGrams - reserved
+		if slot.WeightInGrams > available {
+			return fmt.Errorf("insufficient filament %s: required %d g, available %d g (%d g reserved by other jobs)",
+				filament.ID, slot.WeightInGrams, available, reserved)
+		}
+	}
+
+	return nil
+}
+
+// checkPrinterFree rejects starting a job on a printer that is printing
+// another job or whose bed has not been cleared since its last print.
+func (f *FSM) checkPrinterFree(job *models.PrintJob) error {
+	printer, exists := f.store.printers[scopedKey(job.TenantID, job.PrinterID)]
+	if !exists {
+		return fmt.Errorf("printer not found: %s", job.PrinterID)
+	}
+
+	for _, j := range f.store.printJobs {
+		if j.Status == models.StatusRunning && j.TenantID == job.TenantID && j.PrinterID == job.PrinterID {
+			return fmt.Errorf("printer %s is printing job %s", job.PrinterID, j.ID)
+		}
+	}
+
+	if printer.NeedsClearing {
+		return fmt.Errorf("the bed of printer %s has not been cleared since its last print", job.PrinterID)
+	}
+	return nil
+}
+
+// hasActiveJob reports whether any queued or running print job matches.
+func (f *FSM) hasActiveJob(match func(*models.PrintJob) bool) bool {
+	for _, j := range f.store.printJobs {
+		if (j.Status == models.StatusQueued || j.Status == models.StatusRunning) && match(j) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *FSM) applyAPITokenCommand(cmd *Command) interface{} {
+	switch cmd.Op {
+	case OpCreate:
+		var token models.APIToken
+		if err := json.Unmarshal(cmd.Payload, &token); err != nil {
+			return fmt.Errorf("failed to unmarshal API token: %v", err)
+		}
+
+		if err := token.Validate(); err != nil {
+			return err
+		}
+
+		if token.TenantID != "" {
+			if err := f.requireTenant(token.TenantID); err != nil {
+				return err
+			}
+		}
+
+		if _, exists := f.store.tokens[token.ID]; exists {
+			return fmt.Errorf("API token already exists: %s", token.ID)
+		}
+
+		f.store.tokens[token.ID] = &token
+		return nil
+
+	case OpDelete:
+		ref, err := decodeRef(cmd.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal ID: %v", err)
+		}
+
+		if _, exists := f.store.tokens[ref.ID]; !exists {
+			return fmt.Errorf("API token not found: %s", ref.ID)
+		}
+
+		delete(f.store.tokens, ref.ID)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown API token operation: %s", cmd.Op)
+	}
+}
+
 func (f *FSM) Snapshot() (raft.FSMSnapshot, error) {
 	f.store.mu.RLock()
 	defer f.store.mu.RUnlock()
@@ -277,13 +804,104 @@ func (f *FSM) Snapshot() (raft.FSMSnapshot, error) {
 	printJobs := make(map[string]*models.PrintJob)
 	for k, v := range f.store.printJobs {
 		printJob := *v
+		printJob.DependsOn = append([]string(nil), v.DependsOn...)
+		printJob.Filaments = append([]models.FilamentSlot(nil), v.Filaments...)
 		printJobs[k] = &printJob
 	}
 
+	tokens := make(map[string]*models.APIToken)
+	for k, v := range f.store.tokens {
+		token := *v
+		tokens[k] = &token
+	}
+
+	tenants := make(map[string]*models.Tenant)
+	for k, v := range f.store.tenants {
+		tenant := *v
+		tenants[k] = &tenant
+	}
+
+	materials := make(map[string]*models.Material)
+	for k, v := range f.store.materials {
+		material := *v
+		materials[k] = &material
+	}
+
+	files := make(map[string]*models.FileManifest)
+	for k, v := range f.store.files {
+		manifest := *v
+		manifest.Sources = append([]string(nil), v.Sources...)
+		manifest.Owners = append([]models.FileOwner(nil), v.Owners...)
+		files[k] = &manifest
+	}
+
+	batches := make(map[string]*models.Batch)
+	for k, v := range f.store.batches {
+		batch := *v
+		batches[k] = &batch
+	}
+
+	alerts := make(map[string]*models.Alert)
+	for k, v := range f.store.alerts {
+		alert := *v
+		alerts[k] = &alert
+	}
+
+	webhooks := make(map[string]*models.Webhook)
+	for k, v := range f.store.webhooks {
+		webhook := *v
+		webhook.EventTypes = append([]string(nil), v.EventTypes...)
+		webhooks[k] = &webhook
+	}
+
+	deliveries := make(map[string]*models.WebhookDelivery)
+	for k, v := range f.store.deliveries {
+		delivery := *v
+		deliveries[k] = &delivery
+	}
+
+	lowStock := make(map[string]bool)
+	for k, v := range f.store.lowStock {
+		lowStock[k] = v
+	}
+
+	spools := make(map[string]*models.SpoolLoad)
+	for k, v := range f.store.spools {
+		load := *v
+		spools[k] = &load
+	}
+
+	usage := make(map[string]map[string]int)
+	for tenantID, periods := range f.store.usage {
+		usage[tenantID] = make(map[string]int)
+		for period, grams := range periods {
+			usage[tenantID][period] = grams
+		}
+	}
+
+	served := make(map[string]uint64)
+	for owner, seq := range f.store.served {
+		served[owner] = seq
+	}
+
 	return &Snapshot{
-		Printers:  printers,
-		Filaments: filaments,
-		PrintJobs: printJobs,
+		Printers:    printers,
+		Filaments:   filaments,
+		PrintJobs:   printJobs,
+		Tokens:      tokens,
+		Tenants:     tenants,
+		Materials:   materials,
+		Files:       files,
+		Batches:     batches,
+		Spools:      spools,
+		Alerts:      alerts,
+		LowStock:    lowStock,
+		Webhooks:    webhooks,
+		Deliveries:  deliveries,
+		Usage:       usage,
+		JobSequence: f.store.sequence,
+		Served:      served,
+		ClusterID:   f.store.clusterID,
 	}, nil
 }
 
@@ -299,9 +917,93 @@ func (f *FSM) Restore(rc io.ReadCloser) error {
 	f.store.mu.Lock()
 	defer f.store.mu.Unlock()
 
-	f.store.printers = snapshot.Printers
-	f.store.filaments = snapshot.Filaments
-	f.store.printJobs = snapshot.PrintJobs
+	// Snapshots taken before tenants existed are keyed by bare ID; rekey
+	// everything so such entities land in the default tenant.
+	f.store.printers = make(map[string]*models.Printer)
+	for _, p := range snapshot.Printers {
+		normalizeTenant(&p.TenantID)
+		f.store.printers[scopedKey(p.TenantID, p.ID)] = p
+	}
+
+	f.store.filaments = make(map[string]*models.Filament)
+	for _, fl := range snapshot.Filaments {
+		normalizeTenant(&fl.TenantID)
+		f.store.filaments[scopedKey(fl.TenantID, fl.ID)] = fl
+	}
+
+	f.store.printJobs = make(map[string]*models.PrintJob)
+	for _, j := range snapshot.PrintJobs {
+		normalizeTenant(&j.TenantID)
+		f.store.printJobs[scopedKey(j.TenantID, j.ID)] = j
+	}
+
+	f.store.tokens = snapshot.Tokens
+	if f.store.tokens == nil {
+		f.store.tokens = make(map[string]*models.APIToken)
+	}
+
+	f.store.tenants = snapshot.Tenants
+	if f.store.tenants == nil {
+		f.store.tenants = defaultTenants()
+	}
+
+	f.store.materials = snapshot.Materials
+	if f.store.materials == nil {
+		f.store.materials = defaultMaterials()
+	}
+
+	f.store.files = snapshot.Files
+	if f.store.files == nil {
+		f.store.files = make(map[string]*models.FileManifest)
+	}
+	for _, m := range f.store.files {
+		normalizeOwners(m)
+	}
+
+	f.store.batches = snapshot.Batches
+	if f.store.batches == nil {
+		f.store.batches = make(map[string]*models.Batch)
+	}
+
+	f.store.spools = snapshot.Spools
+	if f.store.spools == nil {
+		f.store.spools = make(map[string]*models.SpoolLoad)
+	}
+
+	f.store.alerts = snapshot.Alerts
+	if f.store.alerts == nil {
+		f.store.alerts = make(map[string]*models.Alert)
+	}
+
+	f.store.lowStock = snapshot.LowStock
+	if f.store.lowStock == nil {
+		f.store.lowStock = make(map[string]bool)
+	}
+
+	f.store.webhooks = snapshot.Webhooks
+	if f.store.webhooks == nil {
+		f.store.webhooks = make(map[string]*models.Webhook)
+	}
+
+	f.store.deliveries = snapshot.Deliveries
+	if f.store.deliveries == nil {
+		f.store.deliveries = make(map[string]*models.WebhookDelivery)
+	}
+
+	f.store.usage = snapshot.Usage
+	if f.store.usage == nil {
+		f.store.usage = make(map[string]map[string]int)
+	}
+
+	f.store.sequence = snapshot.JobSequence
+	restoreSequences(f.store)
+
+	f.store.served = snapshot.Served
+	if f.store.served == nil {
+		f.store.served = make(map[string]uint64)
+	}
+
+	f.store.clusterID = snapshot.ClusterID
 
 	return nil
 }
@@ -310,6 +1012,22 @@ type Snapshot struct {
 	Printers  map[string]*models.Printer
 	Filaments map[string]*models.Filament
 	PrintJobs map[string]*models.PrintJob
+	Tokens    map[string]*models.APIToken
+	Tenants   map[string]*models.Tenant
+	Materials map[string]*models.Material
+	Files     map[string]*models.FileManifest
+	Batches   map[string]*models.Batch
+	Spools    map[string]*models.SpoolLoad
+	Alerts    map[string]*models.Alert
+	LowStock  map[string]bool
+	Webhooks  map[string]*models.Webhook
+	Usage     map[string]map[string]int
+
+	Deliveries map[string]*models.WebhookDelivery
+
+	JobSequence uint64
+	Served      map[string]uint64
+	ClusterID   string
 }
 
 func (s *Snapshot) Persist(sink raft.SnapshotSink) error {
@@ -329,66 +1047,126 @@ func (s *Snapshot) Persist(sink raft.SnapshotSink) error {
 
 func (s *Snapshot) Release() {}
 
-func (s *Store) GetPrinters() []*models.Printer {
+func (s *Store) GetPrinters(tenantID string) []*models.Printer {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	printers := make([]*models.Printer, 0, len(s.printers))
+	printers := make([]*models.Printer, 0)
 	for _, p := range s.printers {
-		printers = append(printers, p)
+		if p.TenantID == tenantID {
+			printers = append(printers, p)
+		}
 	}
 
 	return printers
 }
 
-func (s *Store) GetPrinter(id string) (*models.Printer, bool) {
+func (s *Store) GetPrinter(tenantID, id string) (*models.Printer, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	printer, found := s.printers[id]
+	printer, found := s.printers[scopedKey(tenantID, id)]
 	return printer, found
 }
 
-func (s *Store) GetFilaments() []*models.Filament {
+// GetAllPrinters returns the printers of every tenant.
+func (s *Store) GetAllPrinters() []*models.Printer {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	filaments := make([]*models.Filament, 0, len(s.filaments))
+	printers := make([]*models.Printer, 0, len(s.printers))
+	for _, p := range s.printers {
+		printers = append(printers, p)
+	}
+
+	return printers
+}
+
+func (s *Store) GetFilaments(tenantID string) []*models.Filament {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	filaments := make([]*models.Filament, 0)
 	for _, f := range s.filaments {
-		filaments = append(filaments, f)
+		if f.TenantID == tenantID {
+			filaments = append(filaments, f)
+		}
 	}
 
 	return filaments
 }
 
-func (s *Store) GetFilament(id string) (*models.Filament, bool) {
+func (s *Store) GetFilament(tenantID, id string) (*models.Filament, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	filament, found := s.filaments[id]
+	filament, found := s.filaments[scopedKey(tenantID, id)]
 	return filament, found
 }
 
-func (s *Store) GetPrintJobs() []*models.PrintJob {
+func (s *Store) GetPrintJobs(tenantID string) []*models.PrintJob {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	printJobs := make([]*models.PrintJob, 0)
+	for _, j := range s.printJobs {
+		if j.TenantID == tenantID {
+			printJobs = append(printJobs, j)
+		}
+	}
+
+	return printJobs
+}
+
+// GetPrinterJobs returns copies of the print jobs assigned to a printer.
+func (s *Store) GetPrinterJobs(tenantID, printerID string) []models.PrintJob {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	printJobs := make([]*models.PrintJob, 0, len(s.printJobs))
+	printJobs := make([]models.PrintJob, 0)
 	for _, j := range s.printJobs {
-		printJobs = append(printJobs, j)
+		if j.TenantID == tenantID && j.PrinterID == printerID {
+			printJobs = append(printJobs, *j)
+		}
 	}
 
 	return printJobs
 }
 
-func (s *Store) GetPrintJob(id string) (*models.PrintJob, bool) {
+func (s *Store) GetPrintJob(tenantID, id string) (*models.PrintJob, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	printJob, found := s.printJobs[id]
+	printJob, found := s.printJobs[scopedKey(tenantID, id)]
 	return printJob, found
 }
 
+func (s *Store) GetTokens() []*models.APIToken {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tokens := make([]*models.APIToken, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		tokens = append(tokens, t)
+	}
+
+	return tokens
+}
+
+// GetTokenByHash looks up the API token whose hash matches tokenHash.
+func (s *Store) GetTokenByHash(tokenHash string) (*models.APIToken, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, t := range s.tokens {
+		if t.TokenHash == tokenHash {
+			return t, true
+		}
+	}
+
+	return nil, false
+}
+
 func (f *FSM) Store() *Store {
 	return f.store
 }
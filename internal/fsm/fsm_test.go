@@ -0,0 +1,195 @@
+package fsm
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/raft3d/pkg/models"
+)
+
+// testFSM applies commands the way Raft would, with increasing log indexes
+// and a leader timestamp the test controls.
+type testFSM struct {
+	*FSM
+	t     *testing.T
+	index uint64
+	now   time.Time
+}
+
+func newTestFSM(t *testing.T) *testFSM {
+	f := NewFSM()
+	f.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return &testFSM{FSM: f, t: t, now: time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)}
+}
+
+func (tf *testFSM) apply(op, entityType string, payload interface{}) error {
+	tf.t.Helper()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		tf.t.Fatal(err)
+	}
+	cmd, err := json.Marshal(Command{Op: op, EntityType: entityType, Payload: data, Timestamp: tf.now, Version: CommandVersion})
+	if err != nil {
+		tf.t.Fatal(err)
+	}
+
+	tf.index++
+	if err, ok := tf.Apply(&raft.Log{Index: tf.index, Data: cmd}).(error); ok {
+		return err
+	}
+	return nil
+}
+
+func (tf *testFSM) mustApply(op, entityType string, payload interface{}) {
+	tf.t.Helper()
+	if err := tf.apply(op, entityType, payload); err != nil {
+		tf.t.Fatalf("%s %s: %v", op, entityType, err)
+	}
+}
+
+// addPrinter creates a printer with a PLA filament of its own loaded in
+// slot 0, so that jobs can be queued for it.
+func (tf *testFSM) addPrinter(tenantID, id string) {
+	tf.t.Helper()
+	tf.mustApply(OpCreate, EntityPrinter, models.Printer{ID: id, TenantID: tenantID, Company: "Prusa", Model: "MK4"})
+	tf.mustApply(OpCreate, EntityFilament, models.Filament{
+		ID: id + "-pla", TenantID: tenantID, Type: "PLA", Color: "black",
+		TotalWeightInGrams: 10000, RemainingWeightInGrams: 10000,
+	})
+	tf.mustApply(OpLoad, EntitySpool, models.SpoolLoad{TenantID: tenantID, PrinterID: id, FilamentID: id + "-pla"})
+}
+
+// job returns a queued job for a printer created by addPrinter.
+func job(tenantID, id, printerID string) models.PrintJob {
+	return models.PrintJob{
+		ID: id, TenantID: tenantID, PrinterID: printerID, FilamentID: printerID + "-pla",
+		Filepath: id + ".gcode", PrintWeightInGrams: 10,
+	}
+}
+
+func (tf *testFSM) setStatus(tenantID, id, status string) error {
+	tf.t.Helper()
+	return tf.apply(OpUpdate, EntityPrintJob, PrintJobStatusChange{ID: id, TenantID: tenantID, Status: status})
+}
+
+func (tf *testFSM) status(tenantID, id string) string {
+	tf.t.Helper()
+	j, found := tf.store.GetPrintJob(tenantID, id)
+	if !found {
+		tf.t.Fatalf("print job %s not found", id)
+	}
+	return j.Status
+}
+
+func TestPrinterUpdateKeepsLoadedSlots(t *testing.T) {
+	tf := newTestFSM(t)
+	caps := func(units int) *models.PrinterCapabilities {
+		return &models.PrinterCapabilities{
+			BuildVolume:      models.Dimensions{X: 250, Y: 210, Z: 220},
+			NozzleDiameterMM: 0.4, NozzleMaterial: models.NozzleBrass, Extruder: models.ExtruderDirect,
+			MaxNozzleTempC: 290, MaxBedTempC: 120, MaterialUnits: units,
+		}
+	}
+
+	printer := models.Printer{ID: "p1", Company: "Bambu", Model: "X1C", Capabilities: caps(4)}
+	tf.mustApply(OpCreate, EntityPrinter, printer)
+	tf.mustApply(OpCreate, EntityFilament, models.Filament{
+		ID: "f1", Type: "PLA", Color: "red", TotalWeightInGrams: 1000, RemainingWeightInGrams: 1000,
+	})
+	tf.mustApply(OpLoad, EntitySpool, models.SpoolLoad{PrinterID: "p1", Slot: 3, FilamentID: "f1"})
+
+	printer.Capabilities = caps(2)
+	for _, op := range []string{OpUpdate, OpCreate} {
+		if err := tf.apply(op, EntityPrinter, printer); err == nil {
+			t.Errorf("%s dropped slot 3 while it holds a spool", op)
+		}
+	}
+	if p, _ := tf.store.GetPrinter(models.DefaultTenant, "p1"); p.Capabilities.Units() != 4 {
+		t.Errorf("rejected update changed the printer to %d units", p.Capabilities.Units())
+	}
+
+	tf.mustApply(OpUnload, EntitySpool, SpoolSlotRef{PrinterID: "p1", Slot: 3})
+	tf.mustApply(OpUpdate, EntityPrinter, printer)
+}
+
+func TestLegacyJobsAreReplayed(t *testing.T) {
+	tf := newTestFSM(t)
+
+	// Entries as nodes wrote them before commands carried a version: the
+	// job was accepted without its filament loaded on the printer
+	entries := []string{
+		`{"op": "create", "entity_type": "printer", "payload": {"id": "p1", "company": "Prusa", "model": "MK3"}}`,
+		`{"op": "create", "entity_type": "filament", "payload": {"id": "f1", "type": "PLA", "color": "red", "total_weight_in_grams": 1000, "remaining_weight_in_grams": 1000}}`,
+		`{"op": "create", "entity_type": "print_job", "payload": {"id": "j1", "printer_id": "p1", "filament_id": "f1", "filepath": "/prints/benchy.gcode", "print_weight_in_grams": 20}}`,
+		`{"op": "update", "entity_type": "print_job", "payload": {"id": "j1", "status": "Running"}}`,
+	}
+	for _, entry := range entries {
+		tf.index++
+		if err, ok := tf.Apply(&raft.Log{Index: tf.index, Data: []byte(entry)}).(error); ok {
+			t.Fatalf("replaying %s: %v", entry, err)
+		}
+	}
+	if got := tf.status(models.DefaultTenant, "j1"); got != models.StatusRunning {
+		t.Errorf("replayed job is %s, want Running", got)
+	}
+
+	// The same job proposed now needs its filament loaded
+	j := models.PrintJob{ID: "j2", PrinterID: "p1", FilamentID: "f1", Filepath: "/prints/benchy.gcode", PrintWeightInGrams: 20}
+	if err := tf.apply(OpCreate, EntityPrintJob, j); err == nil {
+		t.Error("a new job was accepted without its filament loaded")
+	}
+
+	// Old entries still get the checks they were written under
+	tf.index++
+	old := `{"op": "create", "entity_type": "print_job", "payload": {"id": "j3", "printer_id": "p1", "filament_id": "f1", "filepath": "/prints/big.gcode", "print_weight_in_grams": 2000}}`
+	if _, ok := tf.Apply(&raft.Log{Index: tf.index, Data: []byte(old)}).(error); !ok {
+		t.Error("an old job needing more filament than is left was accepted")
+	}
+}
+
+func TestOnePrintAtATimePerPrinter(t *testing.T) {
+	tf := newTestFSM(t)
+	tf.addPrinter("", "p1")
+	tf.mustApply(OpCreate, EntityPrintJob, job("", "j1", "p1"))
+	tf.mustApply(OpCreate, EntityPrintJob, job("", "j2", "p1"))
+	clear := func() error {
+		return tf.apply(OpClearBed, EntityPrinter, EntityRef{ID: "p1"})
+	}
+
+	if err := tf.setStatus("", "j1", models.StatusRunning); err != nil {
+		t.Fatal(err)
+	}
+	if j, _ := tf.store.GetPrintJob(models.DefaultTenant, "j1"); !j.StartedAt.Equal(tf.now) {
+		t.Errorf("started at %v, want the leader's time %v", j.StartedAt, tf.now)
+	}
+	if err := tf.setStatus("", "j2", models.StatusRunning); err == nil {
+		t.Fatal("a second job started on a printing printer")
+	}
+	if err := clear(); err == nil {
+		t.Error("the bed of a printing printer was cleared")
+	}
+
+	if err := tf.setStatus("", "j1", models.StatusDone); err != nil {
+		t.Fatal(err)
+	}
+	if err := tf.setStatus("", "j2", models.StatusRunning); err == nil {
+		t.Fatal("a job started on top of the last print")
+	}
+
+	// Updates to the printer do not clear its bed
+	tf.mustApply(OpUpdate, EntityPrinter, models.Printer{ID: "p1", Company: "Prusa", Model: "MK4S"})
+	if p, _ := tf.store.GetPrinter(models.DefaultTenant, "p1"); !p.NeedsClearing {
+		t.Error("updating the printer cleared its bed")
+	}
+
+	if err := clear(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tf.setStatus("", "j2", models.StatusRunning); err != nil {
+		t.Errorf("a job did not start once the bed was cleared: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package fsm
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/raft3d/pkg/models"
+)
+
+func defaultMaterials() map[string]*models.Material {
+	materials := make(map[string]*models.Material)
+	for _, m := range models.DefaultMaterials() {
+		materials[m.Name] = m
+	}
+	return materials
+}
+
+func (f *FSM) applyMaterialCommand(cmd *Command) interface{} {
+	switch cmd.Op {
+	case OpCreate, OpUpdate:
+		var material models.Material
+		if err := json.Unmarshal(cmd.Payload, &material); err != nil {
+			return fmt.Errorf("failed to unmarshal material: %v", err)
+		}
+
+		if err := material.Validate(); err != nil {
+			return err
+		}
+
+		_, exists := f.store.materials[material.Name]
+		if cmd.Op == OpCreate && exists {
+			return fmt.Errorf("material already exists: %s", material.Name)
+		}
+		if cmd.Op == OpUpdate && !exists {
+			return fmt.Errorf("material not found: %s", material.Name)
+		}
+
+		f.store.materials[material.Name] = &material
+
+		// A changed default threshold may put filaments below it.
+		for _, fl := range f.store.filaments {
+			if fl.Type == material.Name {
+				f.checkLowStock(fl)
+			}
+		}
+		return nil
+
+	case OpDelete:
+		ref, err := decodeRef(cmd.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal ID: %v", err)
+		}
+
+		if _, exists := f.store.materials[ref.ID]; !exists {
+			return fmt.Errorf("material not found: %s", ref.ID)
+		}
+
+		for _, fl := range f.store.filaments {
+			if fl.Type == ref.ID {
+				return fmt.Errorf("material %s is used by filament %s", ref.ID, fl.ID)
+			}
+		}
+
+		delete(f.store.materials, ref.ID)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown material operation: %s", cmd.Op)
+	}
+}
+
+func (f *FSM) requireMaterial(name string) error {
+	if _, exists := f.store.materials[name]; !exists {
+		return fmt.Errorf("unknown filament material: %s", name)
+	}
+	return nil
+}
+
+func (s *Store) GetMaterials() []*models.Material {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	materials := make([]*models.Material, 0, len(s.materials))
+	for _, m := range s.materials {
+		materials = append(materials, m)
+	}
+
+	return materials
+}
+
+func (s *Store) GetMaterial(name string) (*models.Material, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	material, found := s.materials[name]
+	return material, found
+}
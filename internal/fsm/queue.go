@@ -0,0 +1,160 @@
+package fsm
+
+import (
+	"sort"
+
+	"github.com/raft3d/pkg/models"
+)
+
+// ownerKey identifies who a print job belongs to for fair share ordering.
+func ownerKey(job *models.PrintJob) string {
+	return scopedKey(job.TenantID, job.SubmittedBy)
+}
+
+// restoreSequences numbers jobs from snapshots taken before jobs carried a
+// sequence, in ID order after every numbered job.
+func restoreSequences(s *Store) {
+	var unnumbered []*models.PrintJob
+	for _, j := range s.printJobs {
+		if j.Sequence == 0 {
+			unnumbered = append(unnumbered, j)
+		} else if j.Sequence > s.sequence {
+			s.sequence = j.Sequence
+		}
+	}
+
+	sort.Slice(unnumbered, func(a, b int) bool {
+		return scopedKey(unnumbered[a].TenantID, unnumbered[a].ID) < scopedKey(unnumbered[b].TenantID, unnumbered[b].ID)
+	})
+	for _, j := range unnumbered {
+		s.sequence++
+		j.Sequence = s.sequence
+	}
+}
+
+// orderQueue sorts queued jobs into the order they will be printed. Higher
+// priorities go first. Within a priority, owners take turns, starting with
+// the owner who has waited longest since one of their jobs was started, and
+// each owner's jobs print in submission order. Owners are submitters within
+// a tenant: printers belong to one tenant, so a queue never mixes tenants.
+// The result only depends on replicated state, so every node computes the
+// same queue.
+func orderQueue(jobs []models.PrintJob, served map[string]uint64) []models.PrintJob {
+	sort.Slice(jobs, func(a, b int) bool {
+		if ra, rb := models.PriorityRank(jobs[a].Priority), models.PriorityRank(jobs[b].Priority); ra != rb {
+			return ra < rb
+		}
+		return jobs[a].Sequence < jobs[b].Sequence
+	})
+
+	ordered := make([]models.PrintJob, 0, len(jobs))
+	for start := 0; start < len(jobs); {
+		rank := models.PriorityRank(jobs[start].Priority)
+		end := start
+		for end < len(jobs) && models.PriorityRank(jobs[end].Priority) == rank {
+			end++
+		}
+		ordered = append(ordered, roundRobin(jobs[start:end], served)...)
+		start = end
+	}
+
+	return ordered
+}
+
+// roundRobin interleaves jobs of one priority, already in submission order,
+// across their owners.
+func roundRobin(jobs []models.PrintJob, served map[string]uint64) []models.PrintJob {
+	var owners []string
+	byOwner := make(map[string][]models.PrintJob)
+	for _, j := range jobs {
+		owner := ownerKey(&j)
+		if _, seen := byOwner[owner]; !seen {
+			owners = append(owners, owner)
+		}
+		byOwner[owner] = append(byOwner[owner], j)
+	}
+
+	// Owners are in order of their oldest job; stable sorting by when they
+	// were last served keeps that order among owners served equally.
+	sort.SliceStable(owners, func(a, b int) bool {
+		return served[owners[a]] < served[owners[b]]
+	})
+
+	ordered := make([]models.PrintJob, 0, len(jobs))
+	for len(ordered) < len(jobs) {
+		for _, owner := range owners {
+			if queue := byOwner[owner]; len(queue) > 0 {
+				ordered = append(ordered, queue[0])
+				byOwner[owner] = queue[1:]
+			}
+		}
+	}
+
+	return ordered
+}
+
+// BlockedJob is a queued print job waiting for the jobs in BlockedBy to be
+// Done.
+type BlockedJob struct {
+	models.PrintJob
+	BlockedBy []string
+}
+
+// GetQueue returns copies of a tenant's queued print jobs in the order they
+// will be printed, leaving out jobs still waiting for a dependency. A
+// non-empty printerID or group narrows the queue down to one printer or
+// printer group.
+func (s *Store) GetQueue(tenantID, printerID, group string) []models.PrintJob {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jobs := make([]models.PrintJob, 0)
+	for _, j := range s.queued(tenantID, printerID, group) {
+		if len(blockedBy(s.printJobs, j)) == 0 {
+			jobs = append(jobs, *j)
+		}
+	}
+
+	return orderQueue(jobs, s.served)
+}
+
+// GetBlockedJobs returns copies of the queued print jobs GetQueue leaves
+// out, in submission order, with the dependencies each one waits for.
+func (s *Store) GetBlockedJobs(tenantID, printerID, group string) []BlockedJob {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jobs := make([]BlockedJob, 0)
+	for _, j := range s.queued(tenantID, printerID, group) {
+		if pending := blockedBy(s.printJobs, j); len(pending) > 0 {
+			jobs = append(jobs, BlockedJob{PrintJob: *j, BlockedBy: pending})
+		}
+	}
+
+	sort.Slice(jobs, func(a, b int) bool {
+		return jobs[a].Sequence < jobs[b].Sequence
+	})
+	return jobs
+}
+
+// queued returns a tenant's queued print jobs on a printer or in a printer
+// group, if given.
+func (s *Store) queued(tenantID, printerID, group string) []*models.PrintJob {
+	var jobs []*models.PrintJob
+	for _, j := range s.printJobs {
+		if j.TenantID != tenantID || j.Status != models.StatusQueued {
+			continue
+		}
+		if printerID != "" && j.PrinterID != printerID {
+			continue
+		}
+		if group != "" {
+			printer, exists := s.printers[scopedKey(tenantID, j.PrinterID)]
+			if !exists || printer.Group != group {
+				continue
+			}
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs
+}
@@ -0,0 +1,74 @@
+package fsm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/raft3d/pkg/models"
+)
+
+func queueIDs(jobs []models.PrintJob) string {
+	ids := make([]string, len(jobs))
+	for i, j := range jobs {
+		ids[i] = j.ID
+	}
+	return strings.Join(ids, " ")
+}
+
+func TestQueueOrder(t *testing.T) {
+	tf := newTestFSM(t)
+	tf.addPrinter(models.DefaultTenant, "p1")
+
+	submit := func(id, owner, priority string) {
+		j := job(models.DefaultTenant, id, "p1")
+		j.SubmittedBy, j.Priority = owner, priority
+		tf.mustApply(OpCreate, EntityPrintJob, j)
+	}
+	submit("a1", "alice", "")
+	submit("a2", "alice", "")
+	submit("a3", "alice", "")
+	submit("d1", "dave", models.PriorityBatch)
+	submit("b1", "bob", models.PriorityNormal)
+	submit("b2", "bob", "")
+	submit("c1", "carol", models.PriorityUrgent)
+
+	// Urgent jobs first and batch jobs last; owners of normal jobs take
+	// turns, each in submission order
+	queue := func() string { return queueIDs(tf.store.GetQueue(models.DefaultTenant, "p1", "")) }
+	if got, want := queue(), "c1 a1 b1 a2 b2 a3 d1"; got != want {
+		t.Fatalf("queue = %s, want %s", got, want)
+	}
+
+	// Once alice was served, bob goes first until he is served too
+	if err := tf.setStatus(models.DefaultTenant, "a1", models.StatusRunning); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := queue(), "c1 b1 a2 b2 a3 d1"; got != want {
+		t.Errorf("queue after serving alice = %s, want %s", got, want)
+	}
+
+	submit("b3", "bob", "")
+	if got, want := queue(), "c1 b1 a2 b2 a3 b3 d1"; got != want {
+		t.Errorf("queue after bob submitted again = %s, want %s", got, want)
+	}
+}
+
+func TestQueueOrderOnlyDependsOnReplicatedState(t *testing.T) {
+	jobs := []models.PrintJob{
+		{ID: "x", SubmittedBy: "alice", Sequence: 3},
+		{ID: "y", SubmittedBy: "bob", Sequence: 2},
+		{ID: "z", SubmittedBy: "alice", Sequence: 1},
+	}
+	served := map[string]uint64{scopedKey("", "alice"): 5, scopedKey("", "bob"): 4}
+
+	want := queueIDs(orderQueue(append([]models.PrintJob(nil), jobs...), served))
+	for i := 0; i < 10; i++ {
+		shuffled := []models.PrintJob{jobs[i%3], jobs[(i+1)%3], jobs[(i+2)%3]}
+		if got := queueIDs(orderQueue(shuffled, served)); got != want {
+			t.Fatalf("order depends on input order: %s, then %s", want, got)
+		}
+	}
+	if want != "y z x" {
+		t.Errorf("queue = %s, want y z x", want)
+	}
+}
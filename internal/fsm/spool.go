@@ -0,0 +1,192 @@
+package fsm
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/raft3d/pkg/models"
+)
+
+const (
+	OpLoad   = "load"
+	OpUnload = "unload"
+)
+
+// SpoolSlotRef identifies a filament slot of a printer.
+type SpoolSlotRef struct {
+	TenantID  string `json:"tenant_id,omitempty"`
+	PrinterID string `json:"printer_id"`
+	Slot      int    `json:"slot"`
+}
+
+func spoolKey(tenantID, printerID string, slot int) string {
+	return scopedKey(tenantID, printerID) + "#" + strconv.Itoa(slot)
+}
+
+func (f *FSM) applySpoolCommand(cmd *Command) interface{} {
+	switch cmd.Op {
+	case OpLoad:
+		var load models.SpoolLoad
+		if err := json.Unmarshal(cmd.Payload, &load); err != nil {
+			return fmt.Errorf("failed to unmarshal spool load: %v", err)
+		}
+
+		normalizeTenant(&load.TenantID)
+		if err := load.Validate(); err != nil {
+			return err
+		}
+
+		printer, exists := f.store.printers[scopedKey(load.TenantID, load.PrinterID)]
+		if !exists {
+			return fmt.Errorf("printer not found: %s", load.PrinterID)
+		}
+
+		if printer.Capabilities != nil && load.Slot >= printer.Capabilities.Units() {
+			return fmt.Errorf("printer %s has no filament slot %d", printer.ID, load.Slot)
+		}
+
+		if _, exists := f.store.filaments[scopedKey(load.TenantID, load.FilamentID)]; !exists {
+			return fmt.Errorf("filament not found: %s", load.FilamentID)
+		}
+
+		if l, loaded := f.spoolLoaded(load.TenantID, load.FilamentID); loaded {
+			return fmt.Errorf("filament %s is already loaded on printer %s slot %d",
+				load.FilamentID, l.PrinterID, l.Slot)
+		}
+
+		key := spoolKey(load.TenantID, load.PrinterID, load.Slot)
+		if l, exists := f.store.spools[key]; exists {
+			return fmt.Errorf("slot %d of printer %s already holds filament %s; unload it first",
+				load.Slot, load.PrinterID, l.FilamentID)
+		}
+
+		load.LoadedAt = cmd.Timestamp
+		f.store.spools[key] = &load
+		return nil
+
+	case OpUnload:
+		var ref SpoolSlotRef
+		if err := json.Unmarshal(cmd.Payload, &ref); err != nil {
+			return fmt.Errorf("failed to unmarshal spool slot: %v", err)
+		}
+
+		normalizeTenant(&ref.TenantID)
+		key := spoolKey(ref.TenantID, ref.PrinterID, ref.Slot)
+		load, exists := f.store.spools[key]
+		if !exists {
+			return fmt.Errorf("slot %d of printer %s is empty", ref.Slot, ref.PrinterID)
+		}
+
+		for _, j := range f.store.printJobs {
+			if j.TenantID == ref.TenantID && j.PrinterID == ref.PrinterID &&
+				j.Status == models.StatusRunning && j.UsesFilament(load.FilamentID) {
+				return fmt.Errorf("filament %s is in use by running print job %s", load.FilamentID, j.ID)
+			}
+		}
+
+		delete(f.store.spools, key)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown spool operation: %s", cmd.Op)
+	}
+}
+
+// checkSpoolsLoaded rejects a job whose filaments are not mounted on its
+// printer. A single filament may sit in any slot; multi-material jobs need
+// each filament in the slot they name.
+func checkSpoolsLoaded(spools map[string]*models.SpoolLoad, job *models.PrintJob) error {
+	slots := job.Slots()
+	for _, slot := range slots {
+		if len(slots) > 1 {
+			load, exists := spools[spoolKey(job.TenantID, job.PrinterID, slot.Slot)]
+			if !exists || load.FilamentID != slot.FilamentID {
+				return fmt.Errorf("filament %s is not loaded in slot %d of printer %s",
+					slot.FilamentID, slot.Slot, job.PrinterID)
+			}
+			continue
+		}
+
+		loaded := false
+		for _, l := range spools {
+			if l.TenantID == job.TenantID && l.PrinterID == job.PrinterID && l.FilamentID == slot.FilamentID {
+				loaded = true
+				break
+			}
+		}
+		if !loaded {
+			return fmt.Errorf("filament %s is not loaded on printer %s", slot.FilamentID, job.PrinterID)
+		}
+	}
+	return nil
+}
+
+// checkSpoolsFit rejects capabilities that would drop a slot of the printer
+// a spool is mounted in; it has to be unloaded first.
+func (f *FSM) checkSpoolsFit(printer *models.Printer) error {
+	if printer.Capabilities == nil {
+		return nil
+	}
+
+	units := printer.Capabilities.Units()
+	var lost *models.SpoolLoad
+	for _, l := range f.store.spools {
+		if l.TenantID == printer.TenantID && l.PrinterID == printer.ID && l.Slot >= units &&
+			(lost == nil || l.Slot < lost.Slot) {
+			lost = l
+		}
+	}
+	if lost != nil {
+		return fmt.Errorf("printer %s would lose slot %d, which holds filament %s; unload it first",
+			printer.ID, lost.Slot, lost.FilamentID)
+	}
+	return nil
+}
+
+// unloadPrinter forgets every spool mounted on a printer.
+func (f *FSM) unloadPrinter(tenantID, printerID string) {
+	for key, l := range f.store.spools {
+		if l.TenantID == tenantID && l.PrinterID == printerID {
+			delete(f.store.spools, key)
+		}
+	}
+}
+
+// spoolLoaded reports whether a filament is mounted on any printer.
+func (f *FSM) spoolLoaded(tenantID, filamentID string) (*models.SpoolLoad, bool) {
+	for _, l := range f.store.spools {
+		if l.TenantID == tenantID && l.FilamentID == filamentID {
+			return l, true
+		}
+	}
+	return nil, false
+}
+
+// GetSpools returns the spools mounted on a printer, ordered by slot.
+func (s *Store) GetSpools(tenantID, printerID string) []*models.SpoolLoad {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	spools := make([]*models.SpoolLoad, 0)
+	for _, l := range s.spools {
+		if l.TenantID == tenantID && l.PrinterID == printerID {
+			spools = append(spools, l)
+		}
+	}
+
+	sort.Slice(spools, func(a, b int) bool {
+		return spools[a].Slot < spools[b].Slot
+	})
+	return spools
+}
+
+// CheckSpoolsLoaded reports why a job cannot start on its printer with the
+// spools currently mounted, or nil if it can.
+func (s *Store) CheckSpoolsLoaded(job *models.PrintJob) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return checkSpoolsLoaded(s.spools, job)
+}
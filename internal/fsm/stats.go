@@ -0,0 +1,43 @@
+package fsm
+
+// StoreStats summarises the replicated state for export as metrics. The maps
+// are keyed by tenant ID.
+type StoreStats struct {
+	// PrintJobs counts print jobs by status.
+	PrintJobs map[string]map[string]int
+	// FilamentGrams sums the remaining filament weight by filament type.
+	FilamentGrams map[string]map[string]int
+	// Printers counts registered printers.
+	Printers map[string]int
+}
+
+func (s *Store) GetStats() StoreStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := StoreStats{
+		PrintJobs:     make(map[string]map[string]int),
+		FilamentGrams: make(map[string]map[string]int),
+		Printers:      make(map[string]int),
+	}
+
+	for _, j := range s.printJobs {
+		if stats.PrintJobs[j.TenantID] == nil {
+			stats.PrintJobs[j.TenantID] = make(map[string]int)
+		}
+		stats.PrintJobs[j.TenantID][j.Status]++
+	}
+
+	for _, f := range s.filaments {
+		if stats.FilamentGrams[f.TenantID] == nil {
+			stats.FilamentGrams[f.TenantID] = make(map[string]int)
+		}
+		stats.FilamentGrams[f.TenantID][f.Type] += f.RemainingWeightInGrams
+	}
+
+	for _, p := range s.printers {
+		stats.Printers[p.TenantID]++
+	}
+
+	return stats
+}
@@ -0,0 +1,184 @@
+package fsm
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/raft3d/pkg/models"
+)
+
+func (f *FSM) applyTenantCommand(cmd *Command) interface{} {
+	switch cmd.Op {
+	case OpCreate:
+		var tenant models.Tenant
+		if err := json.Unmarshal(cmd.Payload, &tenant); err != nil {
+			return fmt.Errorf("failed to unmarshal tenant: %v", err)
+		}
+
+		if err := tenant.Validate(); err != nil {
+			return err
+		}
+
+		if _, exists := f.store.tenants[tenant.ID]; exists {
+			return fmt.Errorf("tenant already exists: %s", tenant.ID)
+		}
+
+		f.store.tenants[tenant.ID] = &tenant
+		return nil
+
+	case OpUpdate:
+		var tenant models.Tenant
+		if err := json.Unmarshal(cmd.Payload, &tenant); err != nil {
+			return fmt.Errorf("failed to unmarshal tenant: %v", err)
+		}
+
+		if err := tenant.Validate(); err != nil {
+			return err
+		}
+
+		if _, exists := f.store.tenants[tenant.ID]; !exists {
+			return fmt.Errorf("tenant not found: %s", tenant.ID)
+		}
+
+		f.store.tenants[tenant.ID] = &tenant
+		return nil
+
+	case OpDelete:
+		ref, err := decodeRef(cmd.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal ID: %v", err)
+		}
+
+		if ref.ID == models.DefaultTenant {
+			return fmt.Errorf("the default tenant cannot be deleted")
+		}
+
+		if _, exists := f.store.tenants[ref.ID]; !exists {
+			return fmt.Errorf("tenant not found: %s", ref.ID)
+		}
+
+		if f.tenantInUse(ref.ID) {
+			return fmt.Errorf("tenant %s still owns printers, filaments, print jobs, batches, webhooks or tokens", ref.ID)
+		}
+
+		f.dropTenantFiles(ref.ID)
+		delete(f.store.tenants, ref.ID)
+		delete(f.store.usage, ref.ID)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown tenant operation: %s", cmd.Op)
+	}
+}
+
+func (f *FSM) tenantInUse(tenantID string) bool {
+	for _, p := range f.store.printers {
+		if p.TenantID == tenantID {
+			return true
+		}
+	}
+	for _, fl := range f.store.filaments {
+		if fl.TenantID == tenantID {
+			return true
+		}
+	}
+	for _, j := range f.store.printJobs {
+		if j.TenantID == tenantID {
+			return true
+		}
+	}
+	for _, b := range f.store.batches {
+		if b.TenantID == tenantID {
+			return true
+		}
+	}
+	for _, w := range f.store.webhooks {
+		if w.TenantID == tenantID {
+			return true
+		}
+	}
+	for _, t := range f.store.tokens {
+		if t.TenantID == tenantID {
+			return true
+		}
+	}
+	return false
+}
+
+// checkQuota rejects a new print job that would take its tenant over the
+// queued job limit or the monthly filament budget. Filament held by queued and
+// running jobs counts against the budget of the month the job is submitted in.
+func (f *FSM) checkQuota(job *models.PrintJob, now time.Time) error {
+	tenant, exists := f.store.tenants[job.TenantID]
+	if !exists {
+		return fmt.Errorf("tenant not found: %s", job.TenantID)
+	}
+
+	queued := 0
+	outstanding := 0
+	for _, j := range f.store.printJobs {
+		if j.TenantID != job.TenantID {
+			continue
+		}
+		if j.Status == models.StatusQueued {
+			queued++
+		}
+		if j.Status == models.StatusQueued || j.Status == models.StatusRunning {
+			outstanding += j.PrintWeightInGrams
+		}
+	}
+
+	if tenant.Quota.MaxQueuedJobs > 0 && queued >= tenant.Quota.MaxQueuedJobs {
+		return fmt.Errorf("tenant %s quota exceeded: %d queued print jobs allowed",
+			tenant.ID, tenant.Quota.MaxQueuedJobs)
+	}
+
+	if tenant.Quota.MonthlyFilamentGrams > 0 {
+		used := f.store.usage[tenant.ID][models.UsagePeriod(now)]
+		if used+outstanding+job.PrintWeightInGrams > tenant.Quota.MonthlyFilamentGrams {
+			return fmt.Errorf("tenant %s quota exceeded: %d g used and %d g reserved of %d g this month",
+				tenant.ID, used, outstanding, tenant.Quota.MonthlyFilamentGrams)
+		}
+	}
+
+	return nil
+}
+
+func (f *FSM) recordUsage(tenantID string, now time.Time, grams int) {
+	periods, exists := f.store.usage[tenantID]
+	if !exists {
+		periods = make(map[string]int)
+		f.store.usage[tenantID] = periods
+	}
+	periods[models.UsagePeriod(now)] += grams
+}
+
+func (s *Store) GetTenants() []*models.Tenant {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tenants := make([]*models.Tenant, 0, len(s.tenants))
+	for _, t := range s.tenants {
+		tenants = append(tenants, t)
+	}
+
+	return tenants
+}
+
+func (s *Store) GetTenant(id string) (*models.Tenant, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tenant, found := s.tenants[id]
+	return tenant, found
+}
+
+// GetTenantUsage returns the grams of filament a tenant consumed in a usage
+// period.
+func (s *Store) GetTenantUsage(tenantID, period string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.usage[tenantID][period]
+}
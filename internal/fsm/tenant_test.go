@@ -0,0 +1,68 @@
+package fsm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/raft3d/pkg/models"
+)
+
+func TestQuotas(t *testing.T) {
+	tf := newTestFSM(t)
+	tf.mustApply(OpCreate, EntityTenant, models.Tenant{
+		ID: "acme", Name: "Acme",
+		Quota: models.TenantQuota{MaxQueuedJobs: 2, MonthlyFilamentGrams: 50},
+	})
+	tf.addPrinter("acme", "p1")
+
+	submit := func(id string, grams int) error {
+		j := job("acme", id, "p1")
+		j.PrintWeightInGrams = grams
+		return tf.apply(OpCreate, EntityPrintJob, j)
+	}
+	mustSet := func(id, status string) {
+		t.Helper()
+		if err := tf.setStatus("acme", id, status); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Queued jobs count against the job limit
+	for _, id := range []string{"j1", "j2"} {
+		if err := submit(id, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := submit("j3", 10); err == nil {
+		t.Fatal("a third queued job was accepted")
+	}
+
+	// Running jobs no longer count as queued, but their filament stays
+	// reserved: 20 g reserved
+	mustSet("j1", models.StatusRunning)
+	if err := submit("j3", 31); err == nil {
+		t.Fatal("a job over the monthly budget was accepted")
+	}
+	if err := submit("j3", 30); err != nil {
+		t.Fatalf("a job within the monthly budget was rejected: %v", err)
+	}
+
+	// Finished jobs count as used: 10 g used and 40 g reserved
+	mustSet("j1", models.StatusDone)
+	if used := tf.store.GetTenantUsage("acme", "2026-03"); used != 10 {
+		t.Errorf("usage = %d g, want 10 g", used)
+	}
+	mustSet("j3", models.StatusCancelled)
+	if err := submit("j4", 31); err == nil {
+		t.Fatal("a job over the monthly budget was accepted after a job was done")
+	}
+
+	// A new month starts with nothing used; queued jobs stay reserved
+	tf.now = time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	if err := submit("j4", 40); err != nil {
+		t.Fatalf("a job within next month's budget was rejected: %v", err)
+	}
+	if used := tf.store.GetTenantUsage("acme", "2026-04"); used != 0 {
+		t.Errorf("usage of a new month = %d g, want 0", used)
+	}
+}
@@ -0,0 +1,254 @@
+package fsm
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/raft3d/pkg/events"
+	"github.com/raft3d/pkg/models"
+)
+
+const (
+	// OpResult records the outcome of a webhook delivery attempt.
+	OpResult = "result"
+
+	// MaxDeliveryAttempts is how often a delivery is tried before it fails.
+	MaxDeliveryAttempts = 8
+	// deliveryLogSize is how many finished deliveries are kept per webhook.
+	deliveryLogSize = 100
+)
+
+// DeliveryResult is the outcome of one attempt to deliver to a webhook. The
+// leader decides when to retry, so that every node agrees on the schedule.
+type DeliveryResult struct {
+	TenantID      string    `json:"tenant_id,omitempty"`
+	ID            string    `json:"id"`
+	Success       bool      `json:"success"`
+	StatusCode    int       `json:"status_code,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	NextAttemptAt time.Time `json:"next_attempt_at,omitempty"`
+}
+
+func (f *FSM) applyWebhookCommand(cmd *Command) interface{} {
+	switch cmd.Op {
+	case OpCreate, OpUpdate:
+		var webhook models.Webhook
+		if err := json.Unmarshal(cmd.Payload, &webhook); err != nil {
+			return fmt.Errorf("failed to unmarshal webhook: %v", err)
+		}
+
+		normalizeTenant(&webhook.TenantID)
+		if err := webhook.Validate(); err != nil {
+			return err
+		}
+
+		for _, t := range webhook.EventTypes {
+			if !events.KnownType(t) {
+				return fmt.Errorf("unknown event type: %s", t)
+			}
+		}
+
+		if err := f.requireTenant(webhook.TenantID); err != nil {
+			return err
+		}
+
+		key := scopedKey(webhook.TenantID, webhook.ID)
+		existing, exists := f.store.webhooks[key]
+		if cmd.Op == OpCreate && exists {
+			return fmt.Errorf("webhook already exists: %s", webhook.ID)
+		}
+		if cmd.Op == OpUpdate && !exists {
+			return fmt.Errorf("webhook not found: %s", webhook.ID)
+		}
+
+		webhook.CreatedAt = cmd.Timestamp
+		if exists {
+			webhook.CreatedAt = existing.CreatedAt
+		}
+		f.store.webhooks[key] = &webhook
+		return nil
+
+	case OpDelete:
+		ref, err := decodeRef(cmd.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal ID: %v", err)
+		}
+
+		key := scopedKey(ref.TenantID, ref.ID)
+		if _, exists := f.store.webhooks[key]; !exists {
+			return fmt.Errorf("webhook not found: %s", ref.ID)
+		}
+
+		for k, d := range f.store.deliveries {
+			if d.TenantID == ref.TenantID && d.WebhookID == ref.ID {
+				delete(f.store.deliveries, k)
+			}
+		}
+		delete(f.store.webhooks, key)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown webhook operation: %s", cmd.Op)
+	}
+}
+
+func (f *FSM) applyDeliveryCommand(cmd *Command) interface{} {
+	switch cmd.Op {
+	case OpResult:
+		var result DeliveryResult
+		if err := json.Unmarshal(cmd.Payload, &result); err != nil {
+			return fmt.Errorf("failed to unmarshal delivery result: %v", err)
+		}
+
+		normalizeTenant(&result.TenantID)
+		delivery, exists := f.store.deliveries[scopedKey(result.TenantID, result.ID)]
+		if !exists {
+			return fmt.Errorf("webhook delivery not found: %s", result.ID)
+		}
+
+		// A new leader may repeat an attempt whose result was already
+		// committed; the delivery has moved on since.
+		if delivery.Status != models.DeliveryPending {
+			return nil
+		}
+
+		delivery.Attempts++
+		delivery.LastStatusCode = result.StatusCode
+		delivery.LastError = result.Error
+
+		switch {
+		case result.Success:
+			delivery.Status = models.DeliveryDelivered
+			delivery.CompletedAt = cmd.Timestamp
+		case delivery.Attempts >= MaxDeliveryAttempts:
+			delivery.Status = models.DeliveryFailed
+			delivery.CompletedAt = cmd.Timestamp
+		default:
+			delivery.NextAttemptAt = result.NextAttemptAt
+			return nil
+		}
+
+		f.pruneDeliveries(delivery.TenantID, delivery.WebhookID)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown webhook delivery operation: %s", cmd.Op)
+	}
+}
+
+// queueDeliveries creates a pending delivery of each event about to be
+// published for every webhook subscribed to it.
+func (f *FSM) queueDeliveries() {
+	for _, e := range f.pending {
+		for _, w := range f.store.webhooks {
+			if w.TenantID != e.TenantID || !w.Wants(e.Type) {
+				continue
+			}
+
+			payload, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+
+			delivery := &models.WebhookDelivery{
+				ID:            e.ID() + "-" + w.ID,
+				TenantID:      w.TenantID,
+				WebhookID:     w.ID,
+				EventID:       e.ID(),
+				EventType:     e.Type,
+				Payload:       payload,
+				Status:        models.DeliveryPending,
+				NextAttemptAt: e.Time,
+				CreatedAt:     e.Time,
+			}
+			f.store.deliveries[scopedKey(delivery.TenantID, delivery.ID)] = delivery
+		}
+	}
+}
+
+// pruneDeliveries drops the oldest finished deliveries of a webhook beyond
+// the delivery log size.
+func (f *FSM) pruneDeliveries(tenantID, webhookID string) {
+	var finished []*models.WebhookDelivery
+	for _, d := range f.store.deliveries {
+		if d.TenantID == tenantID && d.WebhookID == webhookID && d.Status != models.DeliveryPending {
+			finished = append(finished, d)
+		}
+	}
+	if len(finished) <= deliveryLogSize {
+		return
+	}
+
+	sortDeliveries(finished)
+	for _, d := range finished[:len(finished)-deliveryLogSize] {
+		delete(f.store.deliveries, scopedKey(d.TenantID, d.ID))
+	}
+}
+
+func sortDeliveries(deliveries []*models.WebhookDelivery) {
+	sort.Slice(deliveries, func(a, b int) bool {
+		if !deliveries[a].CreatedAt.Equal(deliveries[b].CreatedAt) {
+			return deliveries[a].CreatedAt.Before(deliveries[b].CreatedAt)
+		}
+		return deliveries[a].ID < deliveries[b].ID
+	})
+}
+
+func (s *Store) GetWebhooks(tenantID string) []*models.Webhook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	webhooks := make([]*models.Webhook, 0)
+	for _, w := range s.webhooks {
+		if w.TenantID == tenantID {
+			webhooks = append(webhooks, w)
+		}
+	}
+
+	return webhooks
+}
+
+func (s *Store) GetWebhook(tenantID, id string) (*models.Webhook, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	webhook, found := s.webhooks[scopedKey(tenantID, id)]
+	return webhook, found
+}
+
+// GetDeliveries returns copies of the deliveries of a webhook, oldest first.
+func (s *Store) GetDeliveries(tenantID, webhookID string) []*models.WebhookDelivery {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	deliveries := make([]*models.WebhookDelivery, 0)
+	for _, d := range s.deliveries {
+		if d.TenantID == tenantID && d.WebhookID == webhookID {
+			delivery := *d
+			deliveries = append(deliveries, &delivery)
+		}
+	}
+
+	sortDeliveries(deliveries)
+	return deliveries
+}
+
+// GetDueDeliveries returns copies of the pending deliveries of every tenant
+// whose next attempt is due at now, oldest first.
+func (s *Store) GetDueDeliveries(now time.Time) []*models.WebhookDelivery {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	deliveries := make([]*models.WebhookDelivery, 0)
+	for _, d := range s.deliveries {
+		if d.Status == models.DeliveryPending && !d.NextAttemptAt.After(now) {
+			delivery := *d
+			deliveries = append(deliveries, &delivery)
+		}
+	}
+
+	sortDeliveries(deliveries)
+	return deliveries
+}
@@ -0,0 +1,84 @@
+package alerts
+
+import (
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/raft3d/internal/fsm"
+	"github.com/raft3d/pkg/raft"
+)
+
+// Dispatcher runs on the leader and delivers the low stock alerts raised by
+// the state machine. Delivery is committed through Raft, and it is the
+// committed delivery that publishes the alert on every node's event stream,
+// so an alert fires exactly once even if the leader changes mid delivery.
+type Dispatcher struct {
+	raftServer leader
+	fsm        *fsm.FSM
+
+	// Interval between delivery passes.
+	Interval time.Duration
+	// Logger receives delivered alerts.
+	Logger *slog.Logger
+}
+
+// leader is the part of the Raft server the dispatcher needs.
+type leader interface {
+	IsLeader() bool
+	ApplyCommand(cmd *fsm.Command, timeout time.Duration) (interface{}, error)
+}
+
+func NewDispatcher(raftServer *raft.Server, fsm *fsm.FSM) *Dispatcher {
+	return &Dispatcher{
+		raftServer: raftServer,
+		fsm:        fsm,
+		Interval:   2 * time.Second,
+		Logger:     slog.Default(),
+	}
+}
+
+func (d *Dispatcher) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if d.raftServer.IsLeader() {
+				d.deliver()
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) deliver() {
+	for _, alert := range d.fsm.Store().GetPendingAlerts() {
+		refData, err := json.Marshal(fsm.EntityRef{TenantID: alert.TenantID, ID: alert.ID})
+		if err != nil {
+			continue
+		}
+
+		cmd := fsm.Command{
+			Op:         fsm.OpDeliver,
+			EntityType: fsm.EntityAlert,
+			Payload:    refData,
+		}
+
+		if _, err := d.raftServer.ApplyCommand(&cmd, 5*time.Second); err != nil {
+			d.Logger.Warn("failed to deliver alert", "tenant", alert.TenantID, "alert", alert.ID, "err", err)
+			return
+		}
+
+		d.Logger.Warn("filament is low",
+			"tenant", alert.TenantID,
+			"filament", alert.FilamentID,
+			"material", alert.Material,
+			"color", alert.Color,
+			"remaining_grams", alert.RemainingGrams,
+			"threshold_grams", alert.ThresholdGrams,
+		)
+	}
+}
@@ -0,0 +1,227 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	hraft "github.com/hashicorp/raft"
+	"github.com/raft3d/internal/fsm"
+	"github.com/raft3d/pkg/events"
+	"github.com/raft3d/pkg/models"
+)
+
+// node is a member of a test cluster that records the events it publishes.
+type node struct {
+	fsm    *fsm.FSM
+	events []events.Event
+}
+
+func (n *node) Publish(e events.Event) {
+	n.events = append(n.events, e)
+}
+
+// alerts returns the low stock alerts the node published.
+func (n *node) alerts() int {
+	count := 0
+	for _, e := range n.events {
+		if e.Type == events.TypeFilamentLowStock {
+			count++
+		}
+	}
+	return count
+}
+
+// cluster applies every command to the FSM of each of its nodes, as Raft
+// would once the command is committed.
+type cluster struct {
+	t     *testing.T
+	nodes []*node
+	index uint64
+}
+
+func newCluster(t *testing.T, size int) *cluster {
+	c := &cluster{t: t}
+	for i := 0; i < size; i++ {
+		c.join(fsm.NewFSM())
+	}
+	return c
+}
+
+func (c *cluster) join(f *fsm.FSM) *node {
+	n := &node{fsm: f}
+	f.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	f.SetPublisher(n)
+	c.nodes = append(c.nodes, n)
+	return n
+}
+
+func (c *cluster) IsLeader() bool { return true }
+
+func (c *cluster) ApplyCommand(cmd *fsm.Command, timeout time.Duration) (interface{}, error) {
+	if cmd.Timestamp.IsZero() {
+		cmd.Timestamp = time.Now().UTC()
+	}
+	cmd.Version = fsm.CommandVersion
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	c.index++
+	var resp interface{}
+	for _, n := range c.nodes {
+		resp = n.fsm.Apply(&hraft.Log{Index: c.index, Data: data})
+	}
+	if err, ok := resp.(error); ok {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *cluster) apply(op, entityType string, payload interface{}) {
+	c.t.Helper()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if _, err := c.ApplyCommand(&fsm.Command{Op: op, EntityType: entityType, Payload: data}, time.Second); err != nil {
+		c.t.Fatalf("%s %s: %v", op, entityType, err)
+	}
+}
+
+// print runs a job using grams of the test's filament to Done.
+func (c *cluster) print(id string, grams int) {
+	c.t.Helper()
+	c.apply(fsm.OpCreate, fsm.EntityPrintJob, models.PrintJob{
+		ID: id, PrinterID: "p1", FilamentID: "f1", Filepath: id + ".gcode", PrintWeightInGrams: grams,
+	})
+	c.apply(fsm.OpClearBed, fsm.EntityPrinter, fsm.EntityRef{ID: "p1"})
+	c.apply(fsm.OpUpdate, fsm.EntityPrintJob, fsm.PrintJobStatusChange{ID: id, Status: models.StatusRunning})
+	c.apply(fsm.OpUpdate, fsm.EntityPrintJob, fsm.PrintJobStatusChange{ID: id, Status: models.StatusDone})
+}
+
+// newLowStockTest sets up a cluster with a filament that goes low below
+// 100 g, and 150 g left.
+func newLowStockTest(t *testing.T, size int) *cluster {
+	c := newCluster(t, size)
+	c.apply(fsm.OpCreate, fsm.EntityPrinter, models.Printer{ID: "p1", Company: "Prusa", Model: "MK4"})
+	c.apply(fsm.OpCreate, fsm.EntityFilament, models.Filament{
+		ID: "f1", Type: "PLA", Color: "black", TotalWeightInGrams: 1000, RemainingWeightInGrams: 150,
+		LowStockThresholdGrams: 100,
+	})
+	c.apply(fsm.OpLoad, fsm.EntitySpool, models.SpoolLoad{PrinterID: "p1", FilamentID: "f1"})
+	return c
+}
+
+// dispatcher returns the dispatcher of a node that leads the cluster.
+func (c *cluster) dispatcher(n *node) *Dispatcher {
+	d := NewDispatcher(nil, n.fsm)
+	d.raftServer = c
+	d.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	return d
+}
+
+func (c *cluster) checkAlerts(want int) {
+	c.t.Helper()
+	for i, n := range c.nodes {
+		if got := n.alerts(); got != want {
+			c.t.Errorf("node %d published %d alerts, want %d", i, got, want)
+		}
+	}
+}
+
+func TestAlertIsDeliveredOnce(t *testing.T) {
+	c := newLowStockTest(t, 3)
+	d := c.dispatcher(c.nodes[0])
+
+	c.print("j1", 60)
+	c.checkAlerts(0)
+	d.deliver()
+	c.checkAlerts(1)
+	d.deliver()
+	c.checkAlerts(1)
+
+	// Going further below the threshold is the same crossing
+	c.print("j2", 20)
+	d.deliver()
+	c.checkAlerts(1)
+
+	alerts := c.nodes[0].fsm.Store().GetAlerts(models.DefaultTenant)
+	if len(alerts) != 1 || alerts[0].Status != models.AlertDelivered || alerts[0].RemainingGrams != 90 {
+		t.Errorf("alerts = %+v, want one delivered alert at 90 g", alerts)
+	}
+}
+
+func TestAlertDeliveredTwiceFiresOnce(t *testing.T) {
+	c := newLowStockTest(t, 3)
+	c.print("j1", 60)
+	pending := c.nodes[0].fsm.Store().GetPendingAlerts()
+	if len(pending) != 1 {
+		t.Fatalf("%d pending alerts, want 1", len(pending))
+	}
+
+	// A leader commits the delivery and fails before it hears back, so the
+	// next leader delivers the alert again
+	ref := fsm.EntityRef{ID: pending[0].ID}
+	c.apply(fsm.OpDeliver, fsm.EntityAlert, ref)
+	c.apply(fsm.OpDeliver, fsm.EntityAlert, ref)
+	c.dispatcher(c.nodes[1]).deliver()
+	c.checkAlerts(1)
+}
+
+func TestAlertSurvivesSnapshots(t *testing.T) {
+	c := newLowStockTest(t, 2)
+	c.print("j1", 60)
+
+	restore := func(from *node) *node {
+		t.Helper()
+		snapshot, err := from.fsm.Snapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := json.Marshal(snapshot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := fsm.NewFSM()
+		if err := f.Restore(io.NopCloser(bytes.NewReader(data))); err != nil {
+			t.Fatal(err)
+		}
+		return c.join(f)
+	}
+
+	// A node restored while the alert is pending delivers it as the new
+	// leader, once
+	pendingNode := restore(c.nodes[0])
+	c.dispatcher(pendingNode).deliver()
+	c.dispatcher(c.nodes[0]).deliver()
+	c.checkAlerts(1)
+
+	// A node restored after the delivery has nothing left to deliver
+	deliveredNode := restore(c.nodes[0])
+	c.dispatcher(deliveredNode).deliver()
+	if got := deliveredNode.alerts(); got != 0 {
+		t.Errorf("node restored after the delivery published %d alerts", got)
+	}
+	for i, n := range c.nodes[:3] {
+		if got := n.alerts(); got != 1 {
+			t.Errorf("node %d published %d alerts, want 1", i, got)
+		}
+	}
+
+	// Refilling and crossing again raises a new alert
+	refill := models.Filament{
+		ID: "f1", Type: "PLA", Color: "black", TotalWeightInGrams: 1000, RemainingWeightInGrams: 1000,
+		LowStockThresholdGrams: 100,
+	}
+	c.apply(fsm.OpUpdate, fsm.EntityFilament, refill)
+	c.print("j2", 950)
+	c.dispatcher(deliveredNode).deliver()
+	if got := deliveredNode.alerts(); got != 1 {
+		t.Errorf("a second crossing published %d alerts on the restored node, want 1", got)
+	}
+}
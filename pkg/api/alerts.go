@@ -0,0 +1,19 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/raft3d/internal/fsm"
+)
+
+func (h *Handler) ListAlerts(w http.ResponseWriter, r *http.Request) {
+	alerts := h.fsm.Store().GetAlerts(tenantID(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alerts)
+}
+
+func (h *Handler) DeleteAlert(w http.ResponseWriter, r *http.Request) {
+	h.deleteEntity(w, r, fsm.EntityAlert, "alert")
+}
@@ -0,0 +1,285 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/raft3d/internal/fsm"
+	"github.com/raft3d/pkg/models"
+	"github.com/raft3d/pkg/tlsutil"
+)
+
+type contextKey string
+
+const tokenContextKey contextKey = "api_token"
+
+// peerTokenID identifies the peer token in the request context. The peer
+// token has no role, so it is only accepted by requirePeer.
+const peerTokenID = "peer"
+
+// EnableAuth turns on bearer token authentication. The bootstrap token is
+// accepted with the admin role so that the first tokens can be created; it is
+// never written to the replicated log.
+func (h *Handler) EnableAuth(bootstrapToken string) {
+	h.authEnabled = true
+	if bootstrapToken != "" {
+		h.bootstrapTokenHash = models.HashToken(bootstrapToken)
+	}
+}
+
+// authenticate resolves the bearer token of a request, if any, and stores the
+// matching API token in the request context for requireRole to inspect.
+func (h *Handler) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.authEnabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		bearer := strings.TrimPrefix(header, "Bearer ")
+		if bearer == header || bearer == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "malformed authorization header", http.StatusUnauthorized)
+			return
+		}
+
+		token, found := h.lookupToken(bearer)
+		if !found {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "invalid API token", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), tokenContextKey, token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// EnablePeerToken accepts token from other nodes on the routes nodes call on
+// each other, such as file replication. Nodes presenting a client
+// certificate issued to a cluster member are accepted without it.
+func (h *Handler) EnablePeerToken(token string) {
+	if token != "" {
+		h.peerTokenHash = models.HashToken(token)
+	}
+}
+
+func (h *Handler) lookupToken(bearer string) (*models.APIToken, bool) {
+	tokenHash := models.HashToken(bearer)
+
+	if h.bootstrapTokenHash != "" &&
+		subtle.ConstantTimeCompare([]byte(tokenHash), []byte(h.bootstrapTokenHash)) == 1 {
+		return &models.APIToken{ID: "bootstrap", Name: "bootstrap", Role: models.RoleAdmin}, true
+	}
+
+	if h.peerTokenHash != "" &&
+		subtle.ConstantTimeCompare([]byte(tokenHash), []byte(h.peerTokenHash)) == 1 {
+		return &models.APIToken{ID: peerTokenID, Name: "peer"}, true
+	}
+
+	return h.fsm.Store().GetTokenByHash(tokenHash)
+}
+
+const (
+	scopeTenant = iota
+	scopeGlobal
+	scopeShared
+)
+
+// requireRole wraps a tenant scoped route so that it is only served to
+// callers holding at least the given role for the tenant in the request.
+func (h *Handler) requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return h.authorize(role, scopeTenant, next)
+}
+
+// requireGlobalRole wraps a cluster wide route so that it is only served to
+// callers holding at least the given role with a token not bound to a tenant.
+func (h *Handler) requireGlobalRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return h.authorize(role, scopeGlobal, next)
+}
+
+// requireSharedRole wraps a route serving cluster wide information that any
+// tenant may see, such as node status or the material registry.
+func (h *Handler) requireSharedRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return h.authorize(role, scopeShared, next)
+}
+
+func (h *Handler) authorize(role string, scope int, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !h.authEnabled {
+			next(w, r)
+			return
+		}
+
+		token := tokenFromContext(r.Context())
+		if token == nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+			return
+		}
+
+		if !models.RoleAllows(token.Role, role) {
+			http.Error(w, fmt.Sprintf("role %s is required", role), http.StatusForbidden)
+			return
+		}
+
+		if token.TenantID != "" {
+			if scope == scopeGlobal || (scope == scopeTenant && token.TenantID != tenantID(r)) {
+				http.Error(w, "token is not valid for this tenant", http.StatusForbidden)
+				return
+			}
+		}
+
+		next(w, r)
+	}
+}
+
+// requireRoleOrPeer wraps a cluster route that nodes holding the peer token
+// may also call, so that a node joining through discovery can list the
+// servers and ask to be added without an admin token.
+func (h *Handler) requireRoleOrPeer(role string, scope int, next http.HandlerFunc) http.HandlerFunc {
+	guarded := h.authorize(role, scope, next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token := tokenFromContext(r.Context()); h.authEnabled && token != nil && token.ID == peerTokenID {
+			next(w, r)
+			return
+		}
+		guarded(w, r)
+	}
+}
+
+// requirePeer wraps a route that only other nodes of the cluster may call.
+// They authenticate with the peer token or a client certificate issued to a
+// member of the Raft configuration.
+func (h *Handler) requirePeer(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !h.authEnabled {
+			next(w, r)
+			return
+		}
+
+		if token := tokenFromContext(r.Context()); token != nil && token.ID == peerTokenID {
+			next(w, r)
+			return
+		}
+
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 &&
+			h.raftServer.IsMember(tlsutil.NodeID(r.TLS.VerifiedChains[0][0])) {
+			next(w, r)
+			return
+		}
+
+		http.Error(w, "only cluster nodes may call this route", http.StatusForbidden)
+	}
+}
+
+func tokenFromContext(ctx context.Context) *models.APIToken {
+	token, _ := ctx.Value(tokenContextKey).(*models.APIToken)
+	return token
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (h *Handler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	if !h.isLeader(w) {
+		return
+	}
+
+	var request struct {
+		Name     string `json:"name"`
+		Role     string `json:"role"`
+		TenantID string `json:"tenant_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to generate token ID: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to generate token: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	token := models.APIToken{
+		ID:        id,
+		Name:      request.Name,
+		Role:      request.Role,
+		TenantID:  request.TenantID,
+		TokenHash: models.HashToken(secret),
+	}
+
+	if err := token.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tokenData, err := json.Marshal(token)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal token data: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	cmd := fsm.Command{
+		Op:         fsm.OpCreate,
+		EntityType: fsm.EntityAPIToken,
+		Payload:    tokenData,
+	}
+
+	_, err = h.applyCommand(r, &cmd)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to create API token: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	token.TokenHash = ""
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		models.APIToken
+		Token string `json:"token"`
+	}{token, secret})
+}
+
+func (h *Handler) ListTokens(w http.ResponseWriter, r *http.Request) {
+	tokens := h.fsm.Store().GetTokens()
+
+	redacted := make([]models.APIToken, 0, len(tokens))
+	for _, t := range tokens {
+		token := *t
+		token.TokenHash = ""
+		redacted = append(redacted, token)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(redacted)
+}
+
+func (h *Handler) DeleteToken(w http.ResponseWriter, r *http.Request) {
+	h.deleteEntity(w, r, fsm.EntityAPIToken, "API token")
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/raft3d/internal/fsm"
+	"github.com/raft3d/pkg/models"
+)
+
+type batchView struct {
+	*models.Batch
+	Progress models.BatchProgress `json:"progress"`
+	Jobs     []models.PrintJob    `json:"jobs,omitempty"`
+}
+
+func (h *Handler) CreateBatch(w http.ResponseWriter, r *http.Request) {
+	h.writeBatch(w, r, fsm.OpCreate, http.StatusCreated)
+}
+
+func (h *Handler) UpdateBatch(w http.ResponseWriter, r *http.Request) {
+	h.writeBatch(w, r, fsm.OpUpdate, http.StatusOK)
+}
+
+func (h *Handler) writeBatch(w http.ResponseWriter, r *http.Request, op string, status int) {
+	if !h.isLeader(w) {
+		return
+	}
+
+	var batch models.Batch
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	batch.TenantID = tenantID(r)
+	if op == fsm.OpUpdate {
+		batch.ID = mux.Vars(r)["id"]
+	}
+
+	if err := batch.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	batchData, err := json.Marshal(batch)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal batch data: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	cmd := fsm.Command{
+		Op:         op,
+		EntityType: fsm.EntityBatch,
+		Payload:    batchData,
+	}
+
+	if _, err := h.applyCommand(r, &cmd); err != nil {
+		http.Error(w, fmt.Sprintf("failed to save batch: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if stored, found := h.fsm.Store().GetBatch(batch.TenantID, batch.ID); found {
+		batch = *stored
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(batch)
+}
+
+func (h *Handler) ListBatches(w http.ResponseWriter, r *http.Request) {
+	tenant := tenantID(r)
+
+	views := make([]batchView, 0)
+	for _, b := range h.fsm.Store().GetBatches(tenant) {
+		views = append(views, batchView{Batch: b, Progress: h.fsm.Store().GetBatchProgress(tenant, b.ID)})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views)
+}
+
+func (h *Handler) GetBatch(w http.ResponseWriter, r *http.Request) {
+	tenant := tenantID(r)
+	id := mux.Vars(r)["id"]
+
+	batch, found := h.fsm.Store().GetBatch(tenant, id)
+	if !found {
+		http.Error(w, "batch not found", http.StatusNotFound)
+		return
+	}
+
+	view := batchView{
+		Batch:    batch,
+		Progress: h.fsm.Store().GetBatchProgress(tenant, id),
+		Jobs:     h.fsm.Store().GetBatchJobs(tenant, id),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
+
+// CancelBatch cancels every queued and running print job of a batch.
+func (h *Handler) CancelBatch(w http.ResponseWriter, r *http.Request) {
+	if !h.isLeader(w) {
+		return
+	}
+
+	tenant := tenantID(r)
+	id := mux.Vars(r)["id"]
+
+	refData, err := json.Marshal(fsm.EntityRef{TenantID: tenant, ID: id})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal ID: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	cmd := fsm.Command{
+		Op:         fsm.OpCancel,
+		EntityType: fsm.EntityBatch,
+		Payload:    refData,
+	}
+
+	if _, err := h.applyCommand(r, &cmd); err != nil {
+		http.Error(w, fmt.Sprintf("failed to cancel batch: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.fsm.Store().GetBatchProgress(tenant, id))
+}
+
+func (h *Handler) DeleteBatch(w http.ResponseWriter, r *http.Request) {
+	h.deleteEntity(w, r, fsm.EntityBatch, "batch")
+}
+
+func (h *Handler) AddPrintJobDependency(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		DependsOn string `json:"depends_on"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	h.changeDependency(w, r, fsm.OpAddDependency, body.DependsOn)
+}
+
+func (h *Handler) RemovePrintJobDependency(w http.ResponseWriter, r *http.Request) {
+	h.changeDependency(w, r, fsm.OpRemoveDependency, mux.Vars(r)["dep"])
+}
+
+func (h *Handler) changeDependency(w http.ResponseWriter, r *http.Request, op, dependsOn string) {
+	if !h.isLeader(w) {
+		return
+	}
+
+	if dependsOn == "" {
+		http.Error(w, "depends_on cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	tenant := tenantID(r)
+	id := mux.Vars(r)["id"]
+
+	changeData, err := json.Marshal(fsm.DependencyChange{TenantID: tenant, JobID: id, DependsOn: dependsOn})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal dependency change: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	cmd := fsm.Command{
+		Op:         op,
+		EntityType: fsm.EntityPrintJob,
+		Payload:    changeData,
+	}
+
+	if _, err := h.applyCommand(r, &cmd); err != nil {
+		http.Error(w, fmt.Sprintf("failed to change dependencies: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	printJob, _ := h.fsm.Store().GetPrintJob(tenant, id)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(printJob)
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type clusterServer struct {
+	ID       string `json:"id"`
+	Address  string `json:"address"`
+	Suffrage string `json:"suffrage"`
+}
+
+func (h *Handler) ListClusterServers(w http.ResponseWriter, r *http.Request) {
+	servers, err := h.raftServer.Servers()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := make([]clusterServer, 0, len(servers))
+	for _, srv := range servers {
+		result = append(result, clusterServer{
+			ID:       string(srv.ID),
+			Address:  string(srv.Address),
+			Suffrage: srv.Suffrage.String(),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+type clusterMember struct {
+	ID       string `json:"id"`
+	Address  string `json:"address"`
+	Suffrage string `json:"suffrage"`
+	Leader   bool   `json:"leader"`
+
+	// Replication progress is only known to the leader.
+	LastContact    *time.Time `json:"last_contact,omitempty"`
+	LastLogIndex   *uint64    `json:"last_log_index,omitempty"`
+	ReplicationLag *uint64    `json:"replication_lag,omitempty"`
+}
+
+type clusterDetails struct {
+	ClusterID    string          `json:"cluster_id,omitempty"`
+	NodeID       string          `json:"node_id"`
+	State        string          `json:"state"`
+	LeaderID     string          `json:"leader_id"`
+	LeaderAddr   string          `json:"leader_addr"`
+	Term         uint64          `json:"term"`
+	LastLogIndex uint64          `json:"last_log_index"`
+	CommitIndex  uint64          `json:"commit_index"`
+	AppliedIndex uint64          `json:"applied_index"`
+	LastContact  *time.Time      `json:"last_contact,omitempty"`
+	Servers      []clusterMember `json:"servers"`
+}
+
+// GetCluster describes the cluster as this node sees it. On the leader every
+// follower also reports when it last answered and how many log entries it
+// trails the leader by.
+func (h *Handler) GetCluster(w http.ResponseWriter, r *http.Request) {
+	servers, err := h.raftServer.Servers()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	stats := h.raftServer.Stats()
+	nodeID := h.raftServer.GetNodeID()
+	isLeader := h.raftServer.IsLeader()
+
+	details := clusterDetails{
+		ClusterID:    h.raftServer.ClusterID(),
+		NodeID:       nodeID,
+		State:        stats.State.String(),
+		LeaderID:     h.raftServer.LeaderID(),
+		LeaderAddr:   h.raftServer.LeaderAddr(),
+		Term:         stats.Term,
+		LastLogIndex: stats.LastLogIndex,
+		CommitIndex:  stats.CommitIndex,
+		AppliedIndex: stats.AppliedIndex,
+		Servers:      make([]clusterMember, 0, len(servers)),
+	}
+	if !isLeader && !stats.LastContact.IsZero() {
+		details.LastContact = &stats.LastContact
+	}
+
+	for _, srv := range servers {
+		member := clusterMember{
+			ID:       string(srv.ID),
+			Address:  string(srv.Address),
+			Suffrage: srv.Suffrage.String(),
+			Leader:   string(srv.ID) == details.LeaderID,
+		}
+
+		if isLeader && string(srv.ID) != nodeID {
+			if progress, found := h.raftServer.PeerProgress(string(srv.ID)); found {
+				lag := uint64(0)
+				if stats.LastLogIndex > progress.LastLogIndex {
+					lag = stats.LastLogIndex - progress.LastLogIndex
+				}
+				member.LastContact = &progress.LastContact
+				member.LastLogIndex = &progress.LastLogIndex
+				member.ReplicationLag = &lag
+			}
+		}
+
+		details.Servers = append(details.Servers, member)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(details)
+}
+
+func (h *Handler) JoinCluster(w http.ResponseWriter, r *http.Request) {
+	if !h.isLeader(w) {
+		return
+	}
+
+	var request struct {
+		NodeID   string `json:"node_id"`
+		RaftAddr string `json:"raft_addr"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if request.NodeID == "" || request.RaftAddr == "" {
+		http.Error(w, "node_id and raft_addr are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.raftServer.Join(request.NodeID, request.RaftAddr); err != nil {
+		http.Error(w, fmt.Sprintf("failed to join node: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(request)
+}
+
+func (h *Handler) RemoveClusterServer(w http.ResponseWriter, r *http.Request) {
+	if !h.isLeader(w) {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if err := h.raftServer.Remove(id); err != nil {
+		http.Error(w, fmt.Sprintf("failed to remove node: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TransferLeadership hands leadership to the node named in the request, or
+// to the most up-to-date follower when none is named, so that this node can
+// be taken down without an election.
+func (h *Handler) TransferLeadership(w http.ResponseWriter, r *http.Request) {
+	if !h.isLeader(w) {
+		return
+	}
+
+	var request struct {
+		NodeID string `json:"node_id"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	leaderID, err := h.raftServer.TransferLeadership(request.NodeID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to transfer leadership: %v", err), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"leader_id": leaderID})
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+)
+
+// Drain prepares the node to shut down: writes are refused with 503,
+// /readyz reports the node as not ready and open event streams end, so that
+// http.Server.Shutdown only waits for requests already in flight.
+func (h *Handler) Drain() {
+	h.drainOnce.Do(func() { close(h.drainCh) })
+}
+
+func (h *Handler) draining() bool {
+	select {
+	case <-h.drainCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// rejectWritesWhileDraining refuses requests that may change state once the
+// node is draining. Clients retry them against another node.
+func (h *Handler) rejectWritesWhileDraining(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if h.draining() {
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "node is shutting down", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/raft3d/pkg/events"
+)
+
+// EnableEvents serves the event stream from the given broker.
+func (h *Handler) EnableEvents(broker *events.Broker) {
+	h.events = broker
+}
+
+// StreamEvents streams a tenant's events as server-sent events. Clients may
+// narrow the stream with ?type=a,b and resume with the Last-Event-ID header.
+func (h *Handler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	if h.events == nil {
+		http.Error(w, "event stream is not enabled", http.StatusNotFound)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	tenant := tenantID(r)
+	types := make(map[string]bool)
+	if filter := r.URL.Query().Get("type"); filter != "" {
+		for _, t := range strings.Split(filter, ",") {
+			types[strings.TrimSpace(t)] = true
+		}
+	}
+
+	ch, backlog, cancel, err := h.events.Subscribe(r.Header.Get("Last-Event-ID"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	send := func(e events.Event) error {
+		if e.TenantID != tenant || (len(types) > 0 && !types[e.Type]) {
+			return nil
+		}
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID(), e.Type, data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	for _, e := range backlog {
+		if err := send(e); err != nil {
+			return
+		}
+	}
+
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case e := <-ch:
+			if err := send(e); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-h.drainCh:
+			return
+		}
+	}
+}
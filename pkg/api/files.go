@@ -0,0 +1,217 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/raft3d/internal/fsm"
+	"github.com/raft3d/pkg/blob"
+	"github.com/raft3d/pkg/gcode"
+	"github.com/raft3d/pkg/models"
+)
+
+// EnableFiles serves file uploads from the local blob store. advertiseURL is
+// the base URL other nodes use to fetch uploaded contents from this node.
+func (h *Handler) EnableFiles(store *blob.Store, replicator *blob.Replicator, advertiseURL string) {
+	h.blobs = store
+	h.replicator = replicator
+	h.advertiseURL = advertiseURL
+}
+
+// UploadFile stores a file and records the tenant's upload of it. Uploads
+// that no print job of the tenant references are garbage collected once
+// they are older than the replicator's grace period, so jobs should be
+// created within that time.
+func (h *Handler) UploadFile(w http.ResponseWriter, r *http.Request) {
+	if h.blobs == nil {
+		http.Error(w, "file storage is not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	if !h.isLeader(w) {
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "name query parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	hash, size, err := h.blobs.Put(r.Body, h.replicator.MaxSize)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to store file: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	tenant := tenantID(r)
+	now := time.Now().UTC()
+	manifest := models.FileManifest{
+		Hash:        hash,
+		Name:        name,
+		Size:        size,
+		ContentType: contentType,
+		UploadedAt:  now,
+		Sources:     []string{h.advertiseURL},
+		Owners:      []models.FileOwner{{TenantID: tenant, Name: name, UploadedAt: now}},
+	}
+
+	if gcode.IsGCode(name) {
+		analysis, err := h.analyzeFile(hash)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to analyze G-code: %v", err), http.StatusBadRequest)
+			return
+		}
+		manifest.Analysis = analysis
+	}
+
+	manifestData, err := json.Marshal(manifest)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal file manifest: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	cmd := fsm.Command{
+		Op:         fsm.OpCreate,
+		EntityType: fsm.EntityFile,
+		Payload:    manifestData,
+	}
+
+	_, err = h.applyCommand(r, &cmd)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to create file: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	stored, _ := h.fsm.Store().GetTenantFile(tenant, hash)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(stored)
+}
+
+func (h *Handler) analyzeFile(hash string) (*models.GCodeAnalysis, error) {
+	file, err := h.blobs.Open(hash)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return gcode.Analyze(file)
+}
+
+func (h *Handler) ListFiles(w http.ResponseWriter, r *http.Request) {
+	files := h.fsm.Store().GetTenantFiles(tenantID(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(files)
+}
+
+func (h *Handler) GetFile(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	hash := vars["hash"]
+
+	manifest, found := h.fsm.Store().GetTenantFile(tenantID(r), hash)
+	if !found {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(manifest)
+}
+
+// GetFileContent serves the bytes of a file the tenant uploaded. A node that
+// has not replicated the file yet fetches it from a source first.
+func (h *Handler) GetFileContent(w http.ResponseWriter, r *http.Request) {
+	if h.blobs == nil {
+		http.Error(w, "file storage is not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	manifest, found := h.fsm.Store().GetTenantFile(tenantID(r), mux.Vars(r)["hash"])
+	if !found {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+
+	if !h.blobs.Has(manifest.Hash) {
+		if err := h.replicator.Fetch(r.Context(), manifest); err != nil {
+			http.Error(w, fmt.Sprintf("failed to fetch file: %v", err), http.StatusBadGateway)
+			return
+		}
+	}
+
+	h.serveFile(w, r, manifest)
+}
+
+// GetPeerFileContent serves the bytes of a file to another node's
+// replicator, only if this node holds them already.
+func (h *Handler) GetPeerFileContent(w http.ResponseWriter, r *http.Request) {
+	if h.blobs == nil {
+		http.Error(w, "file storage is not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	manifest, found := h.fsm.Store().GetFile(mux.Vars(r)["hash"])
+	if !found {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+
+	if !h.blobs.Has(manifest.Hash) {
+		http.Error(w, "file not replicated to this node", http.StatusNotFound)
+		return
+	}
+
+	h.serveFile(w, r, manifest)
+}
+
+func (h *Handler) serveFile(w http.ResponseWriter, r *http.Request, manifest *models.FileManifest) {
+	hash := manifest.Hash
+	file, err := h.blobs.Open(hash)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to open file: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", manifest.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", manifest.Name))
+	w.Header().Set("ETag", `"`+hash+`"`)
+	http.ServeContent(w, r, manifest.Name, manifest.UploadedAt, file)
+}
+
+func (h *Handler) DeleteFile(w http.ResponseWriter, r *http.Request) {
+	if !h.isLeader(w) {
+		return
+	}
+
+	idData, err := json.Marshal(fsm.EntityRef{TenantID: tenantID(r), ID: mux.Vars(r)["hash"]})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal ID: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	cmd := fsm.Command{
+		Op:         fsm.OpDelete,
+		EntityType: fsm.EntityFile,
+		Payload:    idData,
+	}
+
+	_, err = h.applyCommand(r, &cmd)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to delete file: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,45 +1,168 @@
 package api
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/raft3d/internal/fsm"
+	"github.com/raft3d/pkg/blob"
+	"github.com/raft3d/pkg/events"
+	"github.com/raft3d/pkg/logging"
+	"github.com/raft3d/pkg/metrics"
 	"github.com/raft3d/pkg/models"
+	"github.com/raft3d/pkg/printer"
 	"github.com/raft3d/pkg/raft"
+	"github.com/raft3d/pkg/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 // Handler manages HTTP requests for the Raft service
 type Handler struct {
 	raftServer *raft.Server
 	fsm        *fsm.FSM
+
+	authEnabled        bool
+	bootstrapTokenHash string
+	peerTokenHash      string
+
+	blobs        *blob.Store
+	replicator   *blob.Replicator
+	advertiseURL string
+
+	printers *printer.Manager
+	events   *events.Broker
+	metrics  *metrics.Metrics
+
+	// ReadyMaxLag is how many committed log entries this node may have left
+	// to apply before /readyz reports it as not ready.
+	ReadyMaxLag uint64
+	// Logger receives a line per request.
+	Logger *slog.Logger
+
+	drainCh   chan struct{}
+	drainOnce sync.Once
 }
 
 func NewHandler(raftServer *raft.Server, fsm *fsm.FSM) *Handler {
 	return &Handler{
-		raftServer: raftServer,
-		fsm:        fsm,
+		raftServer:  raftServer,
+		fsm:         fsm,
+		ReadyMaxLag: DefaultReadyMaxLag,
+		Logger:      slog.Default(),
+		drainCh:     make(chan struct{}),
 	}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
-	router.HandleFunc("/api/v1/printers", h.CreatePrinter).Methods("POST")
-	router.HandleFunc("/api/v1/printers", h.ListPrinters).Methods("GET")
-	router.HandleFunc("/api/v1/printers/{id}", h.GetPrinter).Methods("GET")
-
-	router.HandleFunc("/api/v1/filaments", h.CreateFilament).Methods("POST")
-	router.HandleFunc("/api/v1/filaments", h.ListFilaments).Methods("GET")
-	router.HandleFunc("/api/v1/filaments/{id}", h.GetFilament).Methods("GET")
-
-	router.HandleFunc("/api/v1/print_jobs", h.CreatePrintJob).Methods("POST")
-	router.HandleFunc("/api/v1/print_jobs", h.ListPrintJobs).Methods("GET")
-	router.HandleFunc("/api/v1/print_jobs/{id}", h.GetPrintJob).Methods("GET")
-	router.HandleFunc("/api/v1/print_jobs/{id}/status", h.UpdatePrintJobStatus).Methods("POST")
-
-	router.HandleFunc("/api/v1/status", h.GetNodeStatus).Methods("GET")
+	if h.metrics != nil {
+		router.Use(h.metrics.Middleware)
+	}
+	router.Use(h.traceRoute)
+	router.Use(h.rejectWritesWhileDraining)
+	router.Use(h.authenticate)
+
+	router.HandleFunc("/api/v1/tenants", h.requireGlobalRole(models.RoleAdmin, h.CreateTenant)).Methods("POST")
+	router.HandleFunc("/api/v1/tenants", h.requireGlobalRole(models.RoleAdmin, h.ListTenants)).Methods("GET")
+	router.HandleFunc("/api/v1/tenants/{tenant}", h.requireRole(models.RoleViewer, h.GetTenant)).Methods("GET")
+	router.HandleFunc("/api/v1/tenants/{tenant}", h.requireGlobalRole(models.RoleAdmin, h.UpdateTenant)).Methods("PUT")
+	router.HandleFunc("/api/v1/tenants/{tenant}", h.requireGlobalRole(models.RoleAdmin, h.DeleteTenant)).Methods("DELETE")
+
+	router.HandleFunc("/api/v1/materials", h.requireGlobalRole(models.RoleAdmin, h.CreateMaterial)).Methods("POST")
+	router.HandleFunc("/api/v1/materials", h.requireSharedRole(models.RoleViewer, h.ListMaterials)).Methods("GET")
+	router.HandleFunc("/api/v1/materials/{name}", h.requireSharedRole(models.RoleViewer, h.GetMaterial)).Methods("GET")
+	router.HandleFunc("/api/v1/materials/{name}", h.requireGlobalRole(models.RoleAdmin, h.UpdateMaterial)).Methods("PUT")
+	router.HandleFunc("/api/v1/materials/{name}", h.requireGlobalRole(models.RoleAdmin, h.DeleteMaterial)).Methods("DELETE")
+
+	// Tenant owned resources are served both at the top level, for the
+	// default tenant, and below /api/v1/tenants/{tenant}.
+	for _, prefix := range []string{"/api/v1", "/api/v1/tenants/{tenant}"} {
+		router.HandleFunc(prefix+"/printers", h.requireRole(models.RoleOperator, h.CreatePrinter)).Methods("POST")
+		router.HandleFunc(prefix+"/printers", h.requireRole(models.RoleViewer, h.ListPrinters)).Methods("GET")
+		router.HandleFunc(prefix+"/printers/{id}", h.requireRole(models.RoleViewer, h.GetPrinter)).Methods("GET")
+		router.HandleFunc(prefix+"/printers/{id}", h.requireRole(models.RoleAdmin, h.DeletePrinter)).Methods("DELETE")
+		router.HandleFunc(prefix+"/printers/{id}/telemetry", h.requireRole(models.RoleViewer, h.GetPrinterTelemetry)).Methods("GET")
+		router.HandleFunc(prefix+"/printers/{id}/clear", h.requireRole(models.RoleOperator, h.ClearPrinterBed)).Methods("POST")
+		router.HandleFunc(prefix+"/printers/{id}/spools", h.requireRole(models.RoleViewer, h.ListSpools)).Methods("GET")
+		router.HandleFunc(prefix+"/printers/{id}/spools", h.requireRole(models.RoleOperator, h.LoadSpool)).Methods("POST")
+		router.HandleFunc(prefix+"/printers/{id}/spools/{slot}", h.requireRole(models.RoleOperator, h.UnloadSpool)).Methods("DELETE")
+
+		router.HandleFunc(prefix+"/filaments", h.requireRole(models.RoleOperator, h.CreateFilament)).Methods("POST")
+		router.HandleFunc(prefix+"/filaments", h.requireRole(models.RoleViewer, h.ListFilaments)).Methods("GET")
+		router.HandleFunc(prefix+"/filaments/{id}", h.requireRole(models.RoleViewer, h.GetFilament)).Methods("GET")
+		router.HandleFunc(prefix+"/filaments/{id}", h.requireRole(models.RoleAdmin, h.DeleteFilament)).Methods("DELETE")
+
+		router.HandleFunc(prefix+"/print_jobs", h.requireRole(models.RoleOperator, h.CreatePrintJob)).Methods("POST")
+		router.HandleFunc(prefix+"/print_jobs", h.requireRole(models.RoleViewer, h.ListPrintJobs)).Methods("GET")
+		router.HandleFunc(prefix+"/print_jobs/{id}", h.requireRole(models.RoleViewer, h.GetPrintJob)).Methods("GET")
+		router.HandleFunc(prefix+"/print_jobs/{id}", h.requireRole(models.RoleAdmin, h.DeletePrintJob)).Methods("DELETE")
+		router.HandleFunc(prefix+"/print_jobs/{id}/status", h.requireRole(models.RoleOperator, h.UpdatePrintJobStatus)).Methods("POST")
+
+		router.HandleFunc(prefix+"/print_jobs/{id}/dependencies", h.requireRole(models.RoleOperator, h.AddPrintJobDependency)).Methods("POST")
+		router.HandleFunc(prefix+"/print_jobs/{id}/dependencies/{dep}", h.requireRole(models.RoleOperator, h.RemovePrintJobDependency)).Methods("DELETE")
+
+		router.HandleFunc(prefix+"/batches", h.requireRole(models.RoleOperator, h.CreateBatch)).Methods("POST")
+		router.HandleFunc(prefix+"/batches", h.requireRole(models.RoleViewer, h.ListBatches)).Methods("GET")
+		router.HandleFunc(prefix+"/batches/{id}", h.requireRole(models.RoleViewer, h.GetBatch)).Methods("GET")
+		router.HandleFunc(prefix+"/batches/{id}", h.requireRole(models.RoleOperator, h.UpdateBatch)).Methods("PUT")
+		router.HandleFunc(prefix+"/batches/{id}", h.requireRole(models.RoleAdmin, h.DeleteBatch)).Methods("DELETE")
+		router.HandleFunc(prefix+"/batches/{id}/cancel", h.requireRole(models.RoleOperator, h.CancelBatch)).Methods("POST")
+
+		router.HandleFunc(prefix+"/queue", h.requireRole(models.RoleViewer, h.GetQueue)).Methods("GET")
+
+		router.HandleFunc(prefix+"/files", h.requireRole(models.RoleOperator, h.UploadFile)).Methods("POST")
+		router.HandleFunc(prefix+"/files", h.requireRole(models.RoleViewer, h.ListFiles)).Methods("GET")
+		router.HandleFunc(prefix+"/files/{hash}", h.requireRole(models.RoleViewer, h.GetFile)).Methods("GET")
+		router.HandleFunc(prefix+"/files/{hash}", h.requireRole(models.RoleAdmin, h.DeleteFile)).Methods("DELETE")
+		router.HandleFunc(prefix+"/files/{hash}/content", h.requireRole(models.RoleViewer, h.GetFileContent)).Methods("GET")
+
+		router.HandleFunc(prefix+"/alerts", h.requireRole(models.RoleViewer, h.ListAlerts)).Methods("GET")
+		router.HandleFunc(prefix+"/alerts/{id}", h.requireRole(models.RoleOperator, h.DeleteAlert)).Methods("DELETE")
+		router.HandleFunc(prefix+"/events", h.requireRole(models.RoleViewer, h.StreamEvents)).Methods("GET")
+
+		router.HandleFunc(prefix+"/webhooks", h.requireRole(models.RoleAdmin, h.CreateWebhook)).Methods("POST")
+		router.HandleFunc(prefix+"/webhooks", h.requireRole(models.RoleViewer, h.ListWebhooks)).Methods("GET")
+		router.HandleFunc(prefix+"/webhooks/{id}", h.requireRole(models.RoleViewer, h.GetWebhook)).Methods("GET")
+		router.HandleFunc(prefix+"/webhooks/{id}", h.requireRole(models.RoleAdmin, h.UpdateWebhook)).Methods("PUT")
+		router.HandleFunc(prefix+"/webhooks/{id}", h.requireRole(models.RoleAdmin, h.DeleteWebhook)).Methods("DELETE")
+		router.HandleFunc(prefix+"/webhooks/{id}/deliveries", h.requireRole(models.RoleViewer, h.ListWebhookDeliveries)).Methods("GET")
+	}
+
+	// Version 2 of the print job API lists the filament slots of
+	// multi-material jobs; everything else is shared with version 1.
+	for _, prefix := range []string{"/api/v2", "/api/v2/tenants/{tenant}"} {
+		router.HandleFunc(prefix+"/print_jobs", h.requireRole(models.RoleOperator, h.CreatePrintJobV2)).Methods("POST")
+		router.HandleFunc(prefix+"/print_jobs", h.requireRole(models.RoleViewer, h.ListPrintJobsV2)).Methods("GET")
+		router.HandleFunc(prefix+"/print_jobs/{id}", h.requireRole(models.RoleViewer, h.GetPrintJobV2)).Methods("GET")
+		router.HandleFunc(prefix+"/print_jobs/{id}", h.requireRole(models.RoleAdmin, h.DeletePrintJob)).Methods("DELETE")
+		router.HandleFunc(prefix+"/print_jobs/{id}/status", h.requireRole(models.RoleOperator, h.UpdatePrintJobStatus)).Methods("POST")
+	}
+
+	router.HandleFunc("/api/v1/tokens", h.requireGlobalRole(models.RoleAdmin, h.CreateToken)).Methods("POST")
+	router.HandleFunc("/api/v1/tokens", h.requireGlobalRole(models.RoleAdmin, h.ListTokens)).Methods("GET")
+	router.HandleFunc("/api/v1/tokens/{id}", h.requireGlobalRole(models.RoleAdmin, h.DeleteToken)).Methods("DELETE")
+
+	router.HandleFunc("/api/v1/cluster", h.requireSharedRole(models.RoleViewer, h.GetCluster)).Methods("GET")
+	router.HandleFunc("/api/v1/cluster/servers", h.requireRoleOrPeer(models.RoleViewer, scopeShared, h.ListClusterServers)).Methods("GET")
+	router.HandleFunc("/api/v1/cluster/servers", h.requireRoleOrPeer(models.RoleAdmin, scopeGlobal, h.JoinCluster)).Methods("POST")
+	router.HandleFunc("/api/v1/cluster/servers/{id}", h.requireGlobalRole(models.RoleAdmin, h.RemoveClusterServer)).Methods("DELETE")
+	router.HandleFunc("/api/v1/cluster/leadership/transfer", h.requireGlobalRole(models.RoleAdmin, h.TransferLeadership)).Methods("POST")
+
+	router.HandleFunc("/api/v1/status", h.requireSharedRole(models.RoleViewer, h.GetNodeStatus)).Methods("GET")
+
+	// Nodes fetch file contents from each other regardless of tenant.
+	router.HandleFunc("/internal/v1/files/{hash}", h.requirePeer(h.GetPeerFileContent)).Methods("GET")
+
+	router.HandleFunc("/metrics", h.requireGlobalRole(models.RoleViewer, h.GetMetrics)).Methods("GET")
+
+	// Probes carry no credentials.
+	router.HandleFunc("/healthz", h.Healthz).Methods("GET")
+	router.HandleFunc("/readyz", h.Readyz).Methods("GET")
 }
 
 func (h *Handler) isLeader(w http.ResponseWriter) bool {
@@ -51,13 +174,21 @@ func (h *Handler) isLeader(w http.ResponseWriter) bool {
 	return true
 }
 
-func (h *Handler) applyCommand(cmd *fsm.Command) (interface{}, error) {
-	data, err := json.Marshal(cmd)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal command: %v", err)
-	}
+// applyCommand applies a command proposed by an API request, tagged with the
+// request's ID and trace context.
+func (h *Handler) applyCommand(r *http.Request, cmd *fsm.Command) (interface{}, error) {
+	cmd.RequestID = logging.RequestID(r.Context())
+	cmd.TraceContext = tracing.Inject(r.Context())
+	return h.raftServer.ApplyCommand(cmd, 5*time.Second)
+}
 
-	return h.raftServer.Apply(data, 5*time.Second)
+// tenantID returns the tenant a request is scoped to. Routes without a
+// tenant prefix operate on the default tenant.
+func tenantID(r *http.Request) string {
+	if id := mux.Vars(r)["tenant"]; id != "" {
+		return id
+	}
+	return models.DefaultTenant
 }
 
 func (h *Handler) CreatePrinter(w http.ResponseWriter, r *http.Request) {
@@ -71,6 +202,8 @@ func (h *Handler) CreatePrinter(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	printer.TenantID = tenantID(r)
+
 	if err := printer.Validate(); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -88,7 +221,7 @@ func (h *Handler) CreatePrinter(w http.ResponseWriter, r *http.Request) {
 		Payload:    printerData,
 	}
 
-	_, err = h.applyCommand(&cmd)
+	_, err = h.applyCommand(r, &cmd)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("failed to create printer: %v", err), http.StatusInternalServerError)
 		return
@@ -100,7 +233,10 @@ func (h *Handler) CreatePrinter(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) ListPrinters(w http.ResponseWriter, r *http.Request) {
-	printers := h.fsm.Store().GetPrinters()
+	printers := h.fsm.Store().GetPrinters(tenantID(r))
+	for i, p := range printers {
+		printers[i] = redactPrinter(p)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(printers)
@@ -110,14 +246,14 @@ func (h *Handler) GetPrinter(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	printer, found := h.fsm.Store().GetPrinter(id)
+	printer, found := h.fsm.Store().GetPrinter(tenantID(r), id)
 	if !found {
 		http.Error(w, "printer not found", http.StatusNotFound)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(printer)
+	json.NewEncoder(w).Encode(redactPrinter(printer))
 }
 
 func (h *Handler) CreateFilament(w http.ResponseWriter, r *http.Request) {
@@ -131,6 +267,8 @@ func (h *Handler) CreateFilament(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	filament.TenantID = tenantID(r)
+
 	if err := filament.Validate(); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -148,7 +286,7 @@ func (h *Handler) CreateFilament(w http.ResponseWriter, r *http.Request) {
 		Payload:    filamentData,
 	}
 
-	_, err = h.applyCommand(&cmd)
+	_, err = h.applyCommand(r, &cmd)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("failed to create filament: %v", err), http.StatusInternalServerError)
 		return
@@ -160,7 +298,7 @@ func (h *Handler) CreateFilament(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) ListFilaments(w http.ResponseWriter, r *http.Request) {
-	filaments := h.fsm.Store().GetFilaments()
+	filaments := h.fsm.Store().GetFilaments(tenantID(r))
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(filaments)
@@ -170,7 +308,7 @@ func (h *Handler) GetFilament(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	filament, found := h.fsm.Store().GetFilament(id)
+	filament, found := h.fsm.Store().GetFilament(tenantID(r), id)
 	if !found {
 		http.Error(w, "filament not found", http.StatusNotFound)
 		return
@@ -191,7 +329,19 @@ func (h *Handler) CreatePrintJob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Version 1 jobs use a single filament; multi-material jobs are created
+	// through version 2.
+	printJob.Filaments = nil
+
+	h.createPrintJob(w, r, &printJob, printJobV1)
+}
+
+func (h *Handler) createPrintJob(w http.ResponseWriter, r *http.Request, printJob *models.PrintJob, render func(*models.PrintJob) *models.PrintJob) {
+	printJob.TenantID = tenantID(r)
 	printJob.Status = models.StatusQueued
+	if token := tokenFromContext(r.Context()); token != nil {
+		printJob.SubmittedBy = token.ID
+	}
 
 	printJobData, err := json.Marshal(printJob)
 	if err != nil {
@@ -205,7 +355,7 @@ func (h *Handler) CreatePrintJob(w http.ResponseWriter, r *http.Request) {
 		Payload:    printJobData,
 	}
 
-	result, err := h.applyCommand(&cmd)
+	result, err := h.applyCommand(r, &cmd)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("failed to create print job: %v", err), http.StatusInternalServerError)
 		return
@@ -218,30 +368,48 @@ func (h *Handler) CreatePrintJob(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// The FSM may fill in fields derived from the G-code file.
+	if stored, found := h.fsm.Store().GetPrintJob(printJob.TenantID, printJob.ID); found {
+		printJob = stored
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(printJob)
+	json.NewEncoder(w).Encode(render(printJob))
 }
 
 func (h *Handler) ListPrintJobs(w http.ResponseWriter, r *http.Request) {
-	printJobs := h.fsm.Store().GetPrintJobs()
+	h.listPrintJobs(w, r, printJobV1)
+}
+
+func (h *Handler) listPrintJobs(w http.ResponseWriter, r *http.Request, render func(*models.PrintJob) *models.PrintJob) {
+	printJobs := h.fsm.Store().GetPrintJobs(tenantID(r))
+
+	rendered := make([]*models.PrintJob, 0, len(printJobs))
+	for _, j := range printJobs {
+		rendered = append(rendered, render(j))
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(printJobs)
+	json.NewEncoder(w).Encode(rendered)
 }
 
 func (h *Handler) GetPrintJob(w http.ResponseWriter, r *http.Request) {
+	h.getPrintJob(w, r, printJobV1)
+}
+
+func (h *Handler) getPrintJob(w http.ResponseWriter, r *http.Request, render func(*models.PrintJob) *models.PrintJob) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	printJob, found := h.fsm.Store().GetPrintJob(id)
+	printJob, found := h.fsm.Store().GetPrintJob(tenantID(r), id)
 	if !found {
 		http.Error(w, "print job not found", http.StatusNotFound)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(printJob)
+	json.NewEncoder(w).Encode(render(printJob))
 }
 
 func (h *Handler) UpdatePrintJobStatus(w http.ResponseWriter, r *http.Request) {
@@ -261,15 +429,16 @@ func (h *Handler) UpdatePrintJobStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, found := h.fsm.Store().GetPrintJob(id)
+	_, found := h.fsm.Store().GetPrintJob(tenantID(r), id)
 	if !found {
 		http.Error(w, "print job not found", http.StatusNotFound)
 		return
 	}
 
 	statusChange := fsm.PrintJobStatusChange{
-		ID:     id,
-		Status: statusUpdate.Status,
+		ID:       id,
+		TenantID: tenantID(r),
+		Status:   statusUpdate.Status,
 	}
 
 	statusData, err := json.Marshal(statusChange)
@@ -284,7 +453,7 @@ func (h *Handler) UpdatePrintJobStatus(w http.ResponseWriter, r *http.Request) {
 		Payload:    statusData,
 	}
 
-	result, err := h.applyCommand(&cmd)
+	result, err := h.applyCommand(r, &cmd)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("failed to update print job status: %v", err), http.StatusInternalServerError)
 		return
@@ -302,6 +471,47 @@ func (h *Handler) UpdatePrintJobStatus(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"id": id, "status": statusUpdate.Status})
 }
 
+func (h *Handler) DeletePrinter(w http.ResponseWriter, r *http.Request) {
+	h.deleteEntity(w, r, fsm.EntityPrinter, "printer")
+}
+
+func (h *Handler) DeleteFilament(w http.ResponseWriter, r *http.Request) {
+	h.deleteEntity(w, r, fsm.EntityFilament, "filament")
+}
+
+func (h *Handler) DeletePrintJob(w http.ResponseWriter, r *http.Request) {
+	h.deleteEntity(w, r, fsm.EntityPrintJob, "print job")
+}
+
+func (h *Handler) deleteEntity(w http.ResponseWriter, r *http.Request, entityType, name string) {
+	if !h.isLeader(w) {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	idData, err := json.Marshal(fsm.EntityRef{TenantID: tenantID(r), ID: id})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal ID: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	cmd := fsm.Command{
+		Op:         fsm.OpDelete,
+		EntityType: entityType,
+		Payload:    idData,
+	}
+
+	_, err = h.applyCommand(r, &cmd)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to delete %s: %v", name, err), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (h *Handler) GetNodeStatus(w http.ResponseWriter, r *http.Request) {
 	isLeader := h.raftServer.IsLeader()
 	leaderAddr := h.raftServer.LeaderAddr()
@@ -324,14 +534,30 @@ func (h *Handler) GetNodeStatus(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(status)
 }
 
-func StartServer(handler *Handler, addr string) error {
+// NewServer returns the HTTP server of the API. It serves HTTPS when
+// tlsConfig is set.
+func NewServer(handler *Handler, addr string, tlsConfig *tls.Config) *http.Server {
 	router := mux.NewRouter()
 	handler.RegisterRoutes(router)
 
-	server := &http.Server{
-		Addr:    addr,
-		Handler: router,
+	return &http.Server{
+		Addr:      addr,
+		Handler:   otelhttp.NewHandler(handler.logRequests(router), "http.request"),
+		TLSConfig: tlsConfig,
 	}
+}
 
-	return server.ListenAndServe()
+// Serve runs server until it fails or is shut down, in which case it
+// returns nil.
+func Serve(server *http.Server) error {
+	var err error
+	if server.TLSConfig != nil {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
 }
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// DefaultReadyMaxLag is how many committed log entries a node may have left
+// to apply and still be ready.
+const DefaultReadyMaxLag = 100
+
+type readinessCheck struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// Healthz reports that the process is alive and serving HTTP.
+func (h *Handler) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("ok\n"))
+}
+
+// Readyz reports whether this node can serve requests: it is not shutting
+// down, knows the leader, has restored its state machine from disk and is not
+// too far behind the commit index. It answers 503 otherwise so load balancers
+// skip the node.
+func (h *Handler) Readyz(w http.ResponseWriter, r *http.Request) {
+	stats := h.raftServer.Stats()
+	leaderAddr := h.raftServer.LeaderAddr()
+
+	checks := []readinessCheck{
+		{Name: "leader", OK: leaderAddr != ""},
+		{Name: "restored", OK: h.raftServer.Restored()},
+		{Name: "applied", OK: stats.CommitIndex <= stats.AppliedIndex+h.ReadyMaxLag},
+		{Name: "serving", OK: !h.draining()},
+	}
+	if !checks[0].OK {
+		checks[0].Message = "no known leader"
+	}
+	if !checks[1].OK {
+		checks[1].Message = "state machine is still replaying the local log"
+	}
+	if !checks[2].OK {
+		checks[2].Message = fmt.Sprintf("applied index %d trails commit index %d", stats.AppliedIndex, stats.CommitIndex)
+	}
+	if !checks[3].OK {
+		checks[3].Message = "node is shutting down"
+	}
+
+	ready := true
+	for _, c := range checks {
+		ready = ready && c.OK
+	}
+
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Ready  bool             `json:"ready"`
+		Checks []readinessCheck `json:"checks"`
+	}{
+		Ready:  ready,
+		Checks: checks,
+	})
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/raft3d/pkg/logging"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requestIDHeader carries the request ID. A caller may supply its own to
+// correlate our logs with theirs; it is echoed in the response.
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds caller supplied request IDs.
+const maxRequestIDLength = 128
+
+// quietPaths are polled by probes and scrapers and only logged at debug
+// level.
+var quietPaths = map[string]bool{"/healthz": true, "/readyz": true, "/metrics": true}
+
+// logRequests tags every request with an ID, which applyCommand passes on to
+// the state machine, and logs the request once it has been served.
+func (h *Handler) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = logging.NewRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		r = r.WithContext(logging.WithRequestID(r.Context(), id))
+
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		level := slog.LevelInfo
+		if quietPaths[r.URL.Path] {
+			level = slog.LevelDebug
+		}
+		h.Logger.Log(r.Context(), level, "served request",
+			"request_id", id,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration_ms", float64(time.Since(start).Microseconds())/1000,
+			"remote", r.RemoteAddr,
+		)
+	})
+}
+
+// responseRecorder remembers the status code written to a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush keeps streaming responses such as the event stream working.
+func (r *responseRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// traceRoute names the request's span after the matched route template, so
+// that spans of requests for different IDs group together.
+func (h *Handler) traceRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := trace.SpanFromContext(r.Context())
+		if route := mux.CurrentRoute(r); route != nil {
+			if tpl, err := route.GetPathTemplate(); err == nil {
+				span.SetName(r.Method + " " + tpl)
+				span.SetAttributes(semconv.HTTPRoute(tpl))
+			}
+		}
+		span.SetAttributes(attribute.String("raft3d.request_id", logging.RequestID(r.Context())))
+
+		next.ServeHTTP(w, r)
+	})
+}
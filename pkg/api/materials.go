@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/raft3d/internal/fsm"
+	"github.com/raft3d/pkg/models"
+)
+
+func (h *Handler) CreateMaterial(w http.ResponseWriter, r *http.Request) {
+	h.writeMaterial(w, r, fsm.OpCreate, http.StatusCreated)
+}
+
+func (h *Handler) UpdateMaterial(w http.ResponseWriter, r *http.Request) {
+	h.writeMaterial(w, r, fsm.OpUpdate, http.StatusOK)
+}
+
+func (h *Handler) writeMaterial(w http.ResponseWriter, r *http.Request, op string, status int) {
+	if !h.isLeader(w) {
+		return
+	}
+
+	var material models.Material
+	if err := json.NewDecoder(r.Body).Decode(&material); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if op == fsm.OpUpdate {
+		material.Name = mux.Vars(r)["name"]
+	}
+
+	if err := material.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	materialData, err := json.Marshal(material)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal material data: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	cmd := fsm.Command{
+		Op:         op,
+		EntityType: fsm.EntityMaterial,
+		Payload:    materialData,
+	}
+
+	_, err = h.applyCommand(r, &cmd)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to save material: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(material)
+}
+
+func (h *Handler) ListMaterials(w http.ResponseWriter, r *http.Request) {
+	materials := h.fsm.Store().GetMaterials()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(materials)
+}
+
+func (h *Handler) GetMaterial(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["name"]
+
+	material, found := h.fsm.Store().GetMaterial(name)
+	if !found {
+		http.Error(w, "material not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(material)
+}
+
+func (h *Handler) DeleteMaterial(w http.ResponseWriter, r *http.Request) {
+	if !h.isLeader(w) {
+		return
+	}
+
+	idData, err := json.Marshal(fsm.EntityRef{ID: mux.Vars(r)["name"]})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal ID: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	cmd := fsm.Command{
+		Op:         fsm.OpDelete,
+		EntityType: fsm.EntityMaterial,
+		Payload:    idData,
+	}
+
+	_, err = h.applyCommand(r, &cmd)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to delete material: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/raft3d/pkg/metrics"
+)
+
+// EnableMetrics serves /metrics and records HTTP request metrics. It must be
+// called before the routes are registered.
+func (h *Handler) EnableMetrics(m *metrics.Metrics) {
+	h.metrics = m
+}
+
+// GetMetrics serves the node's metrics to Prometheus. They cover every
+// tenant, so a tenant scoped token cannot read them.
+func (h *Handler) GetMetrics(w http.ResponseWriter, r *http.Request) {
+	if h.metrics == nil {
+		http.Error(w, "metrics are not enabled", http.StatusNotFound)
+		return
+	}
+
+	h.metrics.Handler().ServeHTTP(w, r)
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/raft3d/internal/fsm"
+	"github.com/raft3d/pkg/models"
+	"github.com/raft3d/pkg/printer"
+)
+
+// EnablePrinters exposes telemetry collected by the printer manager.
+func (h *Handler) EnablePrinters(manager *printer.Manager) {
+	h.printers = manager
+}
+
+// redactPrinter hides the API key of a printer's connection from responses.
+func redactPrinter(p *models.Printer) *models.Printer {
+	if p.Connection == nil || p.Connection.APIKey == "" {
+		return p
+	}
+	redacted := *p
+	conn := *p.Connection
+	conn.APIKey = "redacted"
+	redacted.Connection = &conn
+	return &redacted
+}
+
+func (h *Handler) GetPrinterTelemetry(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if _, found := h.fsm.Store().GetPrinter(tenantID(r), id); !found {
+		http.Error(w, "printer not found", http.StatusNotFound)
+		return
+	}
+
+	if !h.isLeader(w) {
+		return
+	}
+
+	if h.printers == nil {
+		http.Error(w, "printer connections are not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	status, found := h.printers.Telemetry(tenantID(r), id)
+	if !found {
+		http.Error(w, "no telemetry for printer", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// ClearPrinterBed records that the last print was taken off a printer, which
+// lets the leader start the next job on it.
+func (h *Handler) ClearPrinterBed(w http.ResponseWriter, r *http.Request) {
+	if !h.isLeader(w) {
+		return
+	}
+
+	tenant := tenantID(r)
+	id := mux.Vars(r)["id"]
+
+	refData, err := json.Marshal(fsm.EntityRef{TenantID: tenant, ID: id})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal ID: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	cmd := fsm.Command{
+		Op:         fsm.OpClearBed,
+		EntityType: fsm.EntityPrinter,
+		Payload:    refData,
+	}
+
+	if _, err := h.applyCommand(r, &cmd); err != nil {
+		http.Error(w, fmt.Sprintf("failed to clear printer bed: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	printer, _ := h.fsm.Store().GetPrinter(tenant, id)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(redactPrinter(printer))
+}
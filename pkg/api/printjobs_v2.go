@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/raft3d/pkg/models"
+)
+
+// printJobV1 renders a print job in the version 1 shape, which has a single
+// filament and total weight and no slot list.
+func printJobV1(j *models.PrintJob) *models.PrintJob {
+	if j.Filaments == nil {
+		return j
+	}
+	rendered := *j
+	rendered.Filaments = nil
+	return &rendered
+}
+
+// printJobV2 renders a print job in the version 2 shape, which always lists
+// its filament slots, including for jobs created through version 1.
+func printJobV2(j *models.PrintJob) *models.PrintJob {
+	if j.Filaments != nil {
+		return j
+	}
+	rendered := *j
+	rendered.Filaments = j.Slots()
+	return &rendered
+}
+
+// CreatePrintJobV2 creates a print job that may feed from several filaments,
+// listed in "filaments" with their slot and weight.
+func (h *Handler) CreatePrintJobV2(w http.ResponseWriter, r *http.Request) {
+	if !h.isLeader(w) {
+		return
+	}
+
+	var printJob models.PrintJob
+	if err := json.NewDecoder(r.Body).Decode(&printJob); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if len(printJob.Filaments) == 0 {
+		http.Error(w, "filaments cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	h.createPrintJob(w, r, &printJob, printJobV2)
+}
+
+func (h *Handler) ListPrintJobsV2(w http.ResponseWriter, r *http.Request) {
+	h.listPrintJobs(w, r, printJobV2)
+}
+
+func (h *Handler) GetPrintJobV2(w http.ResponseWriter, r *http.Request) {
+	h.getPrintJob(w, r, printJobV2)
+}
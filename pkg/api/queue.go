@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/raft3d/pkg/models"
+)
+
+// queueEntry is a queued print job with its position in the queue, or the
+// jobs it waits for if it is blocked by dependencies.
+type queueEntry struct {
+	Position  int      `json:"position,omitempty"`
+	BlockedBy []string `json:"blocked_by,omitempty"`
+	models.PrintJob
+}
+
+// GetQueue returns the effective print order of queued jobs, optionally
+// narrowed down with the printer_id or group query parameters. Jobs blocked
+// by dependencies follow without a position.
+func (h *Handler) GetQueue(w http.ResponseWriter, r *http.Request) {
+	tenant := tenantID(r)
+	printerID := r.URL.Query().Get("printer_id")
+	group := r.URL.Query().Get("group")
+
+	if printerID != "" {
+		if _, found := h.fsm.Store().GetPrinter(tenant, printerID); !found {
+			http.Error(w, "printer not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	queue := h.fsm.Store().GetQueue(tenant, printerID, group)
+
+	blocked := h.fsm.Store().GetBlockedJobs(tenant, printerID, group)
+
+	entries := make([]queueEntry, 0, len(queue)+len(blocked))
+	for i, job := range queue {
+		entries = append(entries, queueEntry{Position: i + 1, PrintJob: job})
+	}
+	for _, job := range blocked {
+		entries = append(entries, queueEntry{BlockedBy: job.BlockedBy, PrintJob: job.PrintJob})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/raft3d/internal/fsm"
+	"github.com/raft3d/pkg/models"
+)
+
+func (h *Handler) ListSpools(w http.ResponseWriter, r *http.Request) {
+	tenant := tenantID(r)
+	id := mux.Vars(r)["id"]
+
+	if _, found := h.fsm.Store().GetPrinter(tenant, id); !found {
+		http.Error(w, "printer not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.fsm.Store().GetSpools(tenant, id))
+}
+
+// LoadSpool records that a filament was mounted in a slot of a printer.
+func (h *Handler) LoadSpool(w http.ResponseWriter, r *http.Request) {
+	if !h.isLeader(w) {
+		return
+	}
+
+	var load models.SpoolLoad
+	if err := json.NewDecoder(r.Body).Decode(&load); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	load.TenantID = tenantID(r)
+	load.PrinterID = mux.Vars(r)["id"]
+
+	if err := load.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	loadData, err := json.Marshal(load)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal spool load: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	cmd := fsm.Command{
+		Op:         fsm.OpLoad,
+		EntityType: fsm.EntitySpool,
+		Payload:    loadData,
+	}
+
+	if _, err := h.applyCommand(r, &cmd); err != nil {
+		http.Error(w, fmt.Sprintf("failed to load spool: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(h.fsm.Store().GetSpools(load.TenantID, load.PrinterID))
+}
+
+// UnloadSpool records that the filament in a slot of a printer was removed.
+func (h *Handler) UnloadSpool(w http.ResponseWriter, r *http.Request) {
+	if !h.isLeader(w) {
+		return
+	}
+
+	vars := mux.Vars(r)
+	slot, err := strconv.Atoi(vars["slot"])
+	if err != nil {
+		http.Error(w, "slot must be a number", http.StatusBadRequest)
+		return
+	}
+
+	refData, err := json.Marshal(fsm.SpoolSlotRef{TenantID: tenantID(r), PrinterID: vars["id"], Slot: slot})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal spool slot: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	cmd := fsm.Command{
+		Op:         fsm.OpUnload,
+		EntityType: fsm.EntitySpool,
+		Payload:    refData,
+	}
+
+	if _, err := h.applyCommand(r, &cmd); err != nil {
+		http.Error(w, fmt.Sprintf("failed to unload spool: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/raft3d/internal/fsm"
+	"github.com/raft3d/pkg/models"
+)
+
+type tenantView struct {
+	*models.Tenant
+	Period        string `json:"period"`
+	UsedGrams     int    `json:"used_grams"`
+	QueuedJobs    int    `json:"queued_jobs"`
+	ReservedGrams int    `json:"reserved_grams"`
+}
+
+func (h *Handler) CreateTenant(w http.ResponseWriter, r *http.Request) {
+	h.writeTenant(w, r, fsm.OpCreate, http.StatusCreated)
+}
+
+func (h *Handler) UpdateTenant(w http.ResponseWriter, r *http.Request) {
+	h.writeTenant(w, r, fsm.OpUpdate, http.StatusOK)
+}
+
+func (h *Handler) writeTenant(w http.ResponseWriter, r *http.Request, op string, status int) {
+	if !h.isLeader(w) {
+		return
+	}
+
+	var tenant models.Tenant
+	if err := json.NewDecoder(r.Body).Decode(&tenant); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if op == fsm.OpUpdate {
+		tenant.ID = tenantID(r)
+	}
+
+	if err := tenant.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tenantData, err := json.Marshal(tenant)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal tenant data: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	cmd := fsm.Command{
+		Op:         op,
+		EntityType: fsm.EntityTenant,
+		Payload:    tenantData,
+	}
+
+	_, err = h.applyCommand(r, &cmd)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to save tenant: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(tenant)
+}
+
+func (h *Handler) ListTenants(w http.ResponseWriter, r *http.Request) {
+	tenants := h.fsm.Store().GetTenants()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tenants)
+}
+
+func (h *Handler) GetTenant(w http.ResponseWriter, r *http.Request) {
+	id := tenantID(r)
+
+	tenant, found := h.fsm.Store().GetTenant(id)
+	if !found {
+		http.Error(w, "tenant not found", http.StatusNotFound)
+		return
+	}
+
+	period := models.UsagePeriod(time.Now())
+	view := tenantView{
+		Tenant:    tenant,
+		Period:    period,
+		UsedGrams: h.fsm.Store().GetTenantUsage(id, period),
+	}
+
+	for _, j := range h.fsm.Store().GetPrintJobs(id) {
+		if j.Status == models.StatusQueued {
+			view.QueuedJobs++
+		}
+		if j.Status == models.StatusQueued || j.Status == models.StatusRunning {
+			view.ReservedGrams += j.PrintWeightInGrams
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
+
+func (h *Handler) DeleteTenant(w http.ResponseWriter, r *http.Request) {
+	if !h.isLeader(w) {
+		return
+	}
+
+	idData, err := json.Marshal(fsm.EntityRef{ID: tenantID(r)})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal ID: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	cmd := fsm.Command{
+		Op:         fsm.OpDelete,
+		EntityType: fsm.EntityTenant,
+		Payload:    idData,
+	}
+
+	_, err = h.applyCommand(r, &cmd)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to delete tenant: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
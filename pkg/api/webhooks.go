@@ -0,0 +1,153 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/raft3d/internal/fsm"
+	"github.com/raft3d/pkg/models"
+	"github.com/raft3d/pkg/webhooks"
+)
+
+// redactWebhook hides the signing secret of a webhook from responses.
+func redactWebhook(w *models.Webhook) *models.Webhook {
+	redacted := *w
+	redacted.Secret = "redacted"
+	return &redacted
+}
+
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	h.writeWebhook(w, r, fsm.OpCreate, http.StatusCreated)
+}
+
+func (h *Handler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	h.writeWebhook(w, r, fsm.OpUpdate, http.StatusOK)
+}
+
+func (h *Handler) writeWebhook(w http.ResponseWriter, r *http.Request, op string, status int) {
+	if !h.isLeader(w) {
+		return
+	}
+
+	var webhook models.Webhook
+	if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	webhook.TenantID = tenantID(r)
+	if op == fsm.OpUpdate {
+		webhook.ID = mux.Vars(r)["id"]
+	}
+
+	// The secret is only shown once: generated on creation unless supplied,
+	// and kept on update unless replaced.
+	showSecret := false
+	if webhook.Secret == "" {
+		if existing, found := h.fsm.Store().GetWebhook(webhook.TenantID, webhook.ID); op == fsm.OpUpdate && found {
+			webhook.Secret = existing.Secret
+		} else {
+			secret, err := randomHex(32)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("failed to generate secret: %v", err), http.StatusInternalServerError)
+				return
+			}
+			webhook.Secret = secret
+			showSecret = true
+		}
+	}
+
+	if err := webhook.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := webhooks.CheckURL(r.Context(), webhook.URL); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	webhookData, err := json.Marshal(webhook)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal webhook data: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	cmd := fsm.Command{
+		Op:         op,
+		EntityType: fsm.EntityWebhook,
+		Payload:    webhookData,
+	}
+
+	if _, err := h.applyCommand(r, &cmd); err != nil {
+		http.Error(w, fmt.Sprintf("failed to save webhook: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	response := redactWebhook(&webhook)
+	if stored, found := h.fsm.Store().GetWebhook(webhook.TenantID, webhook.ID); found {
+		response = redactWebhook(stored)
+	}
+	if showSecret {
+		response.Secret = webhook.Secret
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *Handler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks := h.fsm.Store().GetWebhooks(tenantID(r))
+
+	redacted := make([]*models.Webhook, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		redacted = append(redacted, redactWebhook(webhook))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(redacted)
+}
+
+func (h *Handler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, found := h.fsm.Store().GetWebhook(tenantID(r), mux.Vars(r)["id"])
+	if !found {
+		http.Error(w, "webhook not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(redactWebhook(webhook))
+}
+
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	h.deleteEntity(w, r, fsm.EntityWebhook, "webhook")
+}
+
+// ListWebhookDeliveries returns the pending deliveries of a webhook and a log
+// of its most recent finished ones.
+func (h *Handler) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	tenant := tenantID(r)
+	id := mux.Vars(r)["id"]
+
+	if _, found := h.fsm.Store().GetWebhook(tenant, id); !found {
+		http.Error(w, "webhook not found", http.StatusNotFound)
+		return
+	}
+
+	deliveries := h.fsm.Store().GetDeliveries(tenant, id)
+	if status := r.URL.Query().Get("status"); status != "" {
+		filtered := make([]*models.WebhookDelivery, 0)
+		for _, d := range deliveries {
+			if d.Status == status {
+				filtered = append(filtered, d)
+			}
+		}
+		deliveries = filtered
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
@@ -0,0 +1,167 @@
+package blob
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/raft3d/internal/fsm"
+	"github.com/raft3d/pkg/models"
+	"github.com/raft3d/pkg/raft"
+)
+
+// Replicator makes sure every node holds the contents of every committed file
+// manifest by fetching missing files from the nodes listed as sources. It also
+// garbage collects: the leader deletes manifests no print job references once
+// they are older than the grace period, and every node removes local files
+// that no longer have a manifest.
+type Replicator struct {
+	store      *Store
+	raftServer *raft.Server
+	fsm        *fsm.FSM
+	client     *http.Client
+
+	// AuthToken is the peer token sent when fetching from other nodes. Nodes
+	// using TLS client certificates do not need one.
+	AuthToken string
+	// Interval between synchronisation passes.
+	Interval time.Duration
+	// GracePeriod protects fresh uploads and manifests from collection.
+	GracePeriod time.Duration
+	// MaxSize bounds the size of fetched files.
+	MaxSize int64
+	// Logger receives replication failures.
+	Logger *slog.Logger
+}
+
+func NewReplicator(store *Store, raftServer *raft.Server, fsm *fsm.FSM, client *http.Client) *Replicator {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Replicator{
+		store:       store,
+		raftServer:  raftServer,
+		fsm:         fsm,
+		client:      client,
+		Interval:    10 * time.Second,
+		GracePeriod: time.Hour,
+		Logger:      slog.Default(),
+	}
+}
+
+func (r *Replicator) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.sync()
+			r.collectLocal()
+			if r.raftServer.IsLeader() {
+				r.collectManifests()
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (r *Replicator) sync() {
+	for _, manifest := range r.fsm.Store().GetFiles() {
+		if r.store.Has(manifest.Hash) {
+			continue
+		}
+		if err := r.Fetch(context.Background(), manifest); err != nil {
+			r.Logger.Warn("failed to replicate file", "hash", manifest.Hash, "err", err)
+		}
+	}
+}
+
+// Fetch downloads the contents of a manifest from the first source that has
+// them.
+func (r *Replicator) Fetch(ctx context.Context, manifest *models.FileManifest) error {
+	var lastErr error
+	for _, source := range manifest.Sources {
+		if err := r.fetchFrom(ctx, source, manifest.Hash); err != nil {
+			lastErr = err
+			continue
+		}
+		return nil
+	}
+	return fmt.Errorf("no source could provide file: %v", lastErr)
+}
+
+func (r *Replicator) fetchFrom(ctx context.Context, source, hash string) error {
+	url := strings.TrimRight(source, "/") + "/internal/v1/files/" + hash
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if r.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+r.AuthToken)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", source, resp.Status)
+	}
+
+	return r.store.PutVerified(hash, resp.Body, r.MaxSize)
+}
+
+func (r *Replicator) collectLocal() {
+	entries, err := r.store.List()
+	if err != nil {
+		r.Logger.Error("failed to list local files", "err", err)
+		return
+	}
+
+	for _, e := range entries {
+		if time.Since(e.ModTime) < r.GracePeriod {
+			continue
+		}
+		if _, found := r.fsm.Store().GetFile(e.Hash); found {
+			continue
+		}
+		if err := r.store.Remove(e.Hash); err != nil {
+			r.Logger.Error("failed to remove unreferenced file", "hash", e.Hash, "err", err)
+		}
+	}
+}
+
+// collectManifests drops the uploads no print job of the uploading tenant
+// references once they are older than the grace period. A manifest goes
+// with its last upload.
+func (r *Replicator) collectManifests() {
+	for _, manifest := range r.fsm.Store().GetUnreferencedFiles() {
+		if time.Since(manifest.UploadedAt) < r.GracePeriod {
+			continue
+		}
+
+		idData, err := json.Marshal(fsm.EntityRef{TenantID: manifest.Owners[0].TenantID, ID: manifest.Hash})
+		if err != nil {
+			continue
+		}
+
+		cmd := fsm.Command{
+			Op:         fsm.OpDelete,
+			EntityType: fsm.EntityFile,
+			Payload:    idData,
+		}
+
+		if _, err := r.raftServer.ApplyCommand(&cmd, 5*time.Second); err != nil {
+			r.Logger.Warn("failed to collect file", "hash", manifest.Hash, "err", err)
+		}
+	}
+}
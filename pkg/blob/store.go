@@ -0,0 +1,134 @@
+package blob
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/raft3d/pkg/models"
+)
+
+// Store keeps file contents on the local disk, named by the hex encoded
+// SHA-256 of their bytes.
+type Store struct {
+	dir string
+}
+
+// Entry is a file held by the local store.
+type Entry struct {
+	Hash    string
+	ModTime time.Time
+}
+
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "tmp"), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %v", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+func (s *Store) path(hash string) string {
+	return filepath.Join(s.dir, hash)
+}
+
+// Put copies r into the store and returns the hash and size of the content.
+// Content larger than maxSize is rejected when maxSize is positive.
+func (s *Store) Put(r io.Reader, maxSize int64) (string, int64, error) {
+	tmp, err := os.CreateTemp(filepath.Join(s.dir, "tmp"), "upload-*")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if maxSize > 0 {
+		r = io.LimitReader(r, maxSize+1)
+	}
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), r)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to write file: %v", err)
+	}
+	if maxSize > 0 && size > maxSize {
+		return "", 0, fmt.Errorf("file exceeds maximum size of %d bytes", maxSize)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		return "", 0, fmt.Errorf("failed to sync file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", 0, fmt.Errorf("failed to close file: %v", err)
+	}
+
+	hash := hex.EncodeToString(hasher.Sum(nil))
+	if err := os.Rename(tmp.Name(), s.path(hash)); err != nil {
+		return "", 0, fmt.Errorf("failed to store file: %v", err)
+	}
+
+	return hash, size, nil
+}
+
+// PutVerified stores r only if its content hashes to hash.
+func (s *Store) PutVerified(hash string, r io.Reader, maxSize int64) error {
+	got, _, err := s.Put(r, maxSize)
+	if err != nil {
+		return err
+	}
+	if got != hash {
+		s.Remove(got)
+		return fmt.Errorf("content hash mismatch: expected %s, got %s", hash, got)
+	}
+	return nil
+}
+
+func (s *Store) Has(hash string) bool {
+	if !models.ValidFileHash(hash) {
+		return false
+	}
+	_, err := os.Stat(s.path(hash))
+	return err == nil
+}
+
+func (s *Store) Open(hash string) (*os.File, error) {
+	if !models.ValidFileHash(hash) {
+		return nil, fmt.Errorf("invalid file hash: %s", hash)
+	}
+	return os.Open(s.path(hash))
+}
+
+func (s *Store) Remove(hash string) error {
+	if !models.ValidFileHash(hash) {
+		return fmt.Errorf("invalid file hash: %s", hash)
+	}
+	if err := os.Remove(s.path(hash)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// List returns every file held by the store.
+func (s *Store) List() ([]Entry, error) {
+	dirEntries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blob directory: %v", err)
+	}
+
+	entries := make([]Entry, 0, len(dirEntries))
+	for _, e := range dirEntries {
+		if e.IsDir() || !models.ValidFileHash(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		entries = append(entries, Entry{Hash: e.Name(), ModTime: info.ModTime()})
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,471 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/raft3d/pkg/logging"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix starts the name of every environment variable that overrides a
+// setting, for example RAFT3D_SNAPSHOT_INTERVAL for snapshot.interval.
+const EnvPrefix = "RAFT3D_"
+
+// Config is the configuration of a node. Settings come from the defaults, a
+// YAML file, RAFT3D_* environment variables and command line flags, each
+// overriding the one before.
+type Config struct {
+	NodeID        string     `yaml:"node_id"`
+	HTTPAddr      string     `yaml:"http_addr"`
+	HTTPAdvertise string     `yaml:"http_advertise"`
+	RaftAddr      string     `yaml:"raft_addr"`
+	DataDir       string     `yaml:"data_dir"`
+	Bootstrap     bool       `yaml:"bootstrap"`
+	Nodes         StringList `yaml:"nodes"`
+
+	Auth       bool   `yaml:"auth"`
+	AdminToken string `yaml:"admin_token"`
+	// PeerToken authenticates nodes to each other when they fetch files
+	// without TLS client certificates, and nodes joining through discovery
+	// to the cluster. Every node needs the same one.
+	PeerToken string `yaml:"peer_token"`
+
+	TLS      TLSConfig      `yaml:"tls"`
+	Snapshot SnapshotConfig `yaml:"snapshot"`
+	Raft     RaftConfig     `yaml:"raft"`
+	Files    FilesConfig    `yaml:"files"`
+	Log      LogConfig      `yaml:"log"`
+	Tracing  TracingConfig  `yaml:"tracing"`
+
+	Discovery DiscoveryConfig `yaml:"discovery"`
+
+	ReadyMaxLag uint64 `yaml:"ready_max_lag"`
+	// ShutdownTimeout bounds how long in-flight HTTP requests are waited
+	// for on shutdown.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+type TLSConfig struct {
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+	CA   string `yaml:"ca"`
+	// Raft enables mutual TLS on the Raft transport.
+	Raft bool `yaml:"raft"`
+}
+
+type SnapshotConfig struct {
+	// Interval between snapshots taken by the leader; 0 disables them.
+	Interval time.Duration `yaml:"interval"`
+	// Threshold is how many log entries hashicorp/raft lets accumulate
+	// before it takes a snapshot on its own.
+	Threshold uint64 `yaml:"threshold"`
+	// Retain is how many snapshots are kept on disk.
+	Retain int `yaml:"retain"`
+}
+
+// RaftConfig tunes Raft timing and replication. Settings left at zero are
+// taken from the preset.
+type RaftConfig struct {
+	// Preset is lan for nodes in one data center or wan for nodes spread
+	// across regions.
+	Preset             string        `yaml:"preset"`
+	HeartbeatTimeout   time.Duration `yaml:"heartbeat_timeout"`
+	ElectionTimeout    time.Duration `yaml:"election_timeout"`
+	LeaderLeaseTimeout time.Duration `yaml:"leader_lease_timeout"`
+	CommitTimeout      time.Duration `yaml:"commit_timeout"`
+	// MaxAppendEntries is how many log entries are sent in one
+	// AppendEntries RPC.
+	MaxAppendEntries int `yaml:"max_append_entries"`
+	// TrailingLogs is how many log entries are kept after a snapshot so
+	// that slightly lagging followers can catch up without one.
+	TrailingLogs      uint64        `yaml:"trailing_logs"`
+	TransportPoolSize int           `yaml:"transport_pool_size"`
+	TransportTimeout  time.Duration `yaml:"transport_timeout"`
+	// AllowLegacyPeers accepts Raft connections from, and falls back to
+	// them when dialling, nodes that predate the cluster handshake. It is
+	// meant for rolling upgrades and should be turned off afterwards.
+	AllowLegacyPeers bool `yaml:"allow_legacy_peers"`
+}
+
+// RaftPresets are the Raft settings of each preset. lan matches the
+// hashicorp/raft defaults; wan tolerates five times the latency and sends
+// larger batches over more connections.
+var RaftPresets = map[string]RaftConfig{
+	"lan": {
+		HeartbeatTimeout:   time.Second,
+		ElectionTimeout:    time.Second,
+		LeaderLeaseTimeout: 500 * time.Millisecond,
+		CommitTimeout:      50 * time.Millisecond,
+		MaxAppendEntries:   64,
+		TrailingLogs:       10240,
+		TransportPoolSize:  3,
+		TransportTimeout:   10 * time.Second,
+	},
+	"wan": {
+		HeartbeatTimeout:   5 * time.Second,
+		ElectionTimeout:    5 * time.Second,
+		LeaderLeaseTimeout: 2500 * time.Millisecond,
+		CommitTimeout:      200 * time.Millisecond,
+		MaxAppendEntries:   256,
+		TrailingLogs:       20480,
+		TransportPoolSize:  5,
+		TransportTimeout:   30 * time.Second,
+	},
+}
+
+// applyPreset fills the settings left at zero from the preset.
+func (r *RaftConfig) applyPreset() {
+	preset, ok := RaftPresets[r.Preset]
+	if !ok {
+		return
+	}
+	if r.HeartbeatTimeout == 0 {
+		r.HeartbeatTimeout = preset.HeartbeatTimeout
+	}
+	if r.ElectionTimeout == 0 {
+		r.ElectionTimeout = preset.ElectionTimeout
+	}
+	if r.LeaderLeaseTimeout == 0 {
+		r.LeaderLeaseTimeout = preset.LeaderLeaseTimeout
+	}
+	if r.CommitTimeout == 0 {
+		r.CommitTimeout = preset.CommitTimeout
+	}
+	if r.MaxAppendEntries == 0 {
+		r.MaxAppendEntries = preset.MaxAppendEntries
+	}
+	if r.TrailingLogs == 0 {
+		r.TrailingLogs = preset.TrailingLogs
+	}
+	if r.TransportPoolSize == 0 {
+		r.TransportPoolSize = preset.TransportPoolSize
+	}
+	if r.TransportTimeout == 0 {
+		r.TransportTimeout = preset.TransportTimeout
+	}
+}
+
+type FilesConfig struct {
+	MaxUploadMB int64         `yaml:"max_upload_mb"`
+	GCGrace     time.Duration `yaml:"gc_grace"`
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+type TracingConfig struct {
+	OTLPEndpoint string  `yaml:"otlp_endpoint"`
+	SampleRatio  float64 `yaml:"sample_ratio"`
+}
+
+// DiscoveryConfig says where a node that is not bootstrapping looks for the
+// cluster to join.
+type DiscoveryConfig struct {
+	// Seeds are base URLs of node APIs.
+	Seeds StringList `yaml:"seeds"`
+	// SRV is a DNS name whose SRV records point at node APIs.
+	SRV string `yaml:"srv"`
+	// DNS is a DNS name whose A and AAAA records are nodes serving their API
+	// on DNSPort.
+	DNS      string        `yaml:"dns"`
+	DNSPort  int           `yaml:"dns_port"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// Enabled reports whether any source of peers is configured.
+func (d DiscoveryConfig) Enabled() bool {
+	return len(d.Seeds) > 0 || d.SRV != "" || d.DNS != ""
+}
+
+// StringList is a list setting. As a flag or environment variable it is
+// written comma separated.
+type StringList []string
+
+func (l *StringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *StringList) Set(value string) error {
+	*l = nil
+	for _, node := range strings.Split(value, ",") {
+		if node = strings.TrimSpace(node); node != "" {
+			*l = append(*l, node)
+		}
+	}
+	return nil
+}
+
+// Default returns the settings used when nothing overrides them.
+func Default() Config {
+	return Config{
+		HTTPAddr: "127.0.0.1:8000",
+		RaftAddr: "127.0.0.1:7000",
+		DataDir:  "data",
+		Snapshot: SnapshotConfig{
+			Interval:  30 * time.Second,
+			Threshold: 1000,
+			Retain:    3,
+		},
+		Raft: RaftConfig{
+			Preset: "lan",
+		},
+		Files: FilesConfig{
+			MaxUploadMB: 256,
+			GCGrace:     time.Hour,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "text",
+		},
+		Tracing: TracingConfig{
+			SampleRatio: 1,
+		},
+		Discovery: DiscoveryConfig{
+			Interval: 5 * time.Second,
+		},
+		ReadyMaxLag:     100,
+		ShutdownTimeout: 30 * time.Second,
+	}
+}
+
+// LoadFile overlays the settings of a YAML file on c. Unknown settings are
+// rejected so that typos do not go unnoticed.
+func (c *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// LoadEnv overlays the settings found in the environment on c. A setting's
+// variable is EnvPrefix followed by its YAML path in upper case, with
+// sections joined by underscores.
+func (c *Config) LoadEnv(lookup func(string) (string, bool)) error {
+	return loadEnv(reflect.ValueOf(c).Elem(), EnvPrefix, lookup)
+}
+
+func loadEnv(v reflect.Value, prefix string, lookup func(string) (string, bool)) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		name := prefix + strings.ToUpper(t.Field(i).Tag.Get("yaml"))
+
+		if field.Kind() == reflect.Struct {
+			if err := loadEnv(field, name+"_", lookup); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		if err := setField(field, value); err != nil {
+			return fmt.Errorf("invalid %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func setField(field reflect.Value, value string) error {
+	if setter, ok := field.Addr().Interface().(interface{ Set(string) error }); ok {
+		return setter.Set(value)
+	}
+
+	switch field.Interface().(type) {
+	case time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+	return nil
+}
+
+// PathFromArgs finds the value of a -config flag in the command line, so
+// that the file can be loaded before the other flags are parsed on top of
+// it. It falls back to RAFT3D_CONFIG.
+func PathFromArgs(args []string) string {
+	for i, arg := range args {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return os.Getenv(EnvPrefix + "CONFIG")
+}
+
+// Normalize fills in settings derived from others: Raft settings left at
+// zero come from the preset, a node bootstrapping without a node list
+// bootstraps a cluster of itself, and nodes listed without an address get
+// their default local one.
+func (c *Config) Normalize() {
+	c.Raft.applyPreset()
+	if c.Bootstrap && len(c.Nodes) == 0 && c.NodeID != "" {
+		c.Nodes = StringList{c.NodeID + "=" + c.RaftAddr}
+	}
+	for i, node := range c.Nodes {
+		if node != "" && !strings.Contains(node, "=") {
+			c.Nodes[i] = node + "=" + defaultNodeAddr(node)
+		}
+	}
+	if c.AdminToken != "" {
+		c.Auth = true
+	}
+}
+
+// Validate reports every problem with the configuration at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.NodeID != "", "node_id is required")
+	check(!strings.ContainsAny(c.NodeID, "/=,"), "node_id must not contain '/', '=' or ','")
+	check(validAddr(c.HTTPAddr), "http_addr %q is not a host:port address", c.HTTPAddr)
+	check(validAddr(c.RaftAddr), "raft_addr %q is not a host:port address", c.RaftAddr)
+	check(c.DataDir != "", "data_dir is required")
+
+	ids := make(map[string]bool)
+	self := false
+	for _, node := range c.Nodes {
+		id, addr, ok := strings.Cut(node, "=")
+		if !ok || id == "" || !validAddr(addr) {
+			errs = append(errs, fmt.Errorf("nodes entry %q must be id=host:port", node))
+			continue
+		}
+		check(!ids[id], "nodes lists %s more than once", id)
+		ids[id] = true
+		self = self || id == c.NodeID
+	}
+	check(!c.Bootstrap || self, "nodes must include this node (%s) to bootstrap", c.NodeID)
+
+	check((c.TLS.Cert == "") == (c.TLS.Key == ""), "tls.cert and tls.key must be set together")
+	check(!c.TLS.Raft || (c.TLS.Cert != "" && c.TLS.CA != ""), "tls.raft requires tls.cert, tls.key and tls.ca")
+
+	check(c.Snapshot.Interval >= 0, "snapshot.interval must not be negative")
+	check(c.Snapshot.Threshold > 0, "snapshot.threshold must be positive")
+	check(c.Snapshot.Retain > 0, "snapshot.retain must be positive")
+
+	_, ok := RaftPresets[c.Raft.Preset]
+	check(ok, "raft.preset %q must be lan or wan", c.Raft.Preset)
+
+	const minTimeout = 5 * time.Millisecond
+	check(c.Raft.HeartbeatTimeout >= minTimeout, "raft.heartbeat_timeout must be at least %s", minTimeout)
+	check(c.Raft.ElectionTimeout >= minTimeout, "raft.election_timeout must be at least %s", minTimeout)
+	check(c.Raft.LeaderLeaseTimeout >= minTimeout, "raft.leader_lease_timeout must be at least %s", minTimeout)
+	check(c.Raft.LeaderLeaseTimeout <= c.Raft.HeartbeatTimeout, "raft.leader_lease_timeout must not exceed raft.heartbeat_timeout")
+	check(c.Raft.ElectionTimeout >= c.Raft.HeartbeatTimeout, "raft.election_timeout must not be less than raft.heartbeat_timeout")
+	check(c.Raft.CommitTimeout >= time.Millisecond, "raft.commit_timeout must be at least %s", time.Millisecond)
+	check(c.Raft.MaxAppendEntries > 0 && c.Raft.MaxAppendEntries <= 1024, "raft.max_append_entries must be between 1 and 1024")
+	check(c.Raft.TransportPoolSize > 0, "raft.transport_pool_size must be positive")
+	check(c.Raft.TransportTimeout > 0, "raft.transport_timeout must be positive")
+
+	check(c.Files.MaxUploadMB > 0, "files.max_upload_mb must be positive")
+	check(c.Files.GCGrace >= 0, "files.gc_grace must not be negative")
+
+	_, err := logging.ParseLevel(c.Log.Level)
+	check(err == nil, "log.level %q must be trace, debug, info, warn or error", c.Log.Level)
+	check(c.Log.Format == "text" || c.Log.Format == "json", "log.format %q must be text or json", c.Log.Format)
+
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1")
+	check(c.ShutdownTimeout > 0, "shutdown_timeout must be positive")
+
+	for _, seed := range c.Discovery.Seeds {
+		u, err := url.Parse(seed)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "discovery.seeds entry %q must be an http or https URL", seed)
+	}
+	check(c.Discovery.DNS == "" || (c.Discovery.DNSPort > 0 && c.Discovery.DNSPort < 65536), "discovery.dns requires discovery.dns_port")
+	check(c.Discovery.Interval > 0, "discovery.interval must be positive")
+	check(!c.Bootstrap || !c.Discovery.Enabled(), "bootstrap and discovery are mutually exclusive")
+
+	return errors.Join(errs...)
+}
+
+// defaultNodeAddr is the Raft address assumed for a node listed by ID alone:
+// node1 to node3 listen on 127.0.0.1:7001 to 7003, any other on 7000.
+func defaultNodeAddr(id string) string {
+	port := 7000
+	switch id {
+	case "node1":
+		port = 7001
+	case "node2":
+		port = 7002
+	case "node3":
+		port = 7003
+	}
+	return fmt.Sprintf("127.0.0.1:%d", port)
+}
+
+func validAddr(addr string) bool {
+	_, port, err := net.SplitHostPort(addr)
+	return err == nil && port != ""
+}
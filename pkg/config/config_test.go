@@ -0,0 +1,205 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNormalizeExpandsBareNodes(t *testing.T) {
+	cfg := Default()
+	cfg.NodeID = "node1"
+	cfg.Bootstrap = true
+	cfg.Nodes = StringList{"node1", "node2=10.0.0.2:7000", "storage"}
+	cfg.Normalize()
+
+	want := []string{"node1=127.0.0.1:7001", "node2=10.0.0.2:7000", "storage=127.0.0.1:7000"}
+	for i, node := range cfg.Nodes {
+		if node != want[i] {
+			t.Errorf("nodes[%d] = %q, want %q", i, node, want[i])
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+}
+
+func TestLoadFileAcceptsEmptyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "raft3d.yaml")
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Default()
+	if err := cfg.LoadFile(path); err != nil {
+		t.Errorf("LoadFile() = %v", err)
+	}
+}
+
+func TestValidateRaftLimits(t *testing.T) {
+	tests := []struct {
+		name  string
+		raft  func(*RaftConfig)
+		valid bool
+	}{
+		{"preset", func(*RaftConfig) {}, true},
+		{"election below heartbeat", func(r *RaftConfig) { r.ElectionTimeout = r.HeartbeatTimeout / 2 }, false},
+		{"lease above heartbeat", func(r *RaftConfig) { r.LeaderLeaseTimeout = r.HeartbeatTimeout * 2 }, false},
+		{"commit below a millisecond", func(r *RaftConfig) { r.CommitTimeout = 500 * time.Microsecond }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.NodeID = "node1"
+			cfg.Normalize()
+			tt.raft(&cfg.Raft)
+			if err := cfg.Validate(); (err == nil) != tt.valid {
+				t.Errorf("Validate() = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestSettingPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "raft3d.yaml")
+	file := "http_addr: 127.0.0.1:8100\nraft_addr: 127.0.0.1:7100\ndata_dir: file\n"
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{
+		"RAFT3D_RAFT_ADDR": "127.0.0.1:7200",
+		"RAFT3D_DATA_DIR":  "env",
+	}
+
+	cfg := Default()
+	if err := cfg.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.LoadEnv(lookup(env)); err != nil {
+		t.Fatal(err)
+	}
+	// Flags are bound the way main binds them: with the loaded settings as
+	// their defaults, so only flags given on the command line override.
+	fs := flag.NewFlagSet("raft3d", flag.ContinueOnError)
+	fs.StringVar(&cfg.HTTPAddr, "http", cfg.HTTPAddr, "")
+	fs.StringVar(&cfg.RaftAddr, "raft", cfg.RaftAddr, "")
+	fs.StringVar(&cfg.DataDir, "data", cfg.DataDir, "")
+	fs.StringVar(&cfg.Log.Level, "log-level", cfg.Log.Level, "")
+	if err := fs.Parse([]string{"-data", "flag"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		setting, got, want string
+	}{
+		{"log level from defaults", cfg.Log.Level, "info"},
+		{"http address from file", cfg.HTTPAddr, "127.0.0.1:8100"},
+		{"raft address from env", cfg.RaftAddr, "127.0.0.1:7200"},
+		{"data dir from flag", cfg.DataDir, "flag"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.setting, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadEnvParsesSettings(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   map[string]string
+		check func(Config) bool
+	}{
+		{"string", map[string]string{"RAFT3D_NODE_ID": "node2"},
+			func(c Config) bool { return c.NodeID == "node2" }},
+		{"bool", map[string]string{"RAFT3D_BOOTSTRAP": "true"},
+			func(c Config) bool { return c.Bootstrap }},
+		{"duration", map[string]string{"RAFT3D_SHUTDOWN_TIMEOUT": "1m30s"},
+			func(c Config) bool { return c.ShutdownTimeout == 90*time.Second }},
+		{"uint64", map[string]string{"RAFT3D_READY_MAX_LAG": "7"},
+			func(c Config) bool { return c.ReadyMaxLag == 7 }},
+		{"list", map[string]string{"RAFT3D_NODES": "node1, node2=10.0.0.2:7000,"},
+			func(c Config) bool {
+				return len(c.Nodes) == 2 && c.Nodes[0] == "node1" && c.Nodes[1] == "node2=10.0.0.2:7000"
+			}},
+		{"nested duration", map[string]string{"RAFT3D_SNAPSHOT_INTERVAL": "0s"},
+			func(c Config) bool { return c.Snapshot.Interval == 0 }},
+		{"nested int", map[string]string{"RAFT3D_RAFT_MAX_APPEND_ENTRIES": "128"},
+			func(c Config) bool { return c.Raft.MaxAppendEntries == 128 }},
+		{"nested bool", map[string]string{"RAFT3D_RAFT_ALLOW_LEGACY_PEERS": "1"},
+			func(c Config) bool { return c.Raft.AllowLegacyPeers }},
+		{"nested int64", map[string]string{"RAFT3D_FILES_MAX_UPLOAD_MB": "512"},
+			func(c Config) bool { return c.Files.MaxUploadMB == 512 }},
+		{"nested float", map[string]string{"RAFT3D_TRACING_SAMPLE_RATIO": "0.25"},
+			func(c Config) bool { return c.Tracing.SampleRatio == 0.25 }},
+		{"nested list", map[string]string{"RAFT3D_DISCOVERY_SEEDS": "https://a:8000,https://b:8000"},
+			func(c Config) bool { return len(c.Discovery.Seeds) == 2 }},
+		{"unset keeps default", map[string]string{"RAFT3D_SNAPSHOT": "5s"},
+			func(c Config) bool { return c.Snapshot.Interval == 30*time.Second }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			if err := cfg.LoadEnv(lookup(tt.env)); err != nil {
+				t.Fatalf("LoadEnv() = %v", err)
+			}
+			if !tt.check(cfg) {
+				t.Errorf("LoadEnv(%v) did not apply the setting", tt.env)
+			}
+		})
+	}
+}
+
+func TestLoadEnvRejectsInvalidValues(t *testing.T) {
+	for _, name := range []string{
+		"RAFT3D_BOOTSTRAP",
+		"RAFT3D_SHUTDOWN_TIMEOUT",
+		"RAFT3D_READY_MAX_LAG",
+		"RAFT3D_SNAPSHOT_RETAIN",
+		"RAFT3D_RAFT_HEARTBEAT_TIMEOUT",
+		"RAFT3D_FILES_MAX_UPLOAD_MB",
+		"RAFT3D_TRACING_SAMPLE_RATIO",
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := Default()
+			if err := cfg.LoadEnv(lookup(map[string]string{name: "many"})); err == nil {
+				t.Errorf("LoadEnv() accepted %s=many", name)
+			}
+		})
+	}
+}
+
+func TestPathFromArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  string
+		want string
+	}{
+		{"single dash", []string{"-config", "a.yaml"}, "", "a.yaml"},
+		{"double dash", []string{"--config", "a.yaml"}, "", "a.yaml"},
+		{"equals", []string{"-id", "node1", "--config=a.yaml"}, "", "a.yaml"},
+		{"flag wins over env", []string{"-config=a.yaml"}, "b.yaml", "a.yaml"},
+		{"env", []string{"-id", "node1"}, "b.yaml", "b.yaml"},
+		{"missing value", []string{"-config"}, "b.yaml", "b.yaml"},
+		{"value named config", []string{"-id", "config"}, "", ""},
+		{"other flag", []string{"-configs", "a.yaml"}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvPrefix+"CONFIG", tt.env)
+			if got := PathFromArgs(tt.args); got != tt.want {
+				t.Errorf("PathFromArgs(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func lookup(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
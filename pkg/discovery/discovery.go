@@ -0,0 +1,243 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config says where to look for the HTTP APIs of cluster nodes.
+type Config struct {
+	// Seeds are base URLs of nodes, such as http://10.0.0.1:8000.
+	Seeds []string
+	// SRV is a DNS name whose SRV records point at node APIs.
+	SRV string
+	// DNS is a DNS name whose A and AAAA records are node addresses, served
+	// on DNSPort.
+	DNS     string
+	DNSPort int
+	// Scheme is used for addresses found through DNS; http by default.
+	Scheme string
+}
+
+// resolver is the part of net.Resolver that discovery uses.
+type resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// Discoverer finds the nodes of a cluster and asks it to admit this node.
+type Discoverer struct {
+	config   Config
+	client   *http.Client
+	resolver resolver
+
+	// AuthToken is sent to the cluster API, which accepts the peer token for
+	// joining when authentication is enabled. It is never sent without TLS.
+	AuthToken string
+	// Interval between attempts to join while no leader accepts this node.
+	Interval time.Duration
+	// OnMembers, if set, is given the members of the cluster before this node
+	// asks to join it, so that it knows which nodes to accept connections
+	// from.
+	OnMembers func([]Member)
+	Logger    *slog.Logger
+}
+
+func NewDiscoverer(config Config, client *http.Client) *Discoverer {
+	if config.Scheme == "" {
+		config.Scheme = "http"
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	// Followers answer writes with a redirect; the next node is tried instead
+	noRedirects := *client
+	noRedirects.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	return &Discoverer{
+		config:   config,
+		client:   &noRedirects,
+		resolver: net.DefaultResolver,
+		Interval: 5 * time.Second,
+		Logger:   slog.Default(),
+	}
+}
+
+// Peers returns the base URLs of the node APIs found by every configured
+// source. A failing DNS lookup only fails the whole call when nothing else
+// was found.
+func (d *Discoverer) Peers(ctx context.Context) ([]string, error) {
+	seen := make(map[string]bool)
+	var peers []string
+	add := func(url string) {
+		url = strings.TrimRight(url, "/")
+		if !seen[url] {
+			seen[url] = true
+			peers = append(peers, url)
+		}
+	}
+
+	for _, seed := range d.config.Seeds {
+		add(seed)
+	}
+
+	var lookupErr error
+	if d.config.SRV != "" {
+		_, records, err := d.resolver.LookupSRV(ctx, "", "", d.config.SRV)
+		if err != nil {
+			lookupErr = fmt.Errorf("failed to look up SRV records of %s: %v", d.config.SRV, err)
+		}
+		for _, srv := range records {
+			add(d.url(strings.TrimSuffix(srv.Target, "."), int(srv.Port)))
+		}
+	}
+
+	if d.config.DNS != "" {
+		addrs, err := d.resolver.LookupHost(ctx, d.config.DNS)
+		if err != nil {
+			lookupErr = fmt.Errorf("failed to look up addresses of %s: %v", d.config.DNS, err)
+		}
+		sort.Strings(addrs)
+		for _, addr := range addrs {
+			add(d.url(addr, d.config.DNSPort))
+		}
+	}
+
+	if len(peers) == 0 && lookupErr != nil {
+		return nil, lookupErr
+	}
+	return peers, nil
+}
+
+func (d *Discoverer) url(host string, port int) string {
+	return d.config.Scheme + "://" + net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// JoinCluster asks the discovered nodes to add nodeID at raftAddr as a voter,
+// retrying every Interval until a leader accepts it, the node turns out to be
+// a member already, or stopCh is closed.
+func (d *Discoverer) JoinCluster(nodeID, raftAddr string, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), d.Interval+d.client.Timeout)
+		joined, err := d.join(ctx, nodeID, raftAddr)
+		cancel()
+		if joined {
+			return
+		}
+		d.Logger.Warn("failed to join cluster, retrying", "err", err, "retry_in", d.Interval)
+
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// Member is a node of the cluster as listed by its API.
+type Member struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+}
+
+func (d *Discoverer) join(ctx context.Context, nodeID, raftAddr string) (bool, error) {
+	peers, err := d.Peers(ctx)
+	if err != nil {
+		return false, err
+	}
+	if len(peers) == 0 {
+		return false, fmt.Errorf("no peers found")
+	}
+
+	// A node that restarts is usually a member already. Joining needs the
+	// members in any case, to know who may connect once this node is added.
+	var members []Member
+	var errs []string
+	for _, peer := range peers {
+		var servers []Member
+		if err := d.do(ctx, "GET", peer+"/api/v1/cluster/servers", nil, &servers); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		for _, srv := range servers {
+			if srv.ID == nodeID && srv.Address == raftAddr {
+				d.Logger.Info("already a member of the cluster", "peer", peer)
+				return true, nil
+			}
+		}
+		if members == nil {
+			members = servers
+		}
+	}
+	if len(members) == 0 {
+		return false, fmt.Errorf("no peer listed the members of the cluster: %s", strings.Join(errs, "; "))
+	}
+	if d.OnMembers != nil {
+		d.OnMembers(members)
+	}
+
+	errs = nil
+	request := map[string]string{"node_id": nodeID, "raft_addr": raftAddr}
+	for _, peer := range peers {
+		if err := d.do(ctx, "POST", peer+"/api/v1/cluster/servers", request, nil); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		d.Logger.Info("joined cluster", "peer", peer)
+		return true, nil
+	}
+	return false, fmt.Errorf("no leader accepted the join: %s", strings.Join(errs, "; "))
+}
+
+func (d *Discoverer) do(ctx context.Context, method, url string, body, result interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if d.AuthToken != "" {
+		if req.URL.Scheme != "https" {
+			return fmt.Errorf("%s: refusing to send credentials without TLS", url)
+		}
+		req.Header.Set("Authorization", "Bearer "+d.AuthToken)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s: %s", url, resp.Status, strings.TrimSpace(string(message)))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
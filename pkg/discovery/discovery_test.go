@@ -0,0 +1,219 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeResolver struct {
+	srv   map[string][]*net.SRV
+	hosts map[string][]string
+}
+
+func (r *fakeResolver) LookupSRV(_ context.Context, _, _, name string) (string, []*net.SRV, error) {
+	records, ok := r.srv[name]
+	if !ok {
+		return "", nil, errors.New("no such host")
+	}
+	return name, records, nil
+}
+
+func (r *fakeResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	addrs, ok := r.hosts[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return addrs, nil
+}
+
+func newTestDiscoverer(config Config, client *http.Client) *Discoverer {
+	d := NewDiscoverer(config, client)
+	d.resolver = &fakeResolver{
+		srv: map[string][]*net.SRV{
+			"_raft3d._tcp.example.com": {
+				{Target: "node2.example.com.", Port: 8002},
+				{Target: "node3.example.com.", Port: 8003},
+			},
+		},
+		hosts: map[string][]string{
+			"raft3d.example.com": {"10.0.0.3", "10.0.0.1", "fd00::2"},
+		},
+	}
+	d.Interval = 10 * time.Millisecond
+	return d
+}
+
+func TestPeers(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   []string
+	}{
+		{
+			name:   "seeds",
+			config: Config{Seeds: []string{"http://10.0.0.1:8000/", "http://10.0.0.1:8000", "http://10.0.0.2:8000"}},
+			want:   []string{"http://10.0.0.1:8000", "http://10.0.0.2:8000"},
+		},
+		{
+			name:   "srv",
+			config: Config{SRV: "_raft3d._tcp.example.com", Scheme: "https"},
+			want:   []string{"https://node2.example.com:8002", "https://node3.example.com:8003"},
+		},
+		{
+			name:   "addresses",
+			config: Config{DNS: "raft3d.example.com", DNSPort: 8000},
+			want:   []string{"http://10.0.0.1:8000", "http://10.0.0.3:8000", "http://[fd00::2]:8000"},
+		},
+		{
+			name: "every source",
+			config: Config{
+				Seeds:   []string{"http://node2.example.com:8002"},
+				SRV:     "_raft3d._tcp.example.com",
+				DNS:     "raft3d.example.com",
+				DNSPort: 8000,
+			},
+			want: []string{
+				"http://node2.example.com:8002",
+				"http://node3.example.com:8003",
+				"http://10.0.0.1:8000",
+				"http://10.0.0.3:8000",
+				"http://[fd00::2]:8000",
+			},
+		},
+		{
+			name:   "failed lookup with seeds",
+			config: Config{Seeds: []string{"http://10.0.0.1:8000"}, SRV: "_raft3d._tcp.missing.example.com"},
+			want:   []string{"http://10.0.0.1:8000"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peers, err := newTestDiscoverer(tt.config, nil).Peers(context.Background())
+			if err != nil {
+				t.Fatalf("Peers() = %v", err)
+			}
+			if strings.Join(peers, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("Peers() = %v, want %v", peers, tt.want)
+			}
+		})
+	}
+}
+
+func TestPeersFailsWhenNothingIsFound(t *testing.T) {
+	d := newTestDiscoverer(Config{DNS: "missing.example.com", DNSPort: 8000}, nil)
+	if peers, err := d.Peers(context.Background()); err == nil {
+		t.Errorf("Peers() = %v, want an error", peers)
+	}
+}
+
+// cluster serves the cluster API of a leader that only accepts joins after
+// rejecting the first few.
+type cluster struct {
+	mu      sync.Mutex
+	members []Member
+	rejects int
+	joins   int
+	auth    []string
+}
+
+func (c *cluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.auth = append(c.auth, r.Header.Get("Authorization"))
+
+	switch r.Method {
+	case "GET":
+		json.NewEncoder(w).Encode(c.members)
+	case "POST":
+		c.joins++
+		if c.joins <= c.rejects {
+			// A follower redirects to the leader; the redirect is not followed
+			http.Redirect(w, r, "/elsewhere", http.StatusTemporaryRedirect)
+			return
+		}
+		var request map[string]string
+		json.NewDecoder(r.Body).Decode(&request)
+		c.members = append(c.members, Member{ID: request["node_id"], Address: request["raft_addr"]})
+	}
+}
+
+func joinCluster(t *testing.T, d *Discoverer) {
+	t.Helper()
+	done := make(chan struct{})
+	stopCh := make(chan struct{})
+	go func() {
+		d.JoinCluster("node2", "10.0.0.2:7000", stopCh)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		close(stopCh)
+		t.Fatal("JoinCluster did not return")
+	}
+}
+
+func TestJoinClusterRetriesUntilAccepted(t *testing.T) {
+	c := &cluster{members: []Member{{ID: "node1", Address: "10.0.0.1:7000"}}, rejects: 2}
+	server := httptest.NewTLSServer(c)
+	defer server.Close()
+
+	client := server.Client()
+	client.Timeout = 5 * time.Second
+	d := newTestDiscoverer(Config{Seeds: []string{server.URL}}, client)
+	d.AuthToken = "peer-secret"
+	var seen []Member
+	d.OnMembers = func(members []Member) { seen = members }
+	joinCluster(t, d)
+
+	if c.joins != 3 {
+		t.Errorf("join requests = %d, want 3", c.joins)
+	}
+	if len(c.members) != 2 || c.members[1] != (Member{ID: "node2", Address: "10.0.0.2:7000"}) {
+		t.Errorf("members = %v, want node2 added", c.members)
+	}
+	if len(seen) != 1 || seen[0].ID != "node1" {
+		t.Errorf("OnMembers got %v, want node1", seen)
+	}
+	for _, auth := range c.auth {
+		if auth != "Bearer peer-secret" {
+			t.Errorf("Authorization = %q, want the peer token", auth)
+		}
+	}
+}
+
+func TestJoinClusterStopsWhenAlreadyMember(t *testing.T) {
+	c := &cluster{members: []Member{{ID: "node1", Address: "10.0.0.1:7000"}, {ID: "node2", Address: "10.0.0.2:7000"}}}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	joinCluster(t, newTestDiscoverer(Config{Seeds: []string{server.URL}}, nil))
+
+	if c.joins != 0 {
+		t.Errorf("join requests = %d, want none", c.joins)
+	}
+}
+
+func TestCredentialsAreOnlySentOverTLS(t *testing.T) {
+	c := &cluster{members: []Member{{ID: "node1", Address: "10.0.0.1:7000"}}}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	d := newTestDiscoverer(Config{Seeds: []string{server.URL}}, nil)
+	d.AuthToken = "peer-secret"
+	joined, err := d.join(context.Background(), "node2", "10.0.0.2:7000")
+	if joined || err == nil || !strings.Contains(err.Error(), "without TLS") {
+		t.Errorf("join() = %v, %v, want a refusal", joined, err)
+	}
+	if len(c.auth) != 0 {
+		t.Errorf("server got %d requests, want none", len(c.auth))
+	}
+}
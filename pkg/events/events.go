@@ -0,0 +1,139 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	TypePrintJobCreated       = "print_job.created"
+	TypePrintJobStatusChanged = "print_job.status_changed"
+	TypeBatchCancelled        = "batch.cancelled"
+	TypeFilamentUpdated       = "filament.updated"
+	TypeFilamentLowStock      = "filament.low_stock"
+)
+
+// Types lists every event type.
+var Types = []string{
+	TypePrintJobCreated,
+	TypePrintJobStatusChanged,
+	TypeBatchCancelled,
+	TypeFilamentUpdated,
+	TypeFilamentLowStock,
+}
+
+// KnownType reports whether t is one of Types.
+func KnownType(t string) bool {
+	for _, known := range Types {
+		if known == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is something that happened to the replicated state. Events are
+// produced while log entries are applied, so every node sees the same events
+// with the same IDs.
+type Event struct {
+	// Index is the Raft log index of the entry that produced the event and
+	// Seq numbers the events of that entry.
+	Index    uint64          `json:"index"`
+	Seq      int             `json:"seq"`
+	Type     string          `json:"type"`
+	TenantID string          `json:"tenant_id,omitempty"`
+	Time     time.Time       `json:"time"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// ID identifies an event in a stream.
+func (e Event) ID() string {
+	return fmt.Sprintf("%d.%d", e.Index, e.Seq)
+}
+
+// after reports whether the event comes after the one with the given ID.
+func (e Event) after(index uint64, seq int) bool {
+	return e.Index > index || (e.Index == index && e.Seq > seq)
+}
+
+// ParseID parses an event ID as returned by Event.ID.
+func ParseID(id string) (uint64, int, error) {
+	var index uint64
+	var seq int
+	if _, err := fmt.Sscanf(id, "%d.%d", &index, &seq); err != nil {
+		return 0, 0, fmt.Errorf("invalid event ID: %s", id)
+	}
+	return index, seq, nil
+}
+
+// Broker fans events out to local subscribers and keeps a short history so
+// reconnecting clients can catch up.
+type Broker struct {
+	mu      sync.Mutex
+	subs    map[chan Event]struct{}
+	history []Event
+	size    int
+}
+
+func NewBroker(history int) *Broker {
+	return &Broker{
+		subs: make(map[chan Event]struct{}),
+		size: history,
+	}
+}
+
+// Publish hands an event to every subscriber. Subscribers that are not
+// keeping up miss the event rather than holding up the state machine.
+func (b *Broker) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.history = append(b.history, e)
+	if len(b.history) > b.size {
+		b.history = b.history[len(b.history)-b.size:]
+	}
+
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel of new events and the remembered events after
+// lastID, if lastID is not empty. cancel must be called once the subscriber
+// is done.
+func (b *Broker) Subscribe(lastID string) (<-chan Event, []Event, func(), error) {
+	var backlog []Event
+	var index uint64
+	var seq int
+	if lastID != "" {
+		var err error
+		if index, seq, err = ParseID(lastID); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	ch := make(chan Event, 64)
+
+	b.mu.Lock()
+	if lastID != "" {
+		for _, e := range b.history {
+			if e.after(index, seq) {
+				backlog = append(backlog, e)
+			}
+		}
+	}
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	cancel := func() {
+		b.mu.Lock()
+		delete(b.subs, ch)
+		b.mu.Unlock()
+	}
+	return ch, backlog, cancel, nil
+}
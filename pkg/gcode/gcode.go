@@ -0,0 +1,234 @@
+package gcode
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/raft3d/pkg/models"
+)
+
+// defaultFeedrate is used until a file sets one, in mm/min.
+const defaultFeedrate = 1500.0
+
+type state struct {
+	x, y, z, e  float64
+	feedrate    float64
+	relative    bool
+	relativeE   bool
+	inchUnits   bool
+	extrudedAtZ map[float64]bool
+	haveBounds  bool
+	analysis    models.GCodeAnalysis
+}
+
+// Analyze reads G-code and computes how much filament it extrudes, roughly
+// how long it takes, how many layers it has and the bounding box of the
+// extruded model. Print time is estimated from distances and feedrates
+// without modelling acceleration, so it tends to be optimistic.
+func Analyze(r io.Reader) (*models.GCodeAnalysis, error) {
+	s := &state{
+		feedrate:    defaultFeedrate,
+		extrudedAtZ: make(map[float64]bool),
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		if err := s.execute(scanner.Text()); err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read G-code: %v", err)
+	}
+
+	s.analysis.LayerCount = len(s.extrudedAtZ)
+	return &s.analysis, nil
+}
+
+func (s *state) execute(line string) error {
+	if i := strings.IndexByte(line, ';'); i >= 0 {
+		line = line[:i]
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	// Skip an optional line number.
+	if fields[0][0] == 'N' || fields[0][0] == 'n' {
+		fields = fields[1:]
+		if len(fields) == 0 {
+			return nil
+		}
+	}
+
+	command := strings.ToUpper(fields[0])
+	params, err := parseParams(fields[1:])
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "G0", "G1", "G2", "G3":
+		s.move(params)
+	case "G4":
+		if p, ok := params['P']; ok {
+			s.analysis.EstimatedSeconds += p / 1000
+		}
+		if sec, ok := params['S']; ok {
+			s.analysis.EstimatedSeconds += sec
+		}
+	case "G20":
+		s.inchUnits = true
+	case "G21":
+		s.inchUnits = false
+	case "G28":
+		if len(params) == 0 {
+			s.x, s.y, s.z = 0, 0, 0
+		}
+		if _, ok := params['X']; ok {
+			s.x = 0
+		}
+		if _, ok := params['Y']; ok {
+			s.y = 0
+		}
+		if _, ok := params['Z']; ok {
+			s.z = 0
+		}
+	case "G90":
+		s.relative = false
+		s.relativeE = false
+	case "G91":
+		s.relative = true
+		s.relativeE = true
+	case "G92":
+		if v, ok := params['X']; ok {
+			s.x = s.toMM(v)
+		}
+		if v, ok := params['Y']; ok {
+			s.y = s.toMM(v)
+		}
+		if v, ok := params['Z']; ok {
+			s.z = s.toMM(v)
+		}
+		if v, ok := params['E']; ok {
+			s.e = s.toMM(v)
+		}
+	case "M82":
+		s.relativeE = false
+	case "M83":
+		s.relativeE = true
+	}
+
+	return nil
+}
+
+func parseParams(fields []string) (map[rune]float64, error) {
+	params := make(map[rune]float64)
+	for _, field := range fields {
+		letter := unicode.ToUpper(rune(field[0]))
+		if letter < 'A' || letter > 'Z' {
+			continue
+		}
+		if len(field) == 1 {
+			params[letter] = 0
+			continue
+		}
+		value, err := strconv.ParseFloat(field[1:], 64)
+		if err != nil {
+			// Parameters of vendor specific commands are not always
+			// numeric; only movement needs to parse.
+			if letter == 'X' || letter == 'Y' || letter == 'Z' || letter == 'E' || letter == 'F' {
+				return nil, fmt.Errorf("invalid parameter %q", field)
+			}
+			continue
+		}
+		params[letter] = value
+	}
+	return params, nil
+}
+
+func (s *state) toMM(v float64) float64 {
+	if s.inchUnits {
+		return v * 25.4
+	}
+	return v
+}
+
+func (s *state) target(current float64, params map[rune]float64, axis rune, relative bool) float64 {
+	v, ok := params[axis]
+	if !ok {
+		return current
+	}
+	if relative {
+		return current + s.toMM(v)
+	}
+	return s.toMM(v)
+}
+
+// move executes a linear move. Arcs are approximated by their chord.
+func (s *state) move(params map[rune]float64) {
+	if f, ok := params['F']; ok && f > 0 {
+		s.feedrate = s.toMM(f)
+	}
+
+	x := s.target(s.x, params, 'X', s.relative)
+	y := s.target(s.y, params, 'Y', s.relative)
+	z := s.target(s.z, params, 'Z', s.relative)
+	e := s.target(s.e, params, 'E', s.relativeE)
+
+	dx, dy, dz, de := x-s.x, y-s.y, z-s.z, e-s.e
+	distance := math.Sqrt(dx*dx + dy*dy + dz*dz)
+	if distance == 0 {
+		distance = math.Abs(de)
+	}
+	s.analysis.EstimatedSeconds += distance / (s.feedrate / 60)
+
+	if de > 0 {
+		s.analysis.FilamentLengthMM += de
+		if dx != 0 || dy != 0 {
+			s.extrudedAtZ[z] = true
+			s.extend(s.x, s.y, z)
+			s.extend(x, y, z)
+		}
+	}
+
+	s.x, s.y, s.z, s.e = x, y, z, e
+}
+
+func (s *state) extend(x, y, z float64) {
+	a := &s.analysis
+	if !s.haveBounds {
+		a.Min = models.Dimensions{X: x, Y: y, Z: z}
+		a.Max = a.Min
+		s.haveBounds = true
+		return
+	}
+	a.Min.X = math.Min(a.Min.X, x)
+	a.Min.Y = math.Min(a.Min.Y, y)
+	a.Min.Z = math.Min(a.Min.Z, z)
+	a.Max.X = math.Max(a.Max.X, x)
+	a.Max.Y = math.Max(a.Max.Y, y)
+	a.Max.Z = math.Max(a.Max.Z, z)
+}
+
+// IsGCode reports whether a file name looks like a G-code file.
+func IsGCode(name string) bool {
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".gcode", ".gco", ".g"} {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// hclogAdapter lets hashicorp/raft log through a slog logger. The level is
+// decided by the slog handler, so SetLevel has no effect.
+type hclogAdapter struct {
+	base   *slog.Logger
+	logger *slog.Logger
+	name   string
+	args   []interface{}
+}
+
+// NewHCLogger returns an hclog.Logger that writes to logger, naming its
+// records with name.
+func NewHCLogger(logger *slog.Logger, name string) hclog.Logger {
+	return newHCLogAdapter(logger, name, nil)
+}
+
+func newHCLogAdapter(base *slog.Logger, name string, args []interface{}) *hclogAdapter {
+	return &hclogAdapter{
+		base:   base,
+		logger: base.With("logger", name).With(args...),
+		name:   name,
+		args:   args,
+	}
+}
+
+func toSlogLevel(level hclog.Level) slog.Level {
+	switch level {
+	case hclog.Trace:
+		return LevelTrace
+	case hclog.Debug:
+		return slog.LevelDebug
+	case hclog.Warn:
+		return slog.LevelWarn
+	case hclog.Error:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+func (a *hclogAdapter) Log(level hclog.Level, msg string, args ...interface{}) {
+	a.logger.Log(context.Background(), toSlogLevel(level), msg, convertArgs(args)...)
+}
+
+// convertArgs formats the values hashicorp/raft logs the way hclog would, so
+// that structs and hclog.Fmt values do not come out empty in JSON.
+func convertArgs(args []interface{}) []interface{} {
+	converted := make([]interface{}, len(args))
+	for i, arg := range args {
+		if i%2 == 0 {
+			converted[i] = arg
+			continue
+		}
+
+		switch v := arg.(type) {
+		case hclog.Format:
+			if len(v) > 0 {
+				if format, ok := v[0].(string); ok {
+					converted[i] = fmt.Sprintf(format, v[1:]...)
+					continue
+				}
+			}
+			converted[i] = fmt.Sprint(v...)
+		case error:
+			converted[i] = v.Error()
+		case fmt.Stringer:
+			converted[i] = v.String()
+		case string, bool, int, int64, uint, uint64, int32, uint32, float64, float32, time.Duration, time.Time:
+			converted[i] = v
+		default:
+			converted[i] = fmt.Sprintf("%+v", v)
+		}
+	}
+	return converted
+}
+
+func (a *hclogAdapter) Trace(msg string, args ...interface{}) { a.Log(hclog.Trace, msg, args...) }
+func (a *hclogAdapter) Debug(msg string, args ...interface{}) { a.Log(hclog.Debug, msg, args...) }
+func (a *hclogAdapter) Info(msg string, args ...interface{})  { a.Log(hclog.Info, msg, args...) }
+func (a *hclogAdapter) Warn(msg string, args ...interface{})  { a.Log(hclog.Warn, msg, args...) }
+func (a *hclogAdapter) Error(msg string, args ...interface{}) { a.Log(hclog.Error, msg, args...) }
+
+func (a *hclogAdapter) enabled(level hclog.Level) bool {
+	return a.logger.Enabled(context.Background(), toSlogLevel(level))
+}
+
+func (a *hclogAdapter) IsTrace() bool { return a.enabled(hclog.Trace) }
+func (a *hclogAdapter) IsDebug() bool { return a.enabled(hclog.Debug) }
+func (a *hclogAdapter) IsInfo() bool  { return a.enabled(hclog.Info) }
+func (a *hclogAdapter) IsWarn() bool  { return a.enabled(hclog.Warn) }
+func (a *hclogAdapter) IsError() bool { return a.enabled(hclog.Error) }
+
+func (a *hclogAdapter) ImpliedArgs() []interface{} { return a.args }
+
+func (a *hclogAdapter) With(args ...interface{}) hclog.Logger {
+	return newHCLogAdapter(a.base, a.name, append(append([]interface{}(nil), a.args...), args...))
+}
+
+func (a *hclogAdapter) Name() string { return a.name }
+
+func (a *hclogAdapter) Named(name string) hclog.Logger {
+	if a.name != "" {
+		name = a.name + "." + name
+	}
+	return a.ResetNamed(name)
+}
+
+func (a *hclogAdapter) ResetNamed(name string) hclog.Logger {
+	return newHCLogAdapter(a.base, name, a.args)
+}
+
+func (a *hclogAdapter) SetLevel(level hclog.Level) {}
+
+func (a *hclogAdapter) GetLevel() hclog.Level {
+	for _, level := range []hclog.Level{hclog.Trace, hclog.Debug, hclog.Info, hclog.Warn} {
+		if a.enabled(level) {
+			return level
+		}
+	}
+	return hclog.Error
+}
+
+func (a *hclogAdapter) StandardLogger(opts *hclog.StandardLoggerOptions) *log.Logger {
+	return slog.NewLogLogger(a.logger.Handler(), a.standardLevel(opts))
+}
+
+func (a *hclogAdapter) StandardWriter(opts *hclog.StandardLoggerOptions) io.Writer {
+	return a.StandardLogger(opts).Writer()
+}
+
+func (a *hclogAdapter) standardLevel(opts *hclog.StandardLoggerOptions) slog.Level {
+	if opts != nil && opts.ForceLevel != hclog.NoLevel {
+		return toSlogLevel(opts.ForceLevel)
+	}
+	return slog.LevelInfo
+}
@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"time"
+
+	hraft "github.com/hashicorp/raft"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/raft3d/internal/fsm"
+	"github.com/raft3d/pkg/printer"
+	"github.com/raft3d/pkg/raft"
+)
+
+var raftStates = []hraft.RaftState{hraft.Follower, hraft.Candidate, hraft.Leader, hraft.Shutdown}
+
+// raftCollector reports the node's Raft term, indices and state at scrape
+// time. Commit and apply latencies come from the hashicorp/raft sink.
+type raftCollector struct {
+	raftServer *raft.Server
+
+	term         *prometheus.Desc
+	lastLogIndex *prometheus.Desc
+	commitIndex  *prometheus.Desc
+	appliedIndex *prometheus.Desc
+	lastContact  *prometheus.Desc
+	state        *prometheus.Desc
+}
+
+func newRaftCollector(raftServer *raft.Server) *raftCollector {
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "raft_node", name), help, labels, nil)
+	}
+	return &raftCollector{
+		raftServer:   raftServer,
+		term:         desc("term", "Current Raft term."),
+		lastLogIndex: desc("last_log_index", "Index of the last entry in the Raft log."),
+		commitIndex:  desc("commit_index", "Index of the last committed Raft log entry."),
+		appliedIndex: desc("applied_index", "Index of the last Raft log entry applied to the state machine."),
+		lastContact:  desc("last_contact_seconds", "Seconds since a follower last heard from the leader."),
+		state:        desc("state", "Raft state of the node, 1 for the current state.", "state"),
+	}
+}
+
+func (c *raftCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.term
+	ch <- c.lastLogIndex
+	ch <- c.commitIndex
+	ch <- c.appliedIndex
+	ch <- c.lastContact
+	ch <- c.state
+}
+
+func (c *raftCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.raftServer.Stats()
+
+	ch <- prometheus.MustNewConstMetric(c.term, prometheus.GaugeValue, float64(stats.Term))
+	ch <- prometheus.MustNewConstMetric(c.lastLogIndex, prometheus.GaugeValue, float64(stats.LastLogIndex))
+	ch <- prometheus.MustNewConstMetric(c.commitIndex, prometheus.GaugeValue, float64(stats.CommitIndex))
+	ch <- prometheus.MustNewConstMetric(c.appliedIndex, prometheus.GaugeValue, float64(stats.AppliedIndex))
+
+	if stats.State == hraft.Follower && !stats.LastContact.IsZero() {
+		ch <- prometheus.MustNewConstMetric(c.lastContact, prometheus.GaugeValue, time.Since(stats.LastContact).Seconds())
+	}
+
+	for _, state := range raftStates {
+		value := 0.0
+		if state == stats.State {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.state, prometheus.GaugeValue, value, state.String())
+	}
+}
+
+// storeCollector reports gauges summarising the replicated state. Every node
+// exports the same values for them, except for printers online: only the
+// leader polls printers, so only the leader reports it.
+type storeCollector struct {
+	raftServer *raft.Server
+	fsm        *fsm.FSM
+	printers   *printer.Manager
+
+	printJobs      *prometheus.Desc
+	filamentGrams  *prometheus.Desc
+	printerCount   *prometheus.Desc
+	printersOnline *prometheus.Desc
+}
+
+func newStoreCollector(raftServer *raft.Server, fsm *fsm.FSM, printers *printer.Manager) *storeCollector {
+	return &storeCollector{
+		raftServer: raftServer,
+		fsm:        fsm,
+		printers:   printers,
+		printJobs: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "print_jobs"),
+			"Print jobs by tenant and status.", []string{"tenant", "status"}, nil),
+		filamentGrams: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "filament_remaining_grams"),
+			"Remaining filament weight by tenant and filament type.", []string{"tenant", "type"}, nil),
+		printerCount: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "printers"),
+			"Registered printers by tenant.", []string{"tenant"}, nil),
+		printersOnline: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "printers_online"),
+			"Connected printers that answered their last poll, by tenant. Only exported by the leader.", []string{"tenant"}, nil),
+	}
+}
+
+func (c *storeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.printJobs
+	ch <- c.filamentGrams
+	ch <- c.printerCount
+	ch <- c.printersOnline
+}
+
+func (c *storeCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.fsm.Store().GetStats()
+
+	for tenant, byStatus := range stats.PrintJobs {
+		for status, count := range byStatus {
+			ch <- prometheus.MustNewConstMetric(c.printJobs, prometheus.GaugeValue, float64(count), tenant, status)
+		}
+	}
+
+	for tenant, byType := range stats.FilamentGrams {
+		for filamentType, grams := range byType {
+			ch <- prometheus.MustNewConstMetric(c.filamentGrams, prometheus.GaugeValue, float64(grams), tenant, filamentType)
+		}
+	}
+
+	for tenant, count := range stats.Printers {
+		ch <- prometheus.MustNewConstMetric(c.printerCount, prometheus.GaugeValue, float64(count), tenant)
+	}
+
+	if c.printers == nil || !c.raftServer.IsLeader() {
+		return
+	}
+
+	online := make(map[string]int)
+	for _, p := range c.fsm.Store().GetAllPrinters() {
+		if p.Connection == nil {
+			continue
+		}
+		count := online[p.TenantID]
+		if status, found := c.printers.Telemetry(p.TenantID, p.ID); found && status.State != printer.StateOffline {
+			count++
+		}
+		online[p.TenantID] = count
+	}
+
+	for tenant, count := range online {
+		ch <- prometheus.MustNewConstMetric(c.printersOnline, prometheus.GaugeValue, float64(count), tenant)
+	}
+}
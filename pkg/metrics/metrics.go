@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	gometrics "github.com/hashicorp/go-metrics/compat"
+	gometricsprom "github.com/hashicorp/go-metrics/compat/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/raft3d/internal/fsm"
+	"github.com/raft3d/pkg/printer"
+	"github.com/raft3d/pkg/raft"
+)
+
+const namespace = "raft3d"
+
+// Metrics exports the state of a node to Prometheus: what hashicorp/raft
+// reports about replication, the node's Raft indices, HTTP traffic and
+// gauges summarising the replicated state.
+type Metrics struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// New registers every collector of the node. hashicorp/raft reports through
+// a process wide sink, so New must only be called once per process. printers
+// may be nil when this node does not drive printers.
+func New(raftServer *raft.Server, fsm *fsm.FSM, printers *printer.Manager) (*Metrics, error) {
+	registry := prometheus.NewRegistry()
+
+	sink, err := gometricsprom.NewPrometheusSinkFrom(gometricsprom.PrometheusOpts{
+		Expiration: time.Minute,
+		Registerer: registry,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create raft metrics sink: %v", err)
+	}
+
+	config := gometrics.DefaultConfig(namespace)
+	config.EnableHostname = false
+	config.EnableRuntimeMetrics = false
+	if _, err := gometrics.NewGlobal(config, sink); err != nil {
+		return nil, fmt.Errorf("failed to install raft metrics sink: %v", err)
+	}
+
+	m := &Metrics{
+		registry: registry,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "HTTP requests by route, method and status code.",
+		}, []string{"route", "method", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "HTTP request latency by route and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+	}
+
+	for _, c := range []prometheus.Collector{
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.duration,
+		newRaftCollector(raftServer),
+		newStoreCollector(raftServer, fsm, printers),
+	} {
+		if err := registry.Register(c); err != nil {
+			return nil, fmt.Errorf("failed to register metrics: %v", err)
+		}
+	}
+
+	return m, nil
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware counts requests and their latency by route template, so that
+// requests for different IDs share one series. It must be installed on a
+// mux router.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if tpl, err := current.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		m.requests.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		m.duration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// statusRecorder remembers the status code written to a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush keeps streaming responses such as the event stream working.
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+const (
+	AlertPending   = "pending"
+	AlertDelivered = "delivered"
+)
+
+// Alert reports that a filament fell to or below its low stock threshold.
+// An alert is raised once per crossing; the filament has to be refilled above
+// the threshold before it can raise another.
+type Alert struct {
+	ID             string    `json:"id"`
+	TenantID       string    `json:"tenant_id,omitempty"`
+	FilamentID     string    `json:"filament_id"`
+	Material       string    `json:"material"`
+	Color          string    `json:"color"`
+	ThresholdGrams int       `json:"threshold_grams"`
+	RemainingGrams int       `json:"remaining_grams"`
+	Status         string    `json:"status"`
+	RaisedAt       time.Time `json:"raised_at"`
+	DeliveredAt    time.Time `json:"delivered_at,omitempty"`
+}
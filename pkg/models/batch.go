@@ -0,0 +1,58 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Batch groups the print jobs of one order or project, such as all parts of
+// an assembly, so they can be tracked and cancelled together.
+type Batch struct {
+	ID          string    `json:"id"`
+	TenantID    string    `json:"tenant_id,omitempty"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at,omitempty"`
+}
+
+const (
+	BatchEmpty      = "empty"
+	BatchQueued     = "queued"
+	BatchInProgress = "in_progress"
+	BatchDone       = "done"
+	BatchCancelled  = "cancelled"
+)
+
+// BatchProgress summarises the print jobs of a batch. Blocked counts queued
+// jobs still waiting for a dependency to finish.
+type BatchProgress struct {
+	Status         string  `json:"status"`
+	Total          int     `json:"total"`
+	Queued         int     `json:"queued"`
+	Blocked        int     `json:"blocked"`
+	Running        int     `json:"running"`
+	Done           int     `json:"done"`
+	Cancelled      int     `json:"cancelled"`
+	PercentDone    float64 `json:"percent_done"`
+	TotalGrams     int     `json:"total_grams"`
+	RemainingGrams int     `json:"remaining_grams"`
+}
+
+func (b *Batch) Validate() error {
+	if err := ValidateID("batch", b.ID); err != nil {
+		return err
+	}
+	if b.Name == "" {
+		return fmt.Errorf("batch name cannot be empty")
+	}
+	return nil
+}
+
+func (b *Batch) ToJSON() ([]byte, error) {
+	return json.Marshal(b)
+}
+
+func (b *Batch) FromJSON(data []byte) error {
+	return json.Unmarshal(data, b)
+}
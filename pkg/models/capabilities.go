@@ -0,0 +1,170 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+)
+
+const (
+	ExtruderDirect = "direct"
+	ExtruderBowden = "bowden"
+)
+
+const (
+	NozzleBrass          = "brass"
+	NozzleStainlessSteel = "stainless_steel"
+	NozzleHardenedSteel  = "hardened_steel"
+	NozzleRuby           = "ruby"
+)
+
+// wearResistantNozzles can print abrasive materials such as carbon or glass
+// filled blends without being destroyed.
+var wearResistantNozzles = map[string]bool{
+	NozzleHardenedSteel: true,
+	NozzleRuby:          true,
+}
+
+const (
+	DriverOctoPrint = "octoprint"
+	DriverMoonraker = "moonraker"
+	// DriverSimulated is a virtual printer run inside the leader, useful for
+	// development and testing without hardware.
+	DriverSimulated = "simulated"
+)
+
+// PrinterConnection tells the leader how to reach a printer's host software.
+// Printers without a connection are driven manually through the API.
+type PrinterConnection struct {
+	Driver string `json:"driver"`
+	URL    string `json:"url"`
+	APIKey string `json:"api_key,omitempty"`
+	// Options tune drivers that need more than a URL, such as the speed and
+	// failure rate of a simulated printer.
+	Options map[string]string `json:"options,omitempty"`
+}
+
+func (c *PrinterConnection) Validate() error {
+	switch c.Driver {
+	case DriverOctoPrint, DriverMoonraker:
+	case DriverSimulated:
+		// Simulated printers run in process and have no URL.
+		return nil
+	default:
+		return fmt.Errorf("connection driver must be one of: octoprint, moonraker, simulated")
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("connection URL must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// Dimensions is a size in millimetres.
+type Dimensions struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+// PrinterCapabilities describes the hardware of a printer. Printers without
+// capabilities are not checked for compatibility.
+type PrinterCapabilities struct {
+	BuildVolume      Dimensions `json:"build_volume_mm"`
+	NozzleDiameterMM float64    `json:"nozzle_diameter_mm"`
+	NozzleMaterial   string     `json:"nozzle_material"`
+	Extruder         string     `json:"extruder"`
+	MaxNozzleTempC   int        `json:"max_nozzle_temp_c"`
+	MaxBedTempC      int        `json:"max_bed_temp_c"`
+	Enclosed         bool       `json:"enclosed"`
+	// SupportedMaterials restricts the materials the printer accepts. An
+	// empty list accepts any material the hardware can handle.
+	SupportedMaterials []string `json:"supported_materials,omitempty"`
+	// MaterialUnits is the number of filaments the printer can feed, e.g.
+	// tool heads or AMS slots. Zero means a single filament.
+	MaterialUnits int `json:"material_units,omitempty"`
+}
+
+func (c *PrinterCapabilities) Validate() error {
+	if c.BuildVolume.X <= 0 || c.BuildVolume.Y <= 0 || c.BuildVolume.Z <= 0 {
+		return fmt.Errorf("build volume must be positive in every dimension")
+	}
+	if c.NozzleDiameterMM <= 0 {
+		return fmt.Errorf("nozzle diameter must be positive")
+	}
+	switch c.NozzleMaterial {
+	case NozzleBrass, NozzleStainlessSteel, NozzleHardenedSteel, NozzleRuby:
+	default:
+		return fmt.Errorf("nozzle material must be one of: brass, stainless_steel, hardened_steel, ruby")
+	}
+	if c.Extruder != ExtruderDirect && c.Extruder != ExtruderBowden {
+		return fmt.Errorf("extruder must be one of: direct, bowden")
+	}
+	if c.MaxNozzleTempC <= 0 {
+		return fmt.Errorf("max nozzle temperature must be positive")
+	}
+	if c.MaxBedTempC < 0 {
+		return fmt.Errorf("max bed temperature cannot be negative")
+	}
+	if c.MaterialUnits < 0 {
+		return fmt.Errorf("material units cannot be negative")
+	}
+	return nil
+}
+
+// Units returns the number of filaments the printer can feed at once.
+func (c *PrinterCapabilities) Units() int {
+	if c.MaterialUnits == 0 {
+		return 1
+	}
+	return c.MaterialUnits
+}
+
+// CheckMaterial returns an error describing why the printer cannot print the
+// material, or nil if it can.
+func (c *PrinterCapabilities) CheckMaterial(m *Material) error {
+	if len(c.SupportedMaterials) > 0 {
+		supported := false
+		for _, name := range c.SupportedMaterials {
+			if name == m.Name {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return fmt.Errorf("printer does not support %s", m.Name)
+		}
+	}
+
+	if m.NozzleTempMinC > c.MaxNozzleTempC {
+		return fmt.Errorf("%s needs a nozzle temperature of at least %d°C, printer reaches %d°C",
+			m.Name, m.NozzleTempMinC, c.MaxNozzleTempC)
+	}
+	if m.BedTempMinC > c.MaxBedTempC {
+		return fmt.Errorf("%s needs a bed temperature of at least %d°C, printer reaches %d°C",
+			m.Name, m.BedTempMinC, c.MaxBedTempC)
+	}
+	if m.Abrasive && !wearResistantNozzles[c.NozzleMaterial] {
+		return fmt.Errorf("%s is abrasive and would wear out a %s nozzle", m.Name, c.NozzleMaterial)
+	}
+	if m.Flexible && c.Extruder == ExtruderBowden {
+		return fmt.Errorf("%s is flexible and cannot be fed through a bowden extruder", m.Name)
+	}
+	if m.RequiresEnclosure && !c.Enclosed {
+		return fmt.Errorf("%s requires an enclosed printer", m.Name)
+	}
+
+	return nil
+}
+
+// CheckDimensions returns an error if a model of the given size does not fit
+// in the build volume, allowing the model to be rotated on the bed.
+func (c *PrinterCapabilities) CheckDimensions(d *Dimensions) error {
+	fits := d.Z <= c.BuildVolume.Z &&
+		((d.X <= c.BuildVolume.X && d.Y <= c.BuildVolume.Y) ||
+			(d.Y <= c.BuildVolume.X && d.X <= c.BuildVolume.Y))
+	if !fits {
+		return fmt.Errorf("model of %.1f x %.1f x %.1f mm does not fit build volume of %.1f x %.1f x %.1f mm",
+			d.X, d.Y, d.Z, c.BuildVolume.X, c.BuildVolume.Y, c.BuildVolume.Z)
+	}
+	return nil
+}
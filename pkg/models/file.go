@@ -0,0 +1,130 @@
+package models
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// FileManifest describes an uploaded G-code or 3MF file. File contents are
+// stored on each node, addressed by the SHA-256 of their bytes; only the
+// manifest goes through Raft. Tenants uploading the same contents share one
+// manifest but only see their own upload of it.
+type FileManifest struct {
+	Hash        string    `json:"hash"`
+	Name        string    `json:"name"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	UploadedAt  time.Time `json:"uploaded_at"`
+	// Sources are base URLs of nodes known to hold the contents, which
+	// other nodes fetch the file from.
+	Sources []string `json:"sources"`
+	// Analysis is set for G-code files.
+	Analysis *GCodeAnalysis `json:"analysis,omitempty"`
+	// Owners are the tenants that uploaded the contents. Manifests from
+	// before tenants owned files belong to the default tenant.
+	Owners []FileOwner `json:"owners,omitempty"`
+}
+
+// FileOwner records a tenant's upload of a file, under the name it was
+// uploaded with.
+type FileOwner struct {
+	TenantID   string    `json:"tenant_id"`
+	Name       string    `json:"name"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+// Owner returns the upload of the file by a tenant.
+func (m *FileManifest) Owner(tenantID string) (FileOwner, bool) {
+	for _, o := range m.Owners {
+		if o.TenantID == tenantID {
+			return o, true
+		}
+	}
+	return FileOwner{}, false
+}
+
+// ForTenant returns the manifest as one of its owners sees it: with the name
+// and upload time of that owner's upload, and without the other owners.
+func (m *FileManifest) ForTenant(tenantID string) (*FileManifest, bool) {
+	owner, ok := m.Owner(tenantID)
+	if !ok {
+		return nil, false
+	}
+
+	view := *m
+	view.Name = owner.Name
+	view.UploadedAt = owner.UploadedAt
+	view.Sources = append([]string(nil), m.Sources...)
+	view.Owners = []FileOwner{owner}
+	return &view, true
+}
+
+// GCodeAnalysis summarises what a G-code file will do on a printer.
+type GCodeAnalysis struct {
+	FilamentLengthMM float64    `json:"filament_length_mm"`
+	EstimatedSeconds float64    `json:"estimated_seconds"`
+	LayerCount       int        `json:"layer_count"`
+	Min              Dimensions `json:"min_mm"`
+	Max              Dimensions `json:"max_mm"`
+}
+
+// Size returns the extent of the extruded model.
+func (a *GCodeAnalysis) Size() Dimensions {
+	return Dimensions{
+		X: a.Max.X - a.Min.X,
+		Y: a.Max.Y - a.Min.Y,
+		Z: a.Max.Z,
+	}
+}
+
+// WeightGrams converts the extruded filament length to grams for a filament
+// of the given diameter and material density.
+func (a *GCodeAnalysis) WeightGrams(diameterMM, densityGPerCm3 float64) float64 {
+	radius := diameterMM / 2
+	volumeMM3 := math.Pi * radius * radius * a.FilamentLengthMM
+	return volumeMM3 / 1000 * densityGPerCm3
+}
+
+// ValidFileHash reports whether hash is a hex encoded SHA-256 digest.
+func ValidFileHash(hash string) bool {
+	if len(hash) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+func (m *FileManifest) Validate() error {
+	if !ValidFileHash(m.Hash) {
+		return fmt.Errorf("file hash must be a hex encoded SHA-256 digest")
+	}
+	if m.Name == "" {
+		return fmt.Errorf("file name cannot be empty")
+	}
+	if m.Size <= 0 {
+		return fmt.Errorf("file size must be positive")
+	}
+	if len(m.Sources) == 0 {
+		return fmt.Errorf("file must have at least one source")
+	}
+	for _, o := range m.Owners {
+		if err := ValidateID("tenant", o.TenantID); err != nil {
+			return err
+		}
+		if o.Name == "" {
+			return fmt.Errorf("file name cannot be empty")
+		}
+	}
+	return nil
+}
+
+func (m *FileManifest) ToJSON() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (m *FileManifest) FromJSON(data []byte) error {
+	return json.Unmarshal(data, m)
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Material describes a filament material type such as PLA or PETG. Filaments
+// reference a material by name in their Type field.
+type Material struct {
+	Name           string  `json:"name"`
+	NozzleTempMinC int     `json:"nozzle_temp_min_c"`
+	NozzleTempMaxC int     `json:"nozzle_temp_max_c"`
+	BedTempMinC    int     `json:"bed_temp_min_c"`
+	BedTempMaxC    int     `json:"bed_temp_max_c"`
+	DensityGPerCm3 float64 `json:"density_g_per_cm3"`
+	RequiresDrying bool    `json:"requires_drying"`
+	DryingTempC    int     `json:"drying_temp_c,omitempty"`
+	DryingHours    float64 `json:"drying_hours,omitempty"`
+	Abrasive       bool    `json:"abrasive"`
+	// Flexible materials cannot be pushed through a bowden tube.
+	Flexible          bool `json:"flexible"`
+	RequiresEnclosure bool `json:"requires_enclosure"`
+	// LowStockThresholdGrams is the default low stock threshold of
+	// filaments of this material. Zero disables alerts.
+	LowStockThresholdGrams int `json:"low_stock_threshold_grams,omitempty"`
+}
+
+// DefaultMaterials are registered on every new cluster so that the material
+// types accepted before the registry existed keep working.
+func DefaultMaterials() []*Material {
+	return []*Material{
+		{Name: "PLA", NozzleTempMinC: 190, NozzleTempMaxC: 220, BedTempMinC: 0, BedTempMaxC: 60, DensityGPerCm3: 1.24},
+		{Name: "PETG", NozzleTempMinC: 220, NozzleTempMaxC: 250, BedTempMinC: 70, BedTempMaxC: 90, DensityGPerCm3: 1.27,
+			RequiresDrying: true, DryingTempC: 65, DryingHours: 4},
+		{Name: "ABS", NozzleTempMinC: 230, NozzleTempMaxC: 260, BedTempMinC: 90, BedTempMaxC: 110, DensityGPerCm3: 1.04,
+			RequiresDrying: true, DryingTempC: 80, DryingHours: 4, RequiresEnclosure: true},
+		{Name: "TPU", NozzleTempMinC: 210, NozzleTempMaxC: 240, BedTempMinC: 0, BedTempMaxC: 60, DensityGPerCm3: 1.21,
+			RequiresDrying: true, DryingTempC: 50, DryingHours: 6, Flexible: true},
+	}
+}
+
+func (m *Material) Validate() error {
+	if m.Name == "" {
+		return fmt.Errorf("material name cannot be empty")
+	}
+	if m.NozzleTempMinC <= 0 || m.NozzleTempMaxC < m.NozzleTempMinC {
+		return fmt.Errorf("nozzle temperature range must be positive and ordered")
+	}
+	if m.BedTempMinC < 0 || m.BedTempMaxC < m.BedTempMinC {
+		return fmt.Errorf("bed temperature range must be non-negative and ordered")
+	}
+	if m.DensityGPerCm3 <= 0 {
+		return fmt.Errorf("density must be positive")
+	}
+	if m.RequiresDrying && (m.DryingTempC <= 0 || m.DryingHours <= 0) {
+		return fmt.Errorf("drying temperature and hours are required when drying is required")
+	}
+	if m.LowStockThresholdGrams < 0 {
+		return fmt.Errorf("low stock threshold cannot be negative")
+	}
+	return nil
+}
+
+func (m *Material) ToJSON() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (m *Material) FromJSON(data []byte) error {
+	return json.Unmarshal(data, m)
+}
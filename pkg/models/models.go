@@ -3,29 +3,147 @@ package models
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 )
 
+// ValidateID checks the ID of an entity of the given kind. IDs may not
+// contain '/', which separates the tenant from the ID in the keys entities
+// are stored under.
+func ValidateID(kind, id string) error {
+	if id == "" {
+		return fmt.Errorf("%s ID cannot be empty", kind)
+	}
+	if strings.Contains(id, "/") {
+		return fmt.Errorf("%s ID cannot contain '/'", kind)
+	}
+	return nil
+}
+
 type Printer struct {
-	ID      string `json:"id"`
-	Company string `json:"company"`
-	Model   string `json:"model"`
+	ID       string `json:"id"`
+	TenantID string `json:"tenant_id,omitempty"`
+	Company  string `json:"company"`
+	Model    string `json:"model"`
+	// Group pools printers that are interchangeable, e.g. a farm of identical
+	// machines, so their queues can be viewed together.
+	Group string `json:"group,omitempty"`
+
+	Capabilities *PrinterCapabilities `json:"capabilities,omitempty"`
+	Connection   *PrinterConnection   `json:"connection,omitempty"`
+
+	// NeedsClearing is set when a print on the printer ends and cleared when
+	// an operator reports its bed clear. No job starts on the printer in
+	// between, so that a print is never started on top of the last part.
+	NeedsClearing bool `json:"needs_clearing,omitempty"`
 }
 
 type Filament struct {
 	ID                     string `json:"id"`
+	TenantID               string `json:"tenant_id,omitempty"`
 	Type                   string `json:"type"`
 	Color                  string `json:"color"`
 	TotalWeightInGrams     int    `json:"total_weight_in_grams"`
 	RemainingWeightInGrams int    `json:"remaining_weight_in_grams"`
+
+	// DiameterMM is the filament diameter, 1.75 mm when unset.
+	DiameterMM float64 `json:"diameter_mm,omitempty"`
+	// LowStockThresholdGrams raises an alert when the remaining weight drops
+	// to it. When unset the threshold of the material applies.
+	LowStockThresholdGrams int `json:"low_stock_threshold_grams,omitempty"`
+}
+
+const DefaultFilamentDiameterMM = 1.75
+
+// Diameter returns the filament diameter in millimetres.
+func (f *Filament) Diameter() float64 {
+	if f.DiameterMM == 0 {
+		return DefaultFilamentDiameterMM
+	}
+	return f.DiameterMM
 }
 
 type PrintJob struct {
 	ID                 string `json:"id"`
+	TenantID           string `json:"tenant_id,omitempty"`
 	PrinterID          string `json:"printer_id"`
 	FilamentID         string `json:"filament_id"`
 	Filepath           string `json:"filepath"`
+	FileHash           string `json:"file_hash,omitempty"`
 	PrintWeightInGrams int    `json:"print_weight_in_grams"`
 	Status             string `json:"status"`
+
+	// ModelDimensions is the bounding box of the printed model, checked
+	// against the build volume of the printer when known.
+	ModelDimensions *Dimensions `json:"model_dimensions_mm,omitempty"`
+	// EstimatedDurationSeconds is derived from the G-code file, if any.
+	EstimatedDurationSeconds int `json:"estimated_duration_seconds,omitempty"`
+
+	// Priority is one of urgent, normal or batch, normal when unset.
+	Priority string `json:"priority,omitempty"`
+	// SubmittedBy identifies who queued the job, for fair share ordering.
+	SubmittedBy string `json:"submitted_by,omitempty"`
+	// Sequence and SubmittedAt are assigned when the job is applied and
+	// record submission order.
+	Sequence    uint64    `json:"sequence,omitempty"`
+	SubmittedAt time.Time `json:"submitted_at,omitempty"`
+	// StartedAt is when the job last became Running.
+	StartedAt time.Time `json:"started_at,omitempty"`
+
+	// BatchID optionally places the job in a batch of the same tenant.
+	BatchID string `json:"batch_id,omitempty"`
+	// DependsOn lists jobs that must be Done before this job may start.
+	DependsOn []string `json:"depends_on,omitempty"`
+
+	// Filaments lists the spools a multi-material job feeds from. When set,
+	// FilamentID is the filament of the first slot and PrintWeightInGrams
+	// the total weight of all slots.
+	Filaments []FilamentSlot `json:"filaments,omitempty"`
+}
+
+// FilamentSlot assigns a filament to one material unit of the printer, e.g.
+// a tool head or an AMS lane, numbered from 0.
+type FilamentSlot struct {
+	Slot          int    `json:"slot"`
+	FilamentID    string `json:"filament_id"`
+	WeightInGrams int    `json:"weight_in_grams"`
+}
+
+// MaxFilamentSlots is the most filaments a single job may use.
+const MaxFilamentSlots = 16
+
+// Slots returns the filaments a job uses. Jobs created with a single
+// filament report it as slot 0.
+func (j *PrintJob) Slots() []FilamentSlot {
+	if len(j.Filaments) > 0 {
+		return j.Filaments
+	}
+	return []FilamentSlot{{Slot: 0, FilamentID: j.FilamentID, WeightInGrams: j.PrintWeightInGrams}}
+}
+
+// UsesFilament reports whether any slot of the job uses the filament.
+func (j *PrintJob) UsesFilament(filamentID string) bool {
+	for _, slot := range j.Slots() {
+		if slot.FilamentID == filamentID {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeFilaments keeps the single filament fields and the slot list of a
+// job consistent, whichever of them the client filled in.
+func (j *PrintJob) NormalizeFilaments() {
+	if len(j.Filaments) == 0 {
+		j.Filaments = j.Slots()
+		return
+	}
+
+	j.FilamentID = j.Filaments[0].FilamentID
+	j.PrintWeightInGrams = 0
+	for _, slot := range j.Filaments {
+		j.PrintWeightInGrams += slot.WeightInGrams
+	}
 }
 
 const (
@@ -35,9 +153,27 @@ const (
 	StatusCancelled = "Cancelled"
 )
 
+const (
+	PriorityUrgent = "urgent"
+	PriorityNormal = "normal"
+	PriorityBatch  = "batch"
+)
+
+// PriorityRank orders priorities, lower ranks printing first.
+func PriorityRank(priority string) int {
+	switch priority {
+	case PriorityUrgent:
+		return 0
+	case PriorityBatch:
+		return 2
+	default:
+		return 1
+	}
+}
+
 func (p *Printer) Validate() error {
-	if p.ID == "" {
-		return fmt.Errorf("printer ID cannot be empty")
+	if err := ValidateID("printer", p.ID); err != nil {
+		return err
 	}
 	if p.Company == "" {
 		return fmt.Errorf("printer company cannot be empty")
@@ -45,23 +181,28 @@ func (p *Printer) Validate() error {
 	if p.Model == "" {
 		return fmt.Errorf("printer model cannot be empty")
 	}
+	if p.Capabilities != nil {
+		if err := p.Capabilities.Validate(); err != nil {
+			return err
+		}
+	}
+	if p.Connection != nil {
+		if err := p.Connection.Validate(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 func (f *Filament) Validate() error {
-	if f.ID == "" {
-		return fmt.Errorf("filament ID cannot be empty")
+	if err := ValidateID("filament", f.ID); err != nil {
+		return err
 	}
 
-	validTypes := map[string]bool{
-		"PLA":  true,
-		"PETG": true,
-		"ABS":  true,
-		"TPU":  true,
-	}
-
-	if !validTypes[f.Type] {
-		return fmt.Errorf("filament type must be one of: PLA, PETG, ABS, TPU")
+	// The type must also name a registered material; that is checked
+	// against the replicated registry when the filament is applied.
+	if f.Type == "" {
+		return fmt.Errorf("filament type cannot be empty")
 	}
 
 	if f.Color == "" {
@@ -76,25 +217,66 @@ func (f *Filament) Validate() error {
 		return fmt.Errorf("remaining weight must be between 0 and total weight")
 	}
 
+	if f.DiameterMM < 0 {
+		return fmt.Errorf("filament diameter cannot be negative")
+	}
+
+	if f.LowStockThresholdGrams < 0 {
+		return fmt.Errorf("low stock threshold cannot be negative")
+	}
+
 	return nil
 }
 
 func (j *PrintJob) Validate() error {
-	if j.ID == "" {
-		return fmt.Errorf("print job ID cannot be empty")
+	if err := ValidateID("print job", j.ID); err != nil {
+		return err
 	}
-	if j.PrinterID == "" {
-		return fmt.Errorf("printer ID cannot be empty")
+	if err := ValidateID("printer", j.PrinterID); err != nil {
+		return err
 	}
-	if j.FilamentID == "" {
-		return fmt.Errorf("filament ID cannot be empty")
+	if j.FilamentID != "" || len(j.Filaments) == 0 {
+		if err := ValidateID("filament", j.FilamentID); err != nil {
+			return err
+		}
+	}
+	if j.BatchID != "" {
+		if err := ValidateID("batch", j.BatchID); err != nil {
+			return err
+		}
 	}
-	if j.Filepath == "" {
-		return fmt.Errorf("filepath cannot be empty")
+	if err := j.validateSlots(); err != nil {
+		return err
 	}
-	if j.PrintWeightInGrams <= 0 {
+	if j.Filepath == "" && j.FileHash == "" {
+		return fmt.Errorf("filepath or file hash is required")
+	}
+	if j.FileHash != "" && !ValidFileHash(j.FileHash) {
+		return fmt.Errorf("file hash must be a hex encoded SHA-256 digest")
+	}
+	// Jobs printing an uploaded G-code file may leave the weight out; it is
+	// then derived from the file when the job is applied.
+	if j.PrintWeightInGrams < 0 || (j.PrintWeightInGrams == 0 && j.FileHash == "") {
 		return fmt.Errorf("print weight must be positive")
 	}
+	if d := j.ModelDimensions; d != nil && (d.X <= 0 || d.Y <= 0 || d.Z <= 0) {
+		return fmt.Errorf("model dimensions must be positive")
+	}
+
+	for _, dep := range j.DependsOn {
+		if err := ValidateID("dependency", dep); err != nil {
+			return err
+		}
+		if dep == j.ID {
+			return fmt.Errorf("print job cannot depend on itself")
+		}
+	}
+
+	switch j.Priority {
+	case PriorityUrgent, PriorityNormal, PriorityBatch:
+	default:
+		return fmt.Errorf("priority must be one of: urgent, normal, batch")
+	}
 
 	validStatuses := map[string]bool{
 		StatusQueued:    true,
@@ -110,6 +292,38 @@ func (j *PrintJob) Validate() error {
 	return nil
 }
 
+func (j *PrintJob) validateSlots() error {
+	if len(j.Filaments) > MaxFilamentSlots {
+		return fmt.Errorf("print job cannot use more than %d filaments", MaxFilamentSlots)
+	}
+
+	slots := make(map[int]bool)
+	filaments := make(map[string]bool)
+	for _, slot := range j.Filaments {
+		if err := ValidateID("filament", slot.FilamentID); err != nil {
+			return err
+		}
+		if slot.Slot < 0 {
+			return fmt.Errorf("filament slot cannot be negative")
+		}
+		if slots[slot.Slot] {
+			return fmt.Errorf("filament slot %d is used twice", slot.Slot)
+		}
+		if filaments[slot.FilamentID] {
+			return fmt.Errorf("filament %s is used in more than one slot", slot.FilamentID)
+		}
+		slots[slot.Slot] = true
+		filaments[slot.FilamentID] = true
+
+		// A single filament job printing an uploaded file may leave its
+		// weight to be derived from the file.
+		if slot.WeightInGrams < 0 || (slot.WeightInGrams == 0 && (j.FileHash == "" || len(j.Filaments) > 1)) {
+			return fmt.Errorf("weight of filament slot %d must be positive", slot.Slot)
+		}
+	}
+	return nil
+}
+
 func (j *PrintJob) ValidateTransition(newStatus string) error {
 
 	validTransitions := map[string]map[string]bool{
@@ -0,0 +1,34 @@
+package models
+
+import "testing"
+
+func TestValidateIDRejectsSlash(t *testing.T) {
+	printer := Printer{ID: "a/b", Company: "Prusa", Model: "MK4"}
+	if err := printer.Validate(); err == nil {
+		t.Error("printer ID with '/' was accepted")
+	}
+	tenant := Tenant{ID: "acme/east", Name: "Acme"}
+	if err := tenant.Validate(); err == nil {
+		t.Error("tenant ID with '/' was accepted")
+	}
+
+	job := PrintJob{
+		ID: "job1", PrinterID: "p1", FilamentID: "f1", Filepath: "part.gcode",
+		PrintWeightInGrams: 10, Priority: PriorityNormal, Status: StatusQueued,
+	}
+	if err := job.Validate(); err != nil {
+		t.Fatalf("Validate() = %v", err)
+	}
+	for name, mutate := range map[string]func(*PrintJob){
+		"printer":    func(j *PrintJob) { j.PrinterID = "x/p1" },
+		"filament":   func(j *PrintJob) { j.FilamentID = "x/f1" },
+		"dependency": func(j *PrintJob) { j.DependsOn = []string{"x/job0"} },
+		"batch":      func(j *PrintJob) { j.BatchID = "x/b1" },
+	} {
+		bad := job
+		mutate(&bad)
+		if err := bad.Validate(); err == nil {
+			t.Errorf("%s ID with '/' was accepted", name)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// SpoolLoad records that a filament is physically mounted in a slot of a
+// printer, e.g. on a tool head or in an AMS lane.
+type SpoolLoad struct {
+	TenantID   string    `json:"tenant_id,omitempty"`
+	PrinterID  string    `json:"printer_id"`
+	Slot       int       `json:"slot"`
+	FilamentID string    `json:"filament_id"`
+	LoadedAt   time.Time `json:"loaded_at,omitempty"`
+}
+
+func (l *SpoolLoad) Validate() error {
+	if err := ValidateID("printer", l.PrinterID); err != nil {
+		return err
+	}
+	if l.Slot < 0 {
+		return fmt.Errorf("filament slot cannot be negative")
+	}
+	if err := ValidateID("filament", l.FilamentID); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DefaultTenant owns every entity created without an explicit tenant,
+// including everything that existed before tenants were introduced.
+const DefaultTenant = "default"
+
+type Tenant struct {
+	ID    string      `json:"id"`
+	Name  string      `json:"name"`
+	Quota TenantQuota `json:"quota"`
+}
+
+// TenantQuota limits what a tenant may consume. Zero means unlimited.
+type TenantQuota struct {
+	MaxQueuedJobs        int `json:"max_queued_jobs"`
+	MonthlyFilamentGrams int `json:"monthly_filament_grams"`
+}
+
+// UsagePeriod returns the calendar month a timestamp is accounted to.
+func UsagePeriod(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+func (t *Tenant) Validate() error {
+	if err := ValidateID("tenant", t.ID); err != nil {
+		return err
+	}
+	if t.Name == "" {
+		return fmt.Errorf("tenant name cannot be empty")
+	}
+	if t.Quota.MaxQueuedJobs < 0 {
+		return fmt.Errorf("max queued jobs cannot be negative")
+	}
+	if t.Quota.MonthlyFilamentGrams < 0 {
+		return fmt.Errorf("monthly filament grams cannot be negative")
+	}
+	return nil
+}
+
+func (t *Tenant) ToJSON() ([]byte, error) {
+	return json.Marshal(t)
+}
+
+func (t *Tenant) FromJSON(data []byte) error {
+	return json.Unmarshal(data, t)
+}
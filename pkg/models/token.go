@@ -0,0 +1,70 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+var roleRanks = map[string]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// APIToken binds a hashed bearer token to a role. The plaintext token is only
+// ever returned once, when the token is created. A token with a TenantID only
+// grants access to that tenant; an empty TenantID grants access to all of them.
+type APIToken struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	TenantID  string `json:"tenant_id,omitempty"`
+	TokenHash string `json:"token_hash,omitempty"`
+}
+
+// HashToken returns the hex encoded SHA-256 digest stored for a bearer token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RoleAllows reports whether role grants at least the permissions of required.
+func RoleAllows(role, required string) bool {
+	rank, ok := roleRanks[role]
+	if !ok {
+		return false
+	}
+	return rank >= roleRanks[required]
+}
+
+func (t *APIToken) Validate() error {
+	if t.ID == "" {
+		return fmt.Errorf("token ID cannot be empty")
+	}
+	if t.Name == "" {
+		return fmt.Errorf("token name cannot be empty")
+	}
+	if _, ok := roleRanks[t.Role]; !ok {
+		return fmt.Errorf("role must be one of: viewer, operator, admin")
+	}
+	if t.TokenHash == "" {
+		return fmt.Errorf("token hash cannot be empty")
+	}
+	return nil
+}
+
+func (t *APIToken) ToJSON() ([]byte, error) {
+	return json.Marshal(t)
+}
+
+func (t *APIToken) FromJSON(data []byte) error {
+	return json.Unmarshal(data, t)
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Webhook subscribes an HTTP endpoint to events of a tenant. Deliveries are
+// signed with Secret so the receiver can verify they came from the cluster.
+type Webhook struct {
+	ID       string `json:"id"`
+	TenantID string `json:"tenant_id,omitempty"`
+	URL      string `json:"url"`
+	Secret   string `json:"secret,omitempty"`
+	// EventTypes selects the events to deliver; empty means all of them.
+	EventTypes []string  `json:"event_types,omitempty"`
+	Disabled   bool      `json:"disabled,omitempty"`
+	CreatedAt  time.Time `json:"created_at,omitempty"`
+}
+
+// Wants reports whether the webhook subscribes to an event type.
+func (w *Webhook) Wants(eventType string) bool {
+	if w.Disabled {
+		return false
+	}
+	if len(w.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range w.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Webhook) Validate() error {
+	if err := ValidateID("webhook", w.ID); err != nil {
+		return err
+	}
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook URL must be an absolute http or https URL")
+	}
+	if w.Secret == "" {
+		return fmt.Errorf("webhook secret cannot be empty")
+	}
+	return nil
+}
+
+func (w *Webhook) ToJSON() ([]byte, error) {
+	return json.Marshal(w)
+}
+
+func (w *Webhook) FromJSON(data []byte) error {
+	return json.Unmarshal(data, w)
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is one event on its way to one webhook.
+type WebhookDelivery struct {
+	ID        string          `json:"id"`
+	TenantID  string          `json:"tenant_id,omitempty"`
+	WebhookID string          `json:"webhook_id"`
+	EventID   string          `json:"event_id"`
+	EventType string          `json:"event_type"`
+	Payload   json.RawMessage `json:"payload"`
+	Status    string          `json:"status"`
+	Attempts  int             `json:"attempts"`
+	// NextAttemptAt is when the leader retries a pending delivery.
+	NextAttemptAt  time.Time `json:"next_attempt_at"`
+	LastStatusCode int       `json:"last_status_code,omitempty"`
+	LastError      string    `json:"last_error,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	CompletedAt    time.Time `json:"completed_at,omitempty"`
+}
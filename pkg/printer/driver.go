@@ -0,0 +1,70 @@
+package printer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/raft3d/pkg/models"
+)
+
+// State is the normalised state of a printer as reported by its host software.
+type State string
+
+const (
+	StateIdle     State = "idle"
+	StatePrinting State = "printing"
+	StatePaused   State = "paused"
+	StateComplete State = "complete"
+	// StateCancelling is a printer still winding down a cancelled print; it
+	// is busy until it reports StateCancelled or StateIdle.
+	StateCancelling State = "cancelling"
+	StateCancelled  State = "cancelled"
+	StateError      State = "error"
+	StateOffline    State = "offline"
+)
+
+// Status is a point in time report from a printer.
+type Status struct {
+	State       State   `json:"state"`
+	FileName    string  `json:"file_name,omitempty"`
+	Progress    float64 `json:"progress"`
+	NozzleTempC float64 `json:"nozzle_temp_c"`
+	BedTempC    float64 `json:"bed_temp_c"`
+	Message     string  `json:"message,omitempty"`
+}
+
+// Driver controls a single printer.
+type Driver interface {
+	// Upload stores a print file on the printer under name.
+	Upload(ctx context.Context, name string, r io.Reader) error
+	// Start begins printing a previously uploaded file.
+	Start(ctx context.Context, name string) error
+	// Cancel aborts the current print.
+	Cancel(ctx context.Context) error
+	// Status reports what the printer is doing.
+	Status(ctx context.Context) (*Status, error)
+}
+
+// NewDriver returns the driver for a printer connection.
+func NewDriver(conn *models.PrinterConnection, client *http.Client) (Driver, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	switch conn.Driver {
+	case models.DriverOctoPrint:
+		return NewOctoPrint(conn.URL, conn.APIKey, client), nil
+	case models.DriverMoonraker:
+		return NewMoonraker(conn.URL, conn.APIKey, client), nil
+	case models.DriverSimulated:
+		opts, err := ParseSimulatorOptions(conn.Options)
+		if err != nil {
+			return nil, err
+		}
+		return NewSimulator(opts), nil
+	default:
+		return nil, fmt.Errorf("unknown printer driver: %s", conn.Driver)
+	}
+}
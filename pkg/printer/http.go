@@ -0,0 +1,102 @@
+package printer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// apiClient holds what the HTTP based drivers have in common.
+type apiClient struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+func (c *apiClient) do(ctx context.Context, method, path string, body io.Reader, contentType string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(c.baseURL, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-Api-Key", c.apiKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &statusError{code: resp.StatusCode, msg: strings.TrimSpace(string(msg))}
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response from %s: %v", path, err)
+	}
+	return nil
+}
+
+func (c *apiClient) doJSON(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+	return c.do(ctx, method, path, body, contentType, out)
+}
+
+// upload posts r as the "file" field of a multipart form, streaming it rather
+// than buffering the whole file.
+func (c *apiClient) upload(ctx context.Context, path, name string, r io.Reader, fields map[string]string) error {
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+
+	go func() {
+		err := func() error {
+			for k, v := range fields {
+				if err := form.WriteField(k, v); err != nil {
+					return err
+				}
+			}
+			part, err := form.CreateFormFile("file", name)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(part, r); err != nil {
+				return err
+			}
+			return form.Close()
+		}()
+		pw.CloseWithError(err)
+	}()
+
+	return c.do(ctx, http.MethodPost, path, pr, form.FormDataContentType(), nil)
+}
+
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("printer returned HTTP %d: %s", e.code, e.msg)
+}
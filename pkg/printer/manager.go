@@ -0,0 +1,334 @@
+package printer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/raft3d/internal/fsm"
+	"github.com/raft3d/pkg/blob"
+	"github.com/raft3d/pkg/models"
+	"github.com/raft3d/pkg/raft"
+)
+
+// startGrace is how long a freshly started print may report an idle printer
+// before the job is considered aborted.
+const startGrace = 30 * time.Second
+
+// Manager drives every printer that has a connection. It only acts while this
+// node is the leader: it uploads and starts queued jobs on idle printers,
+// polls printers for progress, cancels prints whose job was cancelled and
+// feeds Running, Done and Cancelled transitions back through Raft.
+type Manager struct {
+	raftServer leader
+	fsm        *fsm.FSM
+	blobs      *blob.Store
+	replicator *blob.Replicator
+	client     *http.Client
+
+	// Interval between polls of every printer.
+	Interval time.Duration
+	// Logger receives failures to drive printers.
+	Logger *slog.Logger
+
+	mu        sync.Mutex
+	drivers   map[string]*driverEntry
+	telemetry map[string]*Status
+	// inFlight holds the printers whose last pass has not finished.
+	inFlight map[string]bool
+}
+
+// leader is the part of the Raft server the manager needs.
+type leader interface {
+	IsLeader() bool
+	ApplyCommand(cmd *fsm.Command, timeout time.Duration) (interface{}, error)
+}
+
+type driverEntry struct {
+	conn   models.PrinterConnection
+	driver Driver
+}
+
+func NewManager(raftServer *raft.Server, fsm *fsm.FSM, blobs *blob.Store, replicator *blob.Replicator, client *http.Client) *Manager {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Minute}
+	}
+	return &Manager{
+		raftServer: raftServer,
+		fsm:        fsm,
+		blobs:      blobs,
+		replicator: replicator,
+		client:     client,
+		Interval:   5 * time.Second,
+		Logger:     slog.Default(),
+		drivers:    make(map[string]*driverEntry),
+		telemetry:  make(map[string]*Status),
+		inFlight:   make(map[string]bool),
+	}
+}
+
+func printerKey(tenantID, printerID string) string {
+	return tenantID + "/" + printerID
+}
+
+// RemoteFileName is the name a job's file is stored under on the printer. It
+// is derived from the file hash so that a new leader recognises prints
+// started by its predecessor.
+func RemoteFileName(job *models.PrintJob) string {
+	return fmt.Sprintf("raft3d-%s.gcode", job.FileHash[:16])
+}
+
+func (m *Manager) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(m.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !m.raftServer.IsLeader() {
+				continue
+			}
+			m.reconcile()
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// reconcile starts a pass over every printer with a connection, skipping
+// printers whose previous pass is still running, e.g. uploading a file, so
+// that a slow printer only holds up itself. The returned channel is closed
+// once the passes it started are done.
+func (m *Manager) reconcile() <-chan struct{} {
+	var wg sync.WaitGroup
+	for _, p := range m.fsm.Store().GetAllPrinters() {
+		if p.Connection == nil {
+			continue
+		}
+		key := printerKey(p.TenantID, p.ID)
+
+		m.mu.Lock()
+		busy := m.inFlight[key]
+		m.inFlight[key] = true
+		m.mu.Unlock()
+		if busy {
+			continue
+		}
+
+		printer := *p
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				m.mu.Lock()
+				delete(m.inFlight, key)
+				m.mu.Unlock()
+			}()
+			ctx, cancel := context.WithTimeout(context.Background(), m.client.Timeout)
+			defer cancel()
+			m.reconcilePrinter(ctx, &printer)
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return done
+}
+
+func (m *Manager) reconcilePrinter(ctx context.Context, printer *models.Printer) {
+	key := printerKey(printer.TenantID, printer.ID)
+
+	drv, err := m.driverFor(key, printer.Connection)
+	if err != nil {
+		m.setTelemetry(key, &Status{State: StateOffline, Message: err.Error()})
+		return
+	}
+
+	status, err := drv.Status(ctx)
+	if err != nil {
+		m.setTelemetry(key, &Status{State: StateOffline, Message: err.Error()})
+		return
+	}
+	m.setTelemetry(key, status)
+
+	jobs := m.fsm.Store().GetPrinterJobs(printer.TenantID, printer.ID)
+
+	for i := range jobs {
+		job := &jobs[i]
+		if job.Status != models.StatusRunning {
+			continue
+		}
+		// Jobs without an uploaded file are printed by hand and keep the
+		// printer busy until they are marked Done or Cancelled.
+		if job.FileHash != "" {
+			m.trackRunning(job, status)
+		}
+		return
+	}
+
+	switch status.State {
+	case StatePrinting, StatePaused:
+		// Stop prints the cluster has cancelled in the meantime.
+		for i := range jobs {
+			job := &jobs[i]
+			if job.Status == models.StatusCancelled && job.FileHash != "" && RemoteFileName(job) == status.FileName {
+				if err := drv.Cancel(ctx); err != nil {
+					m.Logger.Warn("failed to cancel print", "tenant", printer.TenantID, "printer", printer.ID, "err", err)
+				}
+				return
+			}
+		}
+	case StateIdle, StateComplete, StateCancelled:
+		if printer.NeedsClearing {
+			// The last print is still on the bed
+			return
+		}
+		queue := m.fsm.Store().GetQueue(printer.TenantID, printer.ID, "")
+		if next := nextJob(queue, m.fsm.Store().CheckSpoolsLoaded); next != nil {
+			m.startJob(ctx, drv, next)
+		}
+	}
+}
+
+// trackRunning turns what the printer reports about a running job into a
+// Done or Cancelled transition once the print is over.
+func (m *Manager) trackRunning(job *models.PrintJob, status *Status) {
+	remote := RemoteFileName(job)
+
+	switch status.State {
+	case StatePrinting, StatePaused, StateCancelling, StateOffline:
+		return
+	case StateComplete:
+		if status.FileName == remote {
+			m.transition(job, models.StatusDone)
+			return
+		}
+	case StateIdle:
+		if status.FileName == remote && status.Progress >= 1 {
+			m.transition(job, models.StatusDone)
+			return
+		}
+	}
+
+	// The start time is replicated so that a new leader leaves prints its
+	// predecessor just started alone too
+	if time.Since(job.StartedAt) < startGrace {
+		return
+	}
+
+	m.transition(job, models.StatusCancelled)
+}
+
+// nextJob picks the job to print next from a printer's queue, skipping jobs
+// without an uploaded file as those cannot be sent to the printer, and jobs
+// whose filaments are not loaded.
+func nextJob(queue []models.PrintJob, loaded func(*models.PrintJob) error) *models.PrintJob {
+	for i := range queue {
+		if queue[i].FileHash != "" && loaded(&queue[i]) == nil {
+			return &queue[i]
+		}
+	}
+	return nil
+}
+
+func (m *Manager) startJob(ctx context.Context, drv Driver, job *models.PrintJob) {
+	manifest, found := m.fsm.Store().GetFile(job.FileHash)
+	if !found {
+		return
+	}
+
+	if !m.blobs.Has(job.FileHash) {
+		if err := m.replicator.Fetch(ctx, manifest); err != nil {
+			m.Logger.Warn("failed to fetch file for print job", "tenant", job.TenantID, "job", job.ID, "err", err)
+			return
+		}
+	}
+
+	file, err := m.blobs.Open(job.FileHash)
+	if err != nil {
+		m.Logger.Error("failed to open file for print job", "tenant", job.TenantID, "job", job.ID, "err", err)
+		return
+	}
+	defer file.Close()
+
+	remote := RemoteFileName(job)
+	if err := drv.Upload(ctx, remote, file); err != nil {
+		m.Logger.Warn("failed to upload print job", "tenant", job.TenantID, "job", job.ID, "printer", job.PrinterID, "err", err)
+		return
+	}
+
+	if err := drv.Start(ctx, remote); err != nil {
+		m.Logger.Warn("failed to start print job", "tenant", job.TenantID, "job", job.ID, "printer", job.PrinterID, "err", err)
+		return
+	}
+
+	if err := m.transition(job, models.StatusRunning); err != nil {
+		// The job changed under us; do not leave the printer running it.
+		if err := drv.Cancel(ctx); err != nil {
+			m.Logger.Warn("failed to cancel print", "tenant", job.TenantID, "printer", job.PrinterID, "err", err)
+		}
+	}
+}
+
+func (m *Manager) transition(job *models.PrintJob, status string) error {
+	statusData, err := json.Marshal(fsm.PrintJobStatusChange{
+		ID:       job.ID,
+		TenantID: job.TenantID,
+		Status:   status,
+	})
+	if err != nil {
+		return err
+	}
+
+	cmd := fsm.Command{
+		Op:         fsm.OpUpdate,
+		EntityType: fsm.EntityPrintJob,
+		Payload:    statusData,
+	}
+
+	if _, err := m.raftServer.ApplyCommand(&cmd, 5*time.Second); err != nil {
+		m.Logger.Warn("failed to update print job status", "tenant", job.TenantID, "job", job.ID, "status", status, "err", err)
+		return err
+	}
+	return nil
+}
+
+func (m *Manager) driverFor(key string, conn *models.PrinterConnection) (Driver, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry, ok := m.drivers[key]; ok && reflect.DeepEqual(entry.conn, *conn) {
+		return entry.driver, nil
+	}
+
+	drv, err := NewDriver(conn, m.client)
+	if err != nil {
+		return nil, err
+	}
+	m.drivers[key] = &driverEntry{conn: *conn, driver: drv}
+	return drv, nil
+}
+
+func (m *Manager) setTelemetry(key string, status *Status) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.telemetry[key] = status
+}
+
+// Telemetry returns the last status polled from a printer. Only the leader
+// polls printers.
+func (m *Manager) Telemetry(tenantID, printerID string) (*Status, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status, found := m.telemetry[printerKey(tenantID, printerID)]
+	return status, found
+}
@@ -0,0 +1,319 @@
+package printer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	hraft "github.com/hashicorp/raft"
+	"github.com/raft3d/internal/fsm"
+	"github.com/raft3d/pkg/blob"
+	"github.com/raft3d/pkg/models"
+)
+
+// fakeLeader applies commands straight to an FSM, as a single node cluster
+// would.
+type fakeLeader struct {
+	fsm   *fsm.FSM
+	index uint64
+	// clock, if set, is the leader's time.
+	clock time.Time
+}
+
+func (l *fakeLeader) IsLeader() bool { return true }
+
+func (l *fakeLeader) ApplyCommand(cmd *fsm.Command, timeout time.Duration) (interface{}, error) {
+	if cmd.Timestamp.IsZero() {
+		cmd.Timestamp = time.Now().UTC()
+		if !l.clock.IsZero() {
+			cmd.Timestamp = l.clock
+		}
+	}
+	cmd.Version = fsm.CommandVersion
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, err
+	}
+	l.index++
+	resp := l.fsm.Apply(&hraft.Log{Index: l.index, Data: data})
+	if err, ok := resp.(error); ok {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (l *fakeLeader) apply(t *testing.T, op, entityType string, payload interface{}) {
+	t.Helper()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.ApplyCommand(&fsm.Command{Op: op, EntityType: entityType, Payload: data}, time.Second); err != nil {
+		t.Fatalf("%s %s: %v", op, entityType, err)
+	}
+}
+
+// fakeDriver reports whatever status the test sets and records what the
+// manager asks of it.
+type fakeDriver struct {
+	status   Status
+	uploaded []string
+	started  []string
+	cancels  int
+	polls    atomic.Int32
+}
+
+func (d *fakeDriver) Upload(ctx context.Context, name string, r io.Reader) error {
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return err
+	}
+	d.uploaded = append(d.uploaded, name)
+	return nil
+}
+
+func (d *fakeDriver) Start(ctx context.Context, name string) error {
+	d.started = append(d.started, name)
+	d.status = Status{State: StatePrinting, FileName: name}
+	return nil
+}
+
+func (d *fakeDriver) Cancel(ctx context.Context) error {
+	d.cancels++
+	return nil
+}
+
+func (d *fakeDriver) Status(ctx context.Context) (*Status, error) {
+	d.polls.Add(1)
+	status := d.status
+	return &status, nil
+}
+
+type managerTest struct {
+	*Manager
+	t      *testing.T
+	leader *fakeLeader
+	driver *fakeDriver
+	hash   string
+}
+
+// newManagerTest sets up a leader with one connected printer, driven by a
+// fake driver, and an uploaded file its jobs print.
+func newManagerTest(t *testing.T) *managerTest {
+	f := fsm.NewFSM()
+	f.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	leader := &fakeLeader{fsm: f}
+
+	blobs, err := blob.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, size, err := blobs.Put(strings.NewReader("G28\nG1 X10 E1\n"), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn := models.PrinterConnection{Driver: models.DriverSimulated}
+	leader.apply(t, fsm.OpCreate, fsm.EntityPrinter, models.Printer{ID: "p1", Company: "Prusa", Model: "MK4", Connection: &conn})
+	leader.apply(t, fsm.OpCreate, fsm.EntityFilament, models.Filament{
+		ID: "f1", Type: "PLA", Color: "black", TotalWeightInGrams: 1000, RemainingWeightInGrams: 1000,
+	})
+	leader.apply(t, fsm.OpLoad, fsm.EntitySpool, models.SpoolLoad{PrinterID: "p1", FilamentID: "f1"})
+	leader.apply(t, fsm.OpCreate, fsm.EntityFile, models.FileManifest{
+		Hash: hash, Name: "bracket.gcode", Size: size, Sources: []string{"http://node1"},
+		Owners: []models.FileOwner{{TenantID: models.DefaultTenant, Name: "bracket.gcode"}},
+	})
+
+	mt := &managerTest{t: t, leader: leader, driver: &fakeDriver{status: Status{State: StateIdle}}, hash: hash}
+	mt.Manager = mt.newManager(blobs)
+	return mt
+}
+
+// newManager returns a manager driving the test's printer, as a newly
+// elected leader would start one.
+func (mt *managerTest) newManager(blobs *blob.Store) *Manager {
+	m := NewManager(nil, mt.leader.fsm, blobs, nil, nil)
+	m.raftServer = mt.leader
+	m.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	p, _ := mt.leader.fsm.Store().GetPrinter(models.DefaultTenant, "p1")
+	m.drivers[printerKey(models.DefaultTenant, "p1")] = &driverEntry{conn: *p.Connection, driver: mt.driver}
+	return m
+}
+
+// pass runs a pass over the printers and waits for it.
+func (mt *managerTest) pass() {
+	<-mt.reconcile()
+}
+
+func (mt *managerTest) queue(id string) *models.PrintJob {
+	mt.t.Helper()
+	job := models.PrintJob{ID: id, PrinterID: "p1", FilamentID: "f1", FileHash: mt.hash, PrintWeightInGrams: 10}
+	mt.leader.apply(mt.t, fsm.OpCreate, fsm.EntityPrintJob, job)
+	return &job
+}
+
+func (mt *managerTest) status(id string) string {
+	mt.t.Helper()
+	job, found := mt.fsm.Store().GetPrintJob(models.DefaultTenant, id)
+	if !found {
+		mt.t.Fatalf("print job %s not found", id)
+	}
+	return job.Status
+}
+
+// clearBed reports the bed of the test's printer clear.
+func (mt *managerTest) clearBed() {
+	mt.t.Helper()
+	mt.leader.apply(mt.t, fsm.OpClearBed, fsm.EntityPrinter, fsm.EntityRef{ID: "p1"})
+}
+
+func TestManagerStartsAndFinishesJobs(t *testing.T) {
+	mt := newManagerTest(t)
+	job := mt.queue("job1")
+	remote := RemoteFileName(job)
+
+	mt.pass()
+	if got := mt.status("job1"); got != models.StatusRunning {
+		t.Fatalf("job is %s after starting it, want Running", got)
+	}
+	if len(mt.driver.uploaded) != 1 || mt.driver.uploaded[0] != remote || len(mt.driver.started) != 1 || mt.driver.started[0] != remote {
+		t.Fatalf("uploaded %v and started %v, want %s", mt.driver.uploaded, mt.driver.started, remote)
+	}
+
+	mt.driver.status = Status{State: StatePrinting, FileName: remote, Progress: 0.5}
+	mt.pass()
+	if got := mt.status("job1"); got != models.StatusRunning {
+		t.Fatalf("job is %s while printing, want Running", got)
+	}
+
+	mt.driver.status = Status{State: StateComplete, FileName: remote, Progress: 1}
+	mt.pass()
+	if got := mt.status("job1"); got != models.StatusDone {
+		t.Errorf("job is %s after the print completed, want Done", got)
+	}
+}
+
+func TestManagerCancelsJobsAbortedOnThePrinter(t *testing.T) {
+	mt := newManagerTest(t)
+	job := mt.queue("job1")
+	mt.queue("job2")
+	// Start the print long enough ago for an idle printer to mean it was
+	// aborted
+	mt.leader.clock = time.Now().Add(-2 * startGrace)
+	mt.pass()
+	mt.leader.clock = time.Time{}
+
+	// A printer winding down a cancelled print is busy: the job is not
+	// over yet and the next one must wait
+	mt.driver.status = Status{State: StateCancelling, FileName: RemoteFileName(job)}
+	mt.pass()
+	if got := mt.status("job1"); got != models.StatusRunning {
+		t.Fatalf("job is %s while the printer is cancelling, want Running", got)
+	}
+	if len(mt.driver.started) != 1 {
+		t.Fatalf("started %d prints on a cancelling printer", len(mt.driver.started))
+	}
+
+	mt.driver.status = Status{State: StateCancelled, FileName: RemoteFileName(job)}
+	mt.pass()
+	if got := mt.status("job1"); got != models.StatusCancelled {
+		t.Errorf("job is %s after the printer cancelled it, want Cancelled", got)
+	}
+}
+
+func TestManagerCancelsPrintsOfCancelledJobs(t *testing.T) {
+	mt := newManagerTest(t)
+	job := mt.queue("job1")
+	mt.pass()
+
+	data, _ := json.Marshal(fsm.PrintJobStatusChange{ID: "job1", Status: models.StatusCancelled})
+	if _, err := mt.leader.ApplyCommand(&fsm.Command{Op: fsm.OpUpdate, EntityType: fsm.EntityPrintJob, Payload: data}, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	mt.driver.status = Status{State: StatePrinting, FileName: RemoteFileName(job)}
+	mt.pass()
+	if mt.driver.cancels != 1 {
+		t.Errorf("cancelled the print %d times, want once", mt.driver.cancels)
+	}
+}
+
+func TestManagerWaitsForTheBedToBeCleared(t *testing.T) {
+	mt := newManagerTest(t)
+	job := mt.queue("job1")
+	mt.queue("job2")
+	mt.pass()
+
+	mt.driver.status = Status{State: StateComplete, FileName: RemoteFileName(job), Progress: 1}
+	mt.pass()
+	mt.pass()
+	if got := mt.status("job2"); got != models.StatusQueued || len(mt.driver.started) != 1 {
+		t.Fatalf("job2 is %s after the first print completed, want it to wait for the bed to be cleared", got)
+	}
+
+	mt.clearBed()
+	mt.pass()
+	if got := mt.status("job2"); got != models.StatusRunning {
+		t.Errorf("job2 is %s after the bed was cleared, want Running", got)
+	}
+}
+
+func TestNewLeaderKeepsJustStartedPrints(t *testing.T) {
+	mt := newManagerTest(t)
+	mt.queue("job1")
+	mt.pass()
+
+	// Leadership moves before the printer reports the print
+	mt.driver.status = Status{State: StateIdle}
+	mt.Manager = mt.newManager(mt.blobs)
+	mt.pass()
+	if got := mt.status("job1"); got != models.StatusRunning {
+		t.Errorf("new leader marked a print it did not start %s, want Running", got)
+	}
+}
+
+// slowDriver is a fakeDriver whose uploads wait for release to be closed.
+type slowDriver struct {
+	*fakeDriver
+	release chan struct{}
+}
+
+func (d *slowDriver) Upload(ctx context.Context, name string, r io.Reader) error {
+	<-d.release
+	return d.fakeDriver.Upload(ctx, name, r)
+}
+
+func TestSlowPrintersDoNotHoldUpOthers(t *testing.T) {
+	mt := newManagerTest(t)
+	mt.queue("job1")
+	slow := &slowDriver{fakeDriver: mt.driver, release: make(chan struct{})}
+	mt.drivers[printerKey(models.DefaultTenant, "p1")].driver = slow
+
+	conn := models.PrinterConnection{Driver: models.DriverSimulated}
+	mt.leader.apply(t, fsm.OpCreate, fsm.EntityPrinter, models.Printer{ID: "p2", Company: "Prusa", Model: "MK4", Connection: &conn})
+	other := &fakeDriver{status: Status{State: StatePrinting}}
+	mt.drivers[printerKey(models.DefaultTenant, "p2")] = &driverEntry{conn: conn, driver: other}
+
+	uploading := mt.reconcile()
+	deadline := time.After(5 * time.Second)
+	for other.polls.Load() < 3 {
+		select {
+		case <-mt.reconcile():
+		case <-deadline:
+			t.Fatal("polling p2 waits for the upload to p1")
+		}
+	}
+	if polls := mt.driver.polls.Load(); polls != 1 {
+		t.Errorf("p1 was polled %d times while uploading, want once", polls)
+	}
+
+	close(slow.release)
+	<-uploading
+	if got := mt.status("job1"); got != models.StatusRunning {
+		t.Errorf("job is %s after the upload finished, want Running", got)
+	}
+}
@@ -0,0 +1,87 @@
+package printer
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// Moonraker drives a Klipper printer through the Moonraker API.
+type Moonraker struct {
+	api apiClient
+}
+
+func NewMoonraker(baseURL, apiKey string, client *http.Client) *Moonraker {
+	return &Moonraker{api: apiClient{baseURL: baseURL, apiKey: apiKey, client: client}}
+}
+
+func (m *Moonraker) Upload(ctx context.Context, name string, r io.Reader) error {
+	return m.api.upload(ctx, "/server/files/upload", name, r, map[string]string{"root": "gcodes"})
+}
+
+func (m *Moonraker) Start(ctx context.Context, name string) error {
+	return m.api.doJSON(ctx, http.MethodPost, "/printer/print/start?filename="+url.QueryEscape(name), nil, nil)
+}
+
+func (m *Moonraker) Cancel(ctx context.Context) error {
+	return m.api.doJSON(ctx, http.MethodPost, "/printer/print/cancel", nil, nil)
+}
+
+type moonrakerQuery struct {
+	Result struct {
+		Status struct {
+			PrintStats struct {
+				State    string `json:"state"`
+				Filename string `json:"filename"`
+				Message  string `json:"message"`
+			} `json:"print_stats"`
+			VirtualSDCard struct {
+				Progress float64 `json:"progress"`
+			} `json:"virtual_sdcard"`
+			Extruder struct {
+				Temperature float64 `json:"temperature"`
+			} `json:"extruder"`
+			HeaterBed struct {
+				Temperature float64 `json:"temperature"`
+			} `json:"heater_bed"`
+		} `json:"status"`
+	} `json:"result"`
+}
+
+func (m *Moonraker) Status(ctx context.Context) (*Status, error) {
+	var query moonrakerQuery
+	path := "/printer/objects/query?print_stats&virtual_sdcard&extruder&heater_bed"
+	if err := m.api.doJSON(ctx, http.MethodGet, path, nil, &query); err != nil {
+		return nil, err
+	}
+
+	s := query.Result.Status
+	return &Status{
+		State:       moonrakerState(s.PrintStats.State),
+		FileName:    s.PrintStats.Filename,
+		Progress:    s.VirtualSDCard.Progress,
+		NozzleTempC: s.Extruder.Temperature,
+		BedTempC:    s.HeaterBed.Temperature,
+		Message:     s.PrintStats.Message,
+	}, nil
+}
+
+func moonrakerState(state string) State {
+	switch state {
+	case "printing":
+		return StatePrinting
+	case "paused":
+		return StatePaused
+	case "complete":
+		return StateComplete
+	case "cancelled":
+		return StateCancelled
+	case "error":
+		return StateError
+	case "standby":
+		return StateIdle
+	default:
+		return StateOffline
+	}
+}
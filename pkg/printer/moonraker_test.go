@@ -0,0 +1,135 @@
+package printer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeMoonraker serves the parts of the Moonraker API the driver uses and
+// records the requests it gets.
+type fakeMoonraker struct {
+	t        *testing.T
+	state    string
+	upload   string
+	commands []string
+	// fail makes every request fail with this status.
+	fail int
+}
+
+func (m *fakeMoonraker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if m.fail != 0 {
+		http.Error(w, `{"error": {"message": "Klipper not ready"}}`, m.fail)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/server/files/upload":
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(file)
+		m.upload = r.FormValue("root") + "/" + header.Filename + ":" + string(data)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"result": {"action": "create_file"}}`))
+
+	case r.Method == http.MethodPost && r.URL.Path == "/printer/print/start":
+		m.commands = append(m.commands, "start "+r.URL.Query().Get("filename"))
+		w.Write([]byte(`{"result": "ok"}`))
+
+	case r.Method == http.MethodPost && r.URL.Path == "/printer/print/cancel":
+		m.commands = append(m.commands, "cancel")
+		w.Write([]byte(`{"result": "ok"}`))
+
+	case r.Method == http.MethodGet && r.URL.Path == "/printer/objects/query":
+		for _, object := range []string{"print_stats", "virtual_sdcard", "extruder", "heater_bed"} {
+			if !r.URL.Query().Has(object) {
+				m.t.Errorf("status query does not ask for %s", object)
+			}
+		}
+		w.Write([]byte(`{"result": {"status": {
+			"print_stats": {"state": "` + m.state + `", "filename": "raft3d-1.gcode", "message": ""},
+			"virtual_sdcard": {"progress": 0.25},
+			"extruder": {"temperature": 209.5},
+			"heater_bed": {"temperature": 55.0}
+		}}}`))
+
+	default:
+		m.t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		http.NotFound(w, r)
+	}
+}
+
+func newFakeMoonraker(t *testing.T) (*fakeMoonraker, *Moonraker) {
+	fake := &fakeMoonraker{t: t, state: "standby"}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, NewMoonraker(server.URL, "", server.Client())
+}
+
+func TestMoonrakerDrivesPrints(t *testing.T) {
+	fake, driver := newFakeMoonraker(t)
+	ctx := context.Background()
+
+	if err := driver.Upload(ctx, "raft3d-1.gcode", strings.NewReader("G28\n")); err != nil {
+		t.Fatalf("Upload() = %v", err)
+	}
+	if fake.upload != "gcodes/raft3d-1.gcode:G28\n" {
+		t.Errorf("printer received %q", fake.upload)
+	}
+	if err := driver.Start(ctx, "raft3d-1.gcode"); err != nil {
+		t.Fatalf("Start() = %v", err)
+	}
+	if err := driver.Cancel(ctx); err != nil {
+		t.Fatalf("Cancel() = %v", err)
+	}
+	if want := []string{"start raft3d-1.gcode", "cancel"}; strings.Join(fake.commands, ",") != strings.Join(want, ",") {
+		t.Errorf("printer received commands %q, want %q", fake.commands, want)
+	}
+
+	fake.state = "printing"
+	status, err := driver.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status() = %v", err)
+	}
+	if status.State != StatePrinting || status.FileName != "raft3d-1.gcode" || status.Progress != 0.25 ||
+		status.NozzleTempC != 209.5 || status.BedTempC != 55.0 {
+		t.Errorf("Status() = %+v", status)
+	}
+}
+
+func TestMoonrakerErrors(t *testing.T) {
+	fake, driver := newFakeMoonraker(t)
+	fake.fail = http.StatusServiceUnavailable
+
+	var se *statusError
+	if err := driver.Start(context.Background(), "raft3d-1.gcode"); !errors.As(err, &se) || se.code != http.StatusServiceUnavailable {
+		t.Errorf("Start() on a printer that is not ready = %v", err)
+	}
+	if _, err := driver.Status(context.Background()); err == nil {
+		t.Error("Status() of a printer that is not ready succeeded")
+	}
+}
+
+func TestMoonrakerStates(t *testing.T) {
+	tests := map[string]State{
+		"standby":   StateIdle,
+		"printing":  StatePrinting,
+		"paused":    StatePaused,
+		"complete":  StateComplete,
+		"cancelled": StateCancelled,
+		"error":     StateError,
+		"":          StateOffline,
+	}
+	for state, want := range tests {
+		if got := moonrakerState(state); got != want {
+			t.Errorf("moonrakerState(%q) = %s, want %s", state, got, want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package printer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// OctoPrint drives a printer through the OctoPrint REST API.
+type OctoPrint struct {
+	api apiClient
+}
+
+func NewOctoPrint(baseURL, apiKey string, client *http.Client) *OctoPrint {
+	return &OctoPrint{api: apiClient{baseURL: baseURL, apiKey: apiKey, client: client}}
+}
+
+func (o *OctoPrint) Upload(ctx context.Context, name string, r io.Reader) error {
+	return o.api.upload(ctx, "/api/files/local", name, r, nil)
+}
+
+func (o *OctoPrint) Start(ctx context.Context, name string) error {
+	command := map[string]interface{}{"command": "select", "print": true}
+	return o.api.doJSON(ctx, http.MethodPost, "/api/files/local/"+url.PathEscape(name), command, nil)
+}
+
+func (o *OctoPrint) Cancel(ctx context.Context) error {
+	return o.api.doJSON(ctx, http.MethodPost, "/api/job", map[string]string{"command": "cancel"}, nil)
+}
+
+type octoPrintJob struct {
+	State string `json:"state"`
+	Job   struct {
+		File struct {
+			Name string `json:"name"`
+		} `json:"file"`
+	} `json:"job"`
+	Progress struct {
+		Completion *float64 `json:"completion"`
+	} `json:"progress"`
+	Error string `json:"error"`
+}
+
+type octoPrintPrinter struct {
+	Temperature map[string]struct {
+		Actual float64 `json:"actual"`
+	} `json:"temperature"`
+}
+
+func (o *OctoPrint) Status(ctx context.Context) (*Status, error) {
+	var job octoPrintJob
+	if err := o.api.doJSON(ctx, http.MethodGet, "/api/job", nil, &job); err != nil {
+		return nil, err
+	}
+
+	status := &Status{
+		State:    octoPrintState(job.State),
+		FileName: job.Job.File.Name,
+		Message:  job.Error,
+	}
+	if job.Progress.Completion != nil {
+		status.Progress = *job.Progress.Completion / 100
+	}
+
+	// /api/printer answers 409 while the printer is not connected.
+	var printer octoPrintPrinter
+	err := o.api.doJSON(ctx, http.MethodGet, "/api/printer?exclude=sd,state", nil, &printer)
+	var se *statusError
+	if err != nil && !(errors.As(err, &se) && se.code == http.StatusConflict) {
+		return nil, err
+	}
+	status.NozzleTempC = printer.Temperature["tool0"].Actual
+	status.BedTempC = printer.Temperature["bed"].Actual
+
+	return status, nil
+}
+
+// octoPrintState maps OctoPrint's human readable state strings.
+func octoPrintState(state string) State {
+	switch {
+	case strings.HasPrefix(state, "Printing"), strings.HasPrefix(state, "Starting"),
+		strings.HasPrefix(state, "Resuming"), strings.HasPrefix(state, "Finishing"):
+		return StatePrinting
+	case strings.HasPrefix(state, "Paus"):
+		return StatePaused
+	case strings.HasPrefix(state, "Cancelling"):
+		return StateCancelling
+	case strings.HasPrefix(state, "Operational"):
+		return StateIdle
+	case strings.HasPrefix(state, "Error"), strings.HasPrefix(state, "Offline after error"):
+		return StateError
+	default:
+		return StateOffline
+	}
+}
@@ -0,0 +1,174 @@
+package printer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeOctoPrint serves the parts of the OctoPrint API the driver uses and
+// records the requests it gets.
+type fakeOctoPrint struct {
+	t        *testing.T
+	state    string
+	upload   string
+	commands []string
+	// printerStatus is the status of /api/printer, which OctoPrint answers
+	// with 409 while no printer is connected.
+	printerStatus int
+	// fail makes every request but status queries fail with this status.
+	fail int
+}
+
+func (o *fakeOctoPrint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Api-Key") != "secret" {
+		http.Error(w, "invalid API key", http.StatusForbidden)
+		return
+	}
+	if o.fail != 0 && r.Method != http.MethodGet {
+		http.Error(w, "printer is not operational", o.fail)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/files/local":
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(file)
+		o.upload = header.Filename + ":" + string(data)
+		w.WriteHeader(http.StatusCreated)
+
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/api/files/local/"):
+		var command struct {
+			Command string `json:"command"`
+			Print   bool   `json:"print"`
+		}
+		json.NewDecoder(r.Body).Decode(&command)
+		if command.Command == "select" && command.Print {
+			o.commands = append(o.commands, "print "+strings.TrimPrefix(r.URL.Path, "/api/files/local/"))
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodPost && r.URL.Path == "/api/job":
+		var command struct {
+			Command string `json:"command"`
+		}
+		json.NewDecoder(r.Body).Decode(&command)
+		o.commands = append(o.commands, command.Command)
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodGet && r.URL.Path == "/api/job":
+		w.Write([]byte(`{"state": "` + o.state + `", "job": {"file": {"name": "raft3d-1.gcode"}}, "progress": {"completion": 42.5}}`))
+
+	case r.Method == http.MethodGet && r.URL.Path == "/api/printer":
+		if o.printerStatus != 0 {
+			http.Error(w, "Printer is not operational", o.printerStatus)
+			return
+		}
+		w.Write([]byte(`{"temperature": {"tool0": {"actual": 214.8}, "bed": {"actual": 60.1}}}`))
+
+	default:
+		o.t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		http.NotFound(w, r)
+	}
+}
+
+func newFakeOctoPrint(t *testing.T) (*fakeOctoPrint, *OctoPrint) {
+	fake := &fakeOctoPrint{t: t, state: "Operational"}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, NewOctoPrint(server.URL, "secret", server.Client())
+}
+
+func TestOctoPrintDrivesPrints(t *testing.T) {
+	fake, driver := newFakeOctoPrint(t)
+	ctx := context.Background()
+
+	if err := driver.Upload(ctx, "raft3d-1.gcode", strings.NewReader("G28\n")); err != nil {
+		t.Fatalf("Upload() = %v", err)
+	}
+	if fake.upload != "raft3d-1.gcode:G28\n" {
+		t.Errorf("printer received %q", fake.upload)
+	}
+	if err := driver.Start(ctx, "raft3d-1.gcode"); err != nil {
+		t.Fatalf("Start() = %v", err)
+	}
+	if err := driver.Cancel(ctx); err != nil {
+		t.Fatalf("Cancel() = %v", err)
+	}
+	if want := []string{"print raft3d-1.gcode", "cancel"}; strings.Join(fake.commands, ",") != strings.Join(want, ",") {
+		t.Errorf("printer received commands %q, want %q", fake.commands, want)
+	}
+
+	fake.state = "Printing from SD"
+	status, err := driver.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status() = %v", err)
+	}
+	if status.State != StatePrinting || status.FileName != "raft3d-1.gcode" || status.Progress != 0.425 ||
+		status.NozzleTempC != 214.8 || status.BedTempC != 60.1 {
+		t.Errorf("Status() = %+v", status)
+	}
+}
+
+func TestOctoPrintErrors(t *testing.T) {
+	fake, driver := newFakeOctoPrint(t)
+	ctx := context.Background()
+
+	// A disconnected printer still reports the job state
+	fake.printerStatus = http.StatusConflict
+	status, err := driver.Status(ctx)
+	if err != nil || status.State != StateIdle {
+		t.Errorf("Status() of a disconnected printer = %+v, %v", status, err)
+	}
+
+	fake.printerStatus = http.StatusInternalServerError
+	if _, err := driver.Status(ctx); err == nil {
+		t.Error("Status() ignored a failing printer query")
+	}
+
+	fake.fail = http.StatusConflict
+	err = driver.Start(ctx, "raft3d-1.gcode")
+	var se *statusError
+	if !errors.As(err, &se) || se.code != http.StatusConflict || !strings.Contains(se.msg, "not operational") {
+		t.Errorf("Start() on a busy printer = %v", err)
+	}
+
+	if err := NewOctoPrint(driver.api.baseURL, "wrong", driver.api.client).Cancel(ctx); err == nil {
+		t.Error("Cancel() with a wrong API key succeeded")
+	}
+}
+
+func TestOctoPrintStates(t *testing.T) {
+	tests := map[string]State{
+		"Operational":                      StateIdle,
+		"Printing":                         StatePrinting,
+		"Printing from SD":                 StatePrinting,
+		"Starting print from SD":           StatePrinting,
+		"Finishing":                        StatePrinting,
+		"Pausing":                          StatePaused,
+		"Paused":                           StatePaused,
+		"Resuming":                         StatePrinting,
+		"Cancelling":                       StateCancelling,
+		"Error: Thermal runaway":           StateError,
+		"Offline after error":              StateError,
+		"Offline":                          StateOffline,
+		"Opening serial connection":        StateOffline,
+		"Detecting serial connection":      StateOffline,
+		"Connecting":                       StateOffline,
+		"Unknown state reported by a fork": StateOffline,
+	}
+	for state, want := range tests {
+		if got := octoPrintState(state); got != want {
+			t.Errorf("octoPrintState(%q) = %s, want %s", state, got, want)
+		}
+	}
+}
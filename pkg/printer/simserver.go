@@ -0,0 +1,77 @@
+package printer
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// NewMoonrakerServer serves the subset of the Moonraker API used by the
+// Moonraker driver, backed by a simulator, so the real connector can be
+// exercised end to end without hardware.
+func NewMoonrakerServer(sim *Simulator) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/server/files/upload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		if err := sim.Upload(r.Context(), header.Filename, file); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeResult(w, map[string]interface{}{"item": map[string]string{"path": header.Filename, "root": "gcodes"}})
+	})
+
+	mux.HandleFunc("/printer/print/start", func(w http.ResponseWriter, r *http.Request) {
+		if err := sim.Start(r.Context(), r.URL.Query().Get("filename")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeResult(w, "ok")
+	})
+
+	mux.HandleFunc("/printer/print/cancel", func(w http.ResponseWriter, r *http.Request) {
+		if err := sim.Cancel(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeResult(w, "ok")
+	})
+
+	mux.HandleFunc("/printer/objects/query", func(w http.ResponseWriter, r *http.Request) {
+		status, _ := sim.Status(r.Context())
+
+		state := string(status.State)
+		if status.State == StateIdle {
+			state = "standby"
+		}
+
+		writeResult(w, map[string]interface{}{
+			"status": map[string]interface{}{
+				"print_stats": map[string]string{
+					"state":    state,
+					"filename": status.FileName,
+					"message":  status.Message,
+				},
+				"virtual_sdcard": map[string]float64{"progress": status.Progress},
+				"extruder":       map[string]float64{"temperature": status.NozzleTempC},
+				"heater_bed":     map[string]float64{"temperature": status.BedTempC},
+			},
+		})
+	})
+
+	return mux
+}
+
+func writeResult(w http.ResponseWriter, result interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"result": result})
+}
@@ -0,0 +1,223 @@
+package printer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/raft3d/pkg/gcode"
+)
+
+const (
+	ambientTempC = 22.0
+	// defaultSimulatedDuration is used for files without a usable estimate.
+	defaultSimulatedDuration = 10 * time.Minute
+)
+
+// SimulatorOptions tune a Simulator.
+type SimulatorOptions struct {
+	// Speed multiplies the pace of prints; 60 prints an hour long job in a
+	// minute.
+	Speed float64
+	// FailureRate is the probability that a print fails part way through.
+	FailureRate float64
+	// Seed makes failure injection reproducible when non-zero.
+	Seed int64
+	// NozzleTempC and BedTempC are the temperatures held while printing.
+	NozzleTempC float64
+	BedTempC    float64
+}
+
+// ParseSimulatorOptions reads options from a printer connection, using
+// defaults for anything left out.
+func ParseSimulatorOptions(options map[string]string) (SimulatorOptions, error) {
+	opts := SimulatorOptions{Speed: 1, NozzleTempC: 210, BedTempC: 60}
+
+	floats := map[string]*float64{
+		"speed":         &opts.Speed,
+		"failure_rate":  &opts.FailureRate,
+		"nozzle_temp_c": &opts.NozzleTempC,
+		"bed_temp_c":    &opts.BedTempC,
+	}
+	for name, target := range floats {
+		if v, ok := options[name]; ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return opts, fmt.Errorf("invalid simulator option %s: %v", name, err)
+			}
+			*target = f
+		}
+	}
+	if v, ok := options["seed"]; ok {
+		seed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return opts, fmt.Errorf("invalid simulator option seed: %v", err)
+		}
+		opts.Seed = seed
+	}
+
+	if opts.Speed <= 0 {
+		return opts, fmt.Errorf("simulator speed must be positive")
+	}
+	if opts.FailureRate < 0 || opts.FailureRate > 1 {
+		return opts, fmt.Errorf("simulator failure rate must be between 0 and 1")
+	}
+	return opts, nil
+}
+
+// Simulator is a virtual printer. It accepts uploads, prints them for as long
+// as their G-code estimate says (scaled by Speed), heats up and cools down,
+// and fails a configurable share of prints.
+type Simulator struct {
+	opts SimulatorOptions
+
+	mu        sync.Mutex
+	rng       *rand.Rand
+	files     map[string]time.Duration
+	state     State
+	fileName  string
+	message   string
+	startedAt time.Time
+	endedAt   time.Time
+	duration  time.Duration
+	progress  float64
+	// failAt is the progress at which the current print fails, or zero.
+	failAt float64
+}
+
+func NewSimulator(opts SimulatorOptions) *Simulator {
+	seed := opts.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Simulator{
+		opts:  opts,
+		rng:   rand.New(rand.NewSource(seed)),
+		files: make(map[string]time.Duration),
+		state: StateIdle,
+	}
+}
+
+func (s *Simulator) Upload(ctx context.Context, name string, r io.Reader) error {
+	duration := defaultSimulatedDuration
+	if analysis, err := gcode.Analyze(r); err == nil && analysis.EstimatedSeconds > 0 {
+		duration = time.Duration(analysis.EstimatedSeconds * float64(time.Second))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[name] = duration
+	return nil
+}
+
+func (s *Simulator) Start(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.advance()
+	if s.state == StatePrinting || s.state == StatePaused {
+		return fmt.Errorf("printer is busy printing %s", s.fileName)
+	}
+
+	duration, ok := s.files[name]
+	if !ok {
+		return fmt.Errorf("file not found: %s", name)
+	}
+
+	s.state = StatePrinting
+	s.fileName = name
+	s.message = ""
+	s.startedAt = time.Now()
+	s.endedAt = time.Time{}
+	s.duration = time.Duration(float64(duration) / s.opts.Speed)
+	s.progress = 0
+	s.failAt = 0
+	if s.rng.Float64() < s.opts.FailureRate {
+		s.failAt = 0.05 + 0.9*s.rng.Float64()
+	}
+	return nil
+}
+
+func (s *Simulator) Cancel(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.advance()
+	if s.state != StatePrinting && s.state != StatePaused {
+		return fmt.Errorf("printer is not printing")
+	}
+	s.finish(StateCancelled, "cancelled by user")
+	return nil
+}
+
+func (s *Simulator) Status(ctx context.Context) (*Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.advance()
+	nozzle, bed := s.temperatures()
+	return &Status{
+		State:       s.state,
+		FileName:    s.fileName,
+		Progress:    s.progress,
+		NozzleTempC: nozzle,
+		BedTempC:    bed,
+		Message:     s.message,
+	}, nil
+}
+
+// advance moves the current print forward to the present.
+func (s *Simulator) advance() {
+	if s.state != StatePrinting {
+		return
+	}
+
+	progress := 1.0
+	if s.duration > 0 {
+		progress = float64(time.Since(s.startedAt)) / float64(s.duration)
+	}
+
+	switch {
+	case s.failAt > 0 && progress >= s.failAt:
+		s.progress = s.failAt
+		s.finish(StateError, "simulated failure: thermal runaway")
+		s.endedAt = s.startedAt.Add(time.Duration(float64(s.duration) * s.failAt))
+	case progress >= 1:
+		s.progress = 1
+		s.finish(StateComplete, "")
+		s.endedAt = s.startedAt.Add(s.duration)
+	default:
+		s.progress = progress
+	}
+}
+
+func (s *Simulator) finish(state State, message string) {
+	s.state = state
+	s.message = message
+	s.endedAt = time.Now()
+}
+
+// temperatures heat towards the printing targets within a few seconds of
+// simulated time and cool back down to ambient afterwards.
+func (s *Simulator) temperatures() (float64, float64) {
+	approach := func(from, to float64, since time.Duration) float64 {
+		simulated := since.Seconds() * s.opts.Speed
+		fraction := 1 - 1/(1+simulated/30)
+		return from + (to-from)*fraction
+	}
+
+	switch {
+	case s.state == StatePrinting || s.state == StatePaused:
+		since := time.Since(s.startedAt)
+		return approach(ambientTempC, s.opts.NozzleTempC, since), approach(ambientTempC, s.opts.BedTempC, since)
+	case !s.endedAt.IsZero():
+		since := time.Since(s.endedAt)
+		return approach(s.opts.NozzleTempC, ambientTempC, since), approach(s.opts.BedTempC, ambientTempC, since)
+	default:
+		return ambientTempC, ambientTempC
+	}
+}
@@ -0,0 +1,72 @@
+package printer
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raft3d/pkg/models"
+)
+
+// simulate drives the test's printer through the Moonraker driver, talking to
+// a simulator behind the Moonraker compatible server.
+func (mt *managerTest) simulate(opts SimulatorOptions) {
+	server := httptest.NewServer(NewMoonrakerServer(NewSimulator(opts)))
+	mt.t.Cleanup(server.Close)
+	mt.drivers[printerKey(models.DefaultTenant, "p1")].driver = NewMoonraker(server.URL, "", server.Client())
+}
+
+// passUntil runs passes until the job has the given status.
+func (mt *managerTest) passUntil(id, status string) {
+	mt.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for mt.status(id) != status {
+		if time.Now().After(deadline) {
+			mt.t.Fatalf("job %s is %s, want %s", id, mt.status(id), status)
+		}
+		mt.pass()
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSimulatedPrintRunsToDone(t *testing.T) {
+	mt := newManagerTest(t)
+	mt.simulate(SimulatorOptions{Speed: 1e6, Seed: 1})
+	mt.queue("job1")
+	mt.queue("job2")
+
+	mt.passUntil("job1", models.StatusRunning)
+	mt.passUntil("job1", models.StatusDone)
+	if f, _ := mt.fsm.Store().GetFilament(models.DefaultTenant, "f1"); f.RemainingWeightInGrams != 990 {
+		t.Errorf("%d g of filament left after a 10 g print, want 990 g", f.RemainingWeightInGrams)
+	}
+
+	mt.clearBed()
+	mt.passUntil("job2", models.StatusDone)
+
+	status, found := mt.Telemetry(models.DefaultTenant, "p1")
+	if !found || status.State != StateComplete || status.Progress != 1 {
+		t.Errorf("telemetry = %+v, want a complete print", status)
+	}
+}
+
+func TestSimulatedFailureCancelsTheJob(t *testing.T) {
+	mt := newManagerTest(t)
+	mt.simulate(SimulatorOptions{Speed: 1e6, FailureRate: 1, Seed: 1})
+	mt.queue("job1")
+
+	// Past the start grace, a failed print ends the job at once
+	mt.leader.clock = time.Now().Add(-2 * startGrace)
+	mt.passUntil("job1", models.StatusRunning)
+	mt.leader.clock = time.Time{}
+
+	mt.passUntil("job1", models.StatusCancelled)
+	status, _ := mt.Telemetry(models.DefaultTenant, "p1")
+	if status.State != StateError || !strings.Contains(status.Message, "simulated failure") {
+		t.Errorf("telemetry = %+v, want a simulated failure", status)
+	}
+	if f, _ := mt.fsm.Store().GetFilament(models.DefaultTenant, "f1"); f.RemainingWeightInGrams != 1000 {
+		t.Errorf("a failed print used filament: %d g left", f.RemainingWeightInGrams)
+	}
+}
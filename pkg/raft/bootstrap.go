@@ -0,0 +1,245 @@
+package raft
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+	"github.com/raft3d/internal/fsm"
+)
+
+// clusterIDKey is where the cluster ID is kept in the stable store.
+var clusterIDKey = []byte("raft3d_cluster_id")
+
+// ClusterID returns the ID of the cluster this node belongs to, or "" while
+// it has not bootstrapped one or learned it from the log. The ID recorded in
+// the log wins; the copy in the stable store only serves until the log has
+// been replayed after a restart.
+func (s *Server) ClusterID() string {
+	logged := s.fsm.Store().ClusterID()
+
+	s.clusterMu.Lock()
+	defer s.clusterMu.Unlock()
+	if logged != "" && logged != s.clusterID {
+		if err := s.rememberClusterID(logged); err != nil {
+			s.logger.Warn("failed to store cluster ID", "err", err)
+		}
+	}
+	return s.clusterID
+}
+
+func (s *Server) loadClusterID() error {
+	id, err := s.stableStore.Get(clusterIDKey)
+	if err != nil && !errors.Is(err, raftboltdb.ErrKeyNotFound) {
+		return fmt.Errorf("failed to read cluster ID: %v", err)
+	}
+
+	s.clusterMu.Lock()
+	defer s.clusterMu.Unlock()
+	s.clusterID = string(id)
+	return nil
+}
+
+// rememberClusterID keeps id in the stable store. clusterMu must be held.
+func (s *Server) rememberClusterID(id string) error {
+	if err := s.stableStore.Set(clusterIDKey, []byte(id)); err != nil {
+		return fmt.Errorf("failed to store cluster ID: %v", err)
+	}
+	s.clusterID = id
+	return nil
+}
+
+func newClusterID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// runClusterID records the cluster ID in the log while this node leads a
+// cluster without one: the ID generated when this node bootstrapped it, or a
+// new one for clusters created before IDs existed. Nodes that predate IDs
+// cannot apply the record, so it waits while legacy peers are allowed.
+func (s *Server) runClusterID() {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.stopCh:
+			return
+		}
+
+		if s.config.AllowLegacyPeers || !s.IsLeader() || !s.Restored() || s.fsm.Store().ClusterID() != "" {
+			continue
+		}
+
+		id := s.ClusterID()
+		if id == "" {
+			var err error
+			if id, err = newClusterID(); err != nil {
+				s.logger.Error("failed to generate cluster ID", "err", err)
+				continue
+			}
+		}
+
+		payload, err := json.Marshal(fsm.ClusterInfo{ID: id})
+		if err != nil {
+			s.logger.Error("failed to marshal cluster ID", "err", err)
+			continue
+		}
+		cmd := fsm.Command{Op: fsm.OpCreate, EntityType: fsm.EntityCluster, Payload: payload}
+		if _, err := s.ApplyCommand(&cmd, 10*time.Second); err != nil {
+			s.logger.Warn("failed to record cluster ID", "err", err)
+			continue
+		}
+		s.logger.Info("recorded cluster ID", "cluster_id", s.ClusterID())
+	}
+}
+
+// bootstrapWhenReady bootstraps a new cluster of the configured nodes once a
+// quorum of them is reachable and none of them belongs to a cluster already.
+// Of the nodes started with -bootstrap, only the reachable one with the
+// lowest ID bootstraps, so that they do not found rival clusters; the others
+// wait for it and are members of the cluster it founds.
+func (s *Server) bootstrapWhenReady(configuration raft.Configuration) {
+	s.bootstrapping.Store(true)
+	defer s.bootstrapping.Store(false)
+
+	quorum := len(configuration.Servers)/2 + 1
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	waitingFor := ""
+	for {
+		found := s.probePeers(configuration)
+		if found.clusterID != "" {
+			// A candidate with a lower ID usually got there first; anything
+			// else means the node list points into an existing cluster
+			if found.member < s.config.NodeID {
+				s.logger.Info("not bootstrapping: another node bootstrapped the cluster", "peer", found.member, "cluster_id", found.clusterID)
+			} else {
+				s.logger.Error("not bootstrapping: a configured node already belongs to a cluster", "peer", found.member, "cluster_id", found.clusterID)
+			}
+			return
+		}
+
+		switch {
+		case found.reachable < quorum:
+			s.logger.Info("waiting for peers before bootstrapping", "reachable", found.reachable, "quorum", quorum)
+		case found.bootstrapper != s.config.NodeID:
+			if found.bootstrapper != waitingFor {
+				s.logger.Info("leaving bootstrap to the node with the lowest ID", "bootstrapper", found.bootstrapper)
+			}
+			waitingFor = found.bootstrapper
+		default:
+			s.bootstrap(configuration)
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+func (s *Server) bootstrap(configuration raft.Configuration) {
+	id, err := newClusterID()
+	if err != nil {
+		s.logger.Error("failed to generate cluster ID", "err", err)
+		return
+	}
+
+	s.clusterMu.Lock()
+	err = s.rememberClusterID(id)
+	s.clusterMu.Unlock()
+	if err != nil {
+		s.logger.Error("not bootstrapping", "err", err)
+		return
+	}
+
+	if err := s.raft.BootstrapCluster(configuration).Error(); err != nil {
+		if err == raft.ErrCantBootstrap {
+			s.logger.Warn("not bootstrapping: this node already has Raft state")
+			return
+		}
+		s.logger.Error("failed to bootstrap cluster", "err", err)
+		return
+	}
+	s.logger.Info("bootstrapped cluster", "cluster_id", id, "servers", len(configuration.Servers))
+}
+
+// bootstrapProbe is what probing the configured nodes found.
+type bootstrapProbe struct {
+	reachable int
+	// bootstrapper is the lowest ID among the reachable nodes waiting to
+	// bootstrap, this one included.
+	bootstrapper string
+	// member belongs to cluster clusterID already, which bootstrapping
+	// would fork.
+	member    string
+	clusterID string
+}
+
+// probePeers counts the configured nodes that answer, this one included, and
+// picks the one that bootstraps. It stops at the first node that belongs to
+// a cluster already.
+func (s *Server) probePeers(configuration raft.Configuration) bootstrapProbe {
+	found := bootstrapProbe{bootstrapper: s.config.NodeID}
+	for _, srv := range configuration.Servers {
+		if srv.ID == raft.ServerID(s.config.NodeID) {
+			found.reachable++
+			continue
+		}
+
+		reply, err := s.stream.probe(srv.Address, 2*time.Second)
+		if reply.clusterID != "" {
+			return bootstrapProbe{member: string(srv.ID), clusterID: reply.clusterID}
+		}
+		if err != nil {
+			s.logger.Debug("peer is not reachable", "peer", srv.ID, "err", err)
+			continue
+		}
+		found.reachable++
+		if reply.bootstrapping && string(srv.ID) < found.bootstrapper {
+			found.bootstrapper = string(srv.ID)
+		}
+	}
+	return found
+}
+
+// checkBootstrapConfiguration warns when a node with Raft state is started
+// with -bootstrap and a node list that differs from the configuration it
+// already has, which is ignored.
+func (s *Server) checkBootstrapConfiguration(configuration raft.Configuration) {
+	current, err := s.Servers()
+	if err != nil {
+		return
+	}
+
+	want := make(map[raft.ServerID]raft.ServerAddress)
+	for _, srv := range configuration.Servers {
+		want[srv.ID] = srv.Address
+	}
+	same := len(current) == len(want)
+	for _, srv := range current {
+		same = same && want[srv.ID] == srv.Address
+	}
+
+	if same {
+		s.logger.Info("not bootstrapping: this node already has Raft state")
+	} else {
+		s.logger.Warn("not bootstrapping: this node already has Raft state and its configuration differs from the node list; the node list is ignored",
+			"servers", len(current))
+	}
+}
@@ -0,0 +1,200 @@
+package raft
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// handshakeMagic opens every Raft connection, followed by the dialling
+// node's cluster ID. Its first byte is never the first byte of a Raft RPC,
+// which tells connections from nodes that predate the handshake apart.
+var handshakeMagic = []byte("R3D\x01")
+
+const (
+	handshakeAccepted byte = 0
+	handshakeRejected byte = 1
+
+	// handshakeBootstrapping flags a peer that waits to bootstrap a cluster.
+	handshakeBootstrapping byte = 1 << 0
+
+	handshakeTimeout = 10 * time.Second
+)
+
+// clusterStreamLayer exchanges cluster IDs at the start of every Raft
+// connection and refuses peers that belong to another cluster, so that a node
+// pointed at the wrong addresses cannot disrupt or join a foreign cluster. A
+// node without a cluster ID talks to anyone; it learns the ID from the log of
+// the cluster that adds it.
+type clusterStreamLayer struct {
+	raft.StreamLayer
+	server *Server
+}
+
+// handshakeReply is what the accepting node answers a handshake with.
+type handshakeReply struct {
+	clusterID     string
+	bootstrapping bool
+}
+
+func (l *clusterStreamLayer) Dial(address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	conn, err := l.StreamLayer.Dial(address, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = l.handshake(conn, timeout)
+	if err == nil {
+		return conn, nil
+	}
+	conn.Close()
+
+	if l.server.config.AllowLegacyPeers && hungUp(err) {
+		l.server.logger.Debug("peer hung up on the cluster handshake, connecting without it", "peer", address)
+		return l.StreamLayer.Dial(address, timeout)
+	}
+	return nil, fmt.Errorf("handshake with %s failed: %v", address, err)
+}
+
+// hungUp reports whether err is the peer closing the connection, which is how
+// nodes that predate the handshake answer it.
+func hungUp(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// handshake sends this node's cluster ID over a dialled connection and
+// returns the peer's reply.
+func (l *clusterStreamLayer) handshake(conn net.Conn, timeout time.Duration) (handshakeReply, error) {
+	conn.SetDeadline(time.Now().Add(timeout))
+	defer conn.SetDeadline(time.Time{})
+
+	local := l.server.ClusterID()
+	if _, err := conn.Write(append(append([]byte{}, handshakeMagic...), encodeClusterID(local)...)); err != nil {
+		return handshakeReply{}, err
+	}
+
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return handshakeReply{}, err
+	}
+	peer, err := readClusterID(conn)
+	if err != nil {
+		return handshakeReply{}, err
+	}
+	reply := handshakeReply{clusterID: peer, bootstrapping: header[1]&handshakeBootstrapping != 0}
+
+	if header[0] != handshakeAccepted {
+		return reply, fmt.Errorf("peer belongs to cluster %s, not %s", peer, local)
+	}
+	return reply, nil
+}
+
+// probe connects to a peer only to learn its cluster ID and whether it waits
+// to bootstrap. The reply is returned even when the peer refuses this node.
+func (l *clusterStreamLayer) probe(address raft.ServerAddress, timeout time.Duration) (handshakeReply, error) {
+	conn, err := l.StreamLayer.Dial(address, timeout)
+	if err != nil {
+		return handshakeReply{}, err
+	}
+	defer conn.Close()
+	return l.handshake(conn, timeout)
+}
+
+func (l *clusterStreamLayer) Accept() (net.Conn, error) {
+	conn, err := l.StreamLayer.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &handshakeConn{Conn: conn, server: l.server}, nil
+}
+
+// handshakeConn answers the handshake of an accepted connection before the
+// first read, so that a slow peer does not hold up the accept loop.
+type handshakeConn struct {
+	net.Conn
+	server *Server
+
+	once sync.Once
+	err  error
+	// legacy holds the first byte of a connection without a handshake,
+	// which belongs to the Raft RPC that follows.
+	legacy []byte
+}
+
+func (c *handshakeConn) Read(p []byte) (int, error) {
+	c.once.Do(func() { c.err = c.handshake() })
+	if c.err != nil {
+		return 0, c.err
+	}
+	if len(c.legacy) > 0 {
+		n := copy(p, c.legacy)
+		c.legacy = c.legacy[n:]
+		return n, nil
+	}
+	return c.Conn.Read(p)
+}
+
+func (c *handshakeConn) handshake() error {
+	c.Conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer c.Conn.SetDeadline(time.Time{})
+
+	magic := make([]byte, len(handshakeMagic))
+	if _, err := io.ReadFull(c.Conn, magic[:1]); err != nil {
+		return err
+	}
+	if magic[0] != handshakeMagic[0] && c.server.config.AllowLegacyPeers {
+		c.server.logger.Debug("accepted connection without a cluster handshake", "peer", c.RemoteAddr().String())
+		c.legacy = magic[:1]
+		return nil
+	}
+	if _, err := io.ReadFull(c.Conn, magic[1:]); err != nil {
+		return err
+	}
+	if string(magic) != string(handshakeMagic) {
+		return fmt.Errorf("connection from %s did not start with a cluster handshake", c.RemoteAddr())
+	}
+	peer, err := readClusterID(c.Conn)
+	if err != nil {
+		return err
+	}
+
+	local := c.server.ClusterID()
+	status := handshakeAccepted
+	if local != "" && peer != "" && local != peer {
+		status = handshakeRejected
+	}
+	var flags byte
+	if c.server.bootstrapping.Load() {
+		flags |= handshakeBootstrapping
+	}
+	if _, err := c.Conn.Write(append([]byte{status, flags}, encodeClusterID(local)...)); err != nil {
+		return err
+	}
+
+	if status != handshakeAccepted {
+		return fmt.Errorf("rejected connection from %s: it belongs to cluster %s, not %s", c.RemoteAddr(), peer, local)
+	}
+	return nil
+}
+
+func encodeClusterID(id string) []byte {
+	return append([]byte{byte(len(id))}, id...)
+}
+
+func readClusterID(r io.Reader) (string, error) {
+	length := make([]byte, 1)
+	if _, err := io.ReadFull(r, length); err != nil {
+		return "", err
+	}
+	id := make([]byte, length[0])
+	if _, err := io.ReadFull(r, id); err != nil {
+		return "", err
+	}
+	return string(id), nil
+}
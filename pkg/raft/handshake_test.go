@@ -0,0 +1,188 @@
+package raft
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/raft3d/internal/fsm"
+)
+
+// newTestLayer starts a node with the given cluster ID whose accepted
+// connections echo the first two bytes they read once the handshake is done. Failed
+// handshakes are sent to the returned channel.
+func newTestLayer(t *testing.T, nodeID, clusterID string, allowLegacy bool) (*clusterStreamLayer, <-chan error) {
+	t.Helper()
+	s, err := NewServer(&Config{
+		NodeID:           nodeID,
+		AllowLegacyPeers: allowLegacy,
+		Logger:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}, fsm.NewFSM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.clusterID = clusterID
+
+	stream, err := newTCPStreamLayer("127.0.0.1:0", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { stream.Close() })
+	layer := &clusterStreamLayer{StreamLayer: stream, server: s}
+
+	errs := make(chan error, 10)
+	go func() {
+		for {
+			conn, err := layer.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 2)
+				if _, err := io.ReadFull(conn, buf); err != nil {
+					errs <- err
+					return
+				}
+				conn.Write(buf)
+			}()
+		}
+	}()
+	return layer, errs
+}
+
+func addrOf(layer *clusterStreamLayer) raft.ServerAddress {
+	return raft.ServerAddress(layer.StreamLayer.(*tcpStreamLayer).Listener.Addr().String())
+}
+
+// roundTrip checks that a connection carries data once dialled.
+func roundTrip(t *testing.T, conn net.Conn) {
+	t.Helper()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte{0, 42}); err != nil {
+		t.Fatal(err)
+	}
+	echo := make([]byte, 2)
+	if _, err := io.ReadFull(conn, echo); err != nil || echo[0] != 0 || echo[1] != 42 {
+		t.Fatalf("echo = %v, %v", echo, err)
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	tests := []struct {
+		name           string
+		dialer, target string
+		accepted       bool
+	}{
+		{"same cluster", "c1", "c1", true},
+		{"other cluster", "c1", "c2", false},
+		{"dialer without cluster", "", "c1", true},
+		{"target without cluster", "c1", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dialer, _ := newTestLayer(t, "node1", tt.dialer, false)
+			target, errs := newTestLayer(t, "node2", tt.target, false)
+
+			conn, err := dialer.Dial(addrOf(target), time.Second)
+			if !tt.accepted {
+				if err == nil || !strings.Contains(err.Error(), "c2") {
+					t.Errorf("Dial() = %v, want a rejection naming the peer's cluster", err)
+				}
+				if err := <-errs; err == nil || !strings.Contains(err.Error(), "rejected") {
+					t.Errorf("target accepted the connection: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Dial() = %v", err)
+			}
+			defer conn.Close()
+			roundTrip(t, conn)
+
+			// Nodes learn the cluster ID from the log, never from a peer
+			if got := target.server.ClusterID(); got != tt.target {
+				t.Errorf("target cluster ID = %q after the handshake, want %q", got, tt.target)
+			}
+		})
+	}
+}
+
+func TestProbeReportsBootstrapping(t *testing.T) {
+	dialer, _ := newTestLayer(t, "node1", "", false)
+	target, _ := newTestLayer(t, "node2", "", false)
+	target.server.bootstrapping.Store(true)
+
+	reply, err := dialer.probe(addrOf(target), time.Second)
+	if err != nil || reply.clusterID != "" || !reply.bootstrapping {
+		t.Errorf("probe() = %+v, %v", reply, err)
+	}
+
+	member, _ := newTestLayer(t, "node3", "c1", false)
+	if reply, err := dialer.probe(addrOf(member), time.Second); err != nil || reply.clusterID != "c1" || reply.bootstrapping {
+		t.Errorf("probe() of a member = %+v, %v", reply, err)
+	}
+}
+
+func TestLegacyPeers(t *testing.T) {
+	// A node without the handshake sends the RPC type first
+	for _, allow := range []bool{false, true} {
+		target, errs := newTestLayer(t, "node2", "c1", allow)
+		conn, err := net.Dial("tcp", string(addrOf(target)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allow {
+			roundTrip(t, conn)
+		} else {
+			conn.Write([]byte{0, 42, 0, 0, 0, 0})
+			if err := <-errs; err == nil {
+				t.Error("accepted a connection without a handshake")
+			}
+		}
+		conn.Close()
+	}
+
+	// and hangs up on a handshake, which it takes for an unknown RPC
+	legacy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer legacy.Close()
+	go func() {
+		for {
+			conn, err := legacy.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 2)
+				if _, err := io.ReadFull(conn, buf); err == nil && buf[0] != handshakeMagic[0] {
+					conn.Write(buf)
+				}
+			}()
+		}
+	}()
+
+	for _, allow := range []bool{false, true} {
+		dialer, _ := newTestLayer(t, "node1", "c1", allow)
+		conn, err := dialer.Dial(raft.ServerAddress(legacy.Addr().String()), time.Second)
+		if !allow {
+			if err == nil {
+				conn.Close()
+				t.Error("connected to a legacy node without allowing legacy peers")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Dial() of a legacy node = %v", err)
+		}
+		roundTrip(t, conn)
+		conn.Close()
+	}
+}
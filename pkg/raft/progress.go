@@ -0,0 +1,109 @@
+package raft
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// PeerProgress is what the leader last heard back from a peer.
+type PeerProgress struct {
+	// LastContact is when the peer last answered an AppendEntries RPC,
+	// heartbeats included.
+	LastContact time.Time
+	// LastLogIndex is the index of the last entry in the peer's log as of
+	// that answer.
+	LastLogIndex uint64
+}
+
+// progressTransport records the answers of peers to AppendEntries RPCs, which
+// hashicorp/raft keeps to itself, so that the leader can report how far each
+// follower is behind.
+type progressTransport struct {
+	*raft.NetworkTransport
+
+	mu    sync.Mutex
+	peers map[raft.ServerID]PeerProgress
+}
+
+func newProgressTransport(transport *raft.NetworkTransport) *progressTransport {
+	return &progressTransport{
+		NetworkTransport: transport,
+		peers:            make(map[raft.ServerID]PeerProgress),
+	}
+}
+
+func (t *progressTransport) AppendEntries(id raft.ServerID, target raft.ServerAddress, args *raft.AppendEntriesRequest, resp *raft.AppendEntriesResponse) error {
+	if err := t.NetworkTransport.AppendEntries(id, target, args, resp); err != nil {
+		return err
+	}
+	t.record(id, resp)
+	return nil
+}
+
+func (t *progressTransport) AppendEntriesPipeline(id raft.ServerID, target raft.ServerAddress) (raft.AppendPipeline, error) {
+	pipeline, err := t.NetworkTransport.AppendEntriesPipeline(id, target)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &progressPipeline{
+		AppendPipeline: pipeline,
+		consumer:       make(chan raft.AppendFuture),
+		stopCh:         make(chan struct{}),
+	}
+	go p.run(func(resp *raft.AppendEntriesResponse) { t.record(id, resp) })
+	return p, nil
+}
+
+func (t *progressTransport) record(id raft.ServerID, resp *raft.AppendEntriesResponse) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.peers[id] = PeerProgress{LastContact: time.Now(), LastLogIndex: resp.LastLog}
+}
+
+func (t *progressTransport) progress(id raft.ServerID) (PeerProgress, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	progress, found := t.peers[id]
+	return progress, found
+}
+
+// progressPipeline passes the answers of a pipelined AppendEntries stream on
+// to raft after recording them.
+type progressPipeline struct {
+	raft.AppendPipeline
+
+	consumer chan raft.AppendFuture
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+func (p *progressPipeline) run(record func(*raft.AppendEntriesResponse)) {
+	inner := p.AppendPipeline.Consumer()
+	for {
+		select {
+		case future := <-inner:
+			if future.Error() == nil {
+				record(future.Response())
+			}
+			select {
+			case p.consumer <- future:
+			case <-p.stopCh:
+				return
+			}
+		case <-p.stopCh:
+			return
+		}
+	}
+}
+
+func (p *progressPipeline) Consumer() <-chan raft.AppendFuture {
+	return p.consumer
+}
+
+func (p *progressPipeline) Close() error {
+	p.stopOnce.Do(func() { close(p.stopCh) })
+	return p.AppendPipeline.Close()
+}
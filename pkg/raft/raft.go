@@ -1,16 +1,27 @@
 package raft
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net"
-	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/raft"
 	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
 	"github.com/raft3d/internal/fsm"
+	"github.com/raft3d/pkg/logging"
+	"github.com/raft3d/pkg/tlsutil"
+	"github.com/raft3d/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Config struct {
@@ -21,18 +32,73 @@ type Config struct {
 	SnapshotThreshold uint64
 	ClusterNodes      []string
 	Bootstrap         bool
+	// The timing and storage settings below override the hashicorp/raft
+	// defaults when non-zero.
+	HeartbeatTimeout   time.Duration
+	ElectionTimeout    time.Duration
+	LeaderLeaseTimeout time.Duration
+	CommitTimeout      time.Duration
+	MaxAppendEntries   int
+	TrailingLogs       uint64
+	// SnapshotRetain is how many snapshots are kept on disk; 3 by default.
+	SnapshotRetain int
+	// TransportPoolSize and TransportTimeout configure the connection pool
+	// kept to each peer and the I/O deadline of its RPCs; 3 and 10s by
+	// default.
+	TransportPoolSize int
+	TransportTimeout  time.Duration
+	// AllowLegacyPeers accepts connections without a cluster handshake and
+	// retries connections to peers that hang up on one without it.
+	AllowLegacyPeers bool
+	// TLS enables mutual TLS on the Raft transport when set.
+	TLS *tlsutil.Reloader
+	// Logger receives the logs of the server and of hashicorp/raft. It
+	// defaults to slog.Default().
+	Logger *slog.Logger
 }
 
 type Server struct {
-	config *Config
-	fsm    *fsm.FSM
-	raft   *raft.Raft
+	config    *Config
+	fsm       *fsm.FSM
+	raft      *raft.Raft
+	transport *progressTransport
+	logger    *slog.Logger
+
+	logStore    *raftboltdb.BoltStore
+	stableStore *raftboltdb.BoltStore
+	stream      *clusterStreamLayer
+
+	clusterMu sync.Mutex
+	clusterID string
+
+	// peers maps the addresses of nodes expected to join, or of the
+	// cluster this node joins, to their IDs.
+	peersMu sync.Mutex
+	peers   map[raft.ServerAddress]raft.ServerID
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+
+	// startIndex is the last log index on disk when Raft started; the state
+	// machine is restored once it has applied up to it.
+	startIndex uint64
+	restored   atomic.Bool
+
+	// bootstrapping is set while this node waits to bootstrap a new cluster.
+	bootstrapping atomic.Bool
 }
 
 func NewServer(config *Config, fsm *fsm.FSM) (*Server, error) {
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
 	return &Server{
 		config: config,
 		fsm:    fsm,
+		logger: logger,
+		peers:  make(map[raft.ServerAddress]raft.ServerID),
+		stopCh: make(chan struct{}),
 	}, nil
 }
 
@@ -48,18 +114,48 @@ func (s *Server) Start() error {
 
 	raftConfig := raft.DefaultConfig()
 	raftConfig.LocalID = raft.ServerID(s.config.NodeID)
+	if s.config.SnapshotThreshold > 0 {
+		raftConfig.SnapshotThreshold = s.config.SnapshotThreshold
+	}
+	if s.config.HeartbeatTimeout > 0 {
+		raftConfig.HeartbeatTimeout = s.config.HeartbeatTimeout
+	}
+	if s.config.ElectionTimeout > 0 {
+		raftConfig.ElectionTimeout = s.config.ElectionTimeout
+	}
+	if s.config.LeaderLeaseTimeout > 0 {
+		raftConfig.LeaderLeaseTimeout = s.config.LeaderLeaseTimeout
+	}
+	if s.config.CommitTimeout > 0 {
+		raftConfig.CommitTimeout = s.config.CommitTimeout
+	}
+	if s.config.MaxAppendEntries > 0 {
+		raftConfig.MaxAppendEntries = s.config.MaxAppendEntries
+	}
+	if s.config.TrailingLogs > 0 {
+		raftConfig.TrailingLogs = s.config.TrailingLogs
+	}
 
-	addr, err := net.ResolveTCPAddr("tcp", s.config.RaftAddr)
-	if err != nil {
-		return fmt.Errorf("failed to resolve TCP address: %v", err)
+	poolSize, timeout, retain := 3, 10*time.Second, 3
+	if s.config.TransportPoolSize > 0 {
+		poolSize = s.config.TransportPoolSize
+	}
+	if s.config.TransportTimeout > 0 {
+		timeout = s.config.TransportTimeout
+	}
+	if s.config.SnapshotRetain > 0 {
+		retain = s.config.SnapshotRetain
 	}
 
-	transport, err := raft.NewTCPTransport(s.config.RaftAddr, addr, 3, 10*time.Second, os.Stderr)
+	raftLogger := logging.NewHCLogger(s.logger, "raft")
+	raftConfig.Logger = raftLogger
+
+	addr, err := net.ResolveTCPAddr("tcp", s.config.RaftAddr)
 	if err != nil {
-		return fmt.Errorf("failed to create TCP transport: %v", err)
+		return fmt.Errorf("failed to resolve TCP address: %v", err)
 	}
 
-	snapshotStore, err := raft.NewFileSnapshotStore(s.config.RaftDir, 3, os.Stderr)
+	snapshotStore, err := raft.NewFileSnapshotStoreWithLogger(s.config.RaftDir, retain, raftLogger)
 	if err != nil {
 		return fmt.Errorf("failed to create snapshot store: %v", err)
 	}
@@ -76,12 +172,39 @@ func (s *Server) Start() error {
 		return fmt.Errorf("failed to create stable store: %v", err)
 	}
 
-	ra, err := raft.NewRaft(raftConfig, s.fsm, logStore, stableStore, snapshotStore, transport)
+	s.logStore = logStore
+	s.stableStore = stableStore
+	if err := s.loadClusterID(); err != nil {
+		return err
+	}
+
+	hasState, err := raft.HasExistingState(logStore, stableStore, snapshotStore)
+	if err != nil {
+		return fmt.Errorf("failed to check for existing state: %v", err)
+	}
+
+	var stream raft.StreamLayer
+	if s.config.TLS != nil {
+		stream, err = newTLSStreamLayer(s.config.RaftAddr, addr, s.config.TLS, s.nodeIDForAddress, s.knownPeer)
+		if err != nil {
+			return fmt.Errorf("failed to create TLS stream layer: %v", err)
+		}
+	} else {
+		stream, err = newTCPStreamLayer(s.config.RaftAddr, addr)
+		if err != nil {
+			return fmt.Errorf("failed to create TCP stream layer: %v", err)
+		}
+	}
+	s.stream = &clusterStreamLayer{StreamLayer: stream, server: s}
+	s.transport = newProgressTransport(raft.NewNetworkTransportWithLogger(s.stream, poolSize, timeout, raftLogger))
+
+	ra, err := raft.NewRaft(raftConfig, s.fsm, logStore, stableStore, snapshotStore, s.transport)
 	if err != nil {
 		return fmt.Errorf("failed to create Raft instance: %v", err)
 	}
 
 	s.raft = ra
+	s.startIndex = ra.LastIndex()
 
 	if s.config.Bootstrap {
 		configuration := raft.Configuration{
@@ -100,15 +223,17 @@ func (s *Server) Start() error {
 			}
 		}
 
-		future := ra.BootstrapCluster(configuration)
-		if err := future.Error(); err != nil && err != raft.ErrCantBootstrap {
-			return fmt.Errorf("failed to bootstrap cluster: %v", err)
+		if hasState {
+			s.checkBootstrapConfiguration(configuration)
+		} else {
+			go s.bootstrapWhenReady(configuration)
 		}
 	}
 
 	if s.config.SnapshotInterval > 0 {
 		go s.runSnapshotting()
 	}
+	go s.runClusterID()
 
 	return nil
 }
@@ -123,29 +248,71 @@ func (s *Server) runSnapshotting() {
 			if s.raft.State() == raft.Leader {
 				future := s.raft.Snapshot()
 				if err := future.Error(); err != nil {
-					fmt.Fprintf(os.Stderr, "Failed to create snapshot: %v\n", err)
+					s.logger.Error("failed to create snapshot", "err", err)
 				}
 			}
+		case <-s.stopCh:
+			return
 		}
 	}
 }
 
 func (s *Server) Apply(cmd []byte, timeout time.Duration) (interface{}, error) {
+	resp, _, err := s.apply(cmd, timeout)
+	return resp, err
+}
+
+// apply applies an encoded command and also returns its log index.
+func (s *Server) apply(cmd []byte, timeout time.Duration) (interface{}, uint64, error) {
 	if s.raft.State() != raft.Leader {
-		return nil, fmt.Errorf("not the leader")
+		return nil, 0, fmt.Errorf("not the leader")
 	}
 
 	future := s.raft.Apply(cmd, timeout)
 	if err := future.Error(); err != nil {
-		return nil, fmt.Errorf("failed to apply command: %v", err)
+		return nil, 0, fmt.Errorf("failed to apply command: %v", err)
 	}
 
 	resp := future.Response()
 	if err, ok := resp.(error); ok {
-		return nil, err
+		return nil, future.Index(), err
 	}
 
-	return resp, nil
+	return resp, future.Index(), nil
+}
+
+// ApplyCommand stamps cmd with the leader's clock and command version,
+// encodes it and applies it to the replicated log. The wait for the command to be committed and
+// applied is traced as a child of the trace context cmd carries, which is
+// replaced by that of the new span so that apply spans nest below it.
+func (s *Server) ApplyCommand(cmd *fsm.Command, timeout time.Duration) (interface{}, error) {
+	if cmd.Timestamp.IsZero() {
+		cmd.Timestamp = time.Now().UTC()
+	}
+	cmd.Version = fsm.CommandVersion
+
+	ctx, span := tracing.Tracer().Start(tracing.Extract(context.Background(), cmd.TraceContext), "raft.apply",
+		trace.WithAttributes(
+			attribute.String("raft3d.op", cmd.Op),
+			attribute.String("raft3d.entity", cmd.EntityType),
+		))
+	defer span.End()
+	cmd.TraceContext = tracing.Inject(ctx)
+
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to marshal command: %v", err)
+	}
+
+	resp, index, err := s.apply(data, timeout)
+	if index != 0 {
+		span.SetAttributes(attribute.Int64("raft.index", int64(index)))
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return resp, err
 }
 
 func (s *Server) GetState() raft.RaftState {
@@ -160,9 +327,160 @@ func (s *Server) LeaderAddr() string {
 	return string(s.raft.Leader())
 }
 
+func (s *Server) LeaderID() string {
+	_, id := s.raft.LeaderWithID()
+	return string(id)
+}
+
+// Stats is a point in time view of this node's Raft state.
+type Stats struct {
+	State        raft.RaftState
+	Term         uint64
+	LastLogIndex uint64
+	CommitIndex  uint64
+	AppliedIndex uint64
+	// LastContact is when this node last heard from the leader. It is only
+	// meaningful on followers and is the zero time until a leader is heard.
+	LastContact time.Time
+}
+
+func (s *Server) Stats() Stats {
+	return Stats{
+		State:        s.raft.State(),
+		Term:         s.raft.CurrentTerm(),
+		LastLogIndex: s.raft.LastIndex(),
+		CommitIndex:  s.raft.CommitIndex(),
+		AppliedIndex: s.raft.AppliedIndex(),
+		LastContact:  s.raft.LastContact(),
+	}
+}
+
+// Restored reports whether the state machine has caught up with the snapshot
+// and log entries this node had on disk when it started.
+func (s *Server) Restored() bool {
+	if s.restored.Load() {
+		return true
+	}
+	if s.raft.AppliedIndex() < s.startIndex {
+		return false
+	}
+	s.restored.Store(true)
+	return true
+}
+
+// PeerProgress returns what this node last heard back from a peer while it
+// was the leader.
+func (s *Server) PeerProgress(nodeID string) (PeerProgress, bool) {
+	return s.transport.progress(raft.ServerID(nodeID))
+}
+
+// Shutdown stops the node in order. A leader first hands leadership to its
+// most up-to-date follower so the cluster does not sit out an election
+// timeout, then a final snapshot shortens the log replayed on restart, and
+// finally Raft, its transport and its stores are closed.
 func (s *Server) Shutdown() error {
-	future := s.raft.Shutdown()
-	return future.Error()
+	s.stopOnce.Do(func() { close(s.stopCh) })
+
+	if s.IsLeader() {
+		if err := s.transferLeadership(); err != nil {
+			s.logger.Warn("failed to transfer leadership before shutdown", "err", err)
+		}
+	}
+
+	if err := s.raft.Snapshot().Error(); err != nil && !errors.Is(err, raft.ErrNothingNewToSnapshot) {
+		s.logger.Warn("failed to take final snapshot", "err", err)
+	}
+
+	if err := s.raft.Shutdown().Error(); err != nil {
+		return fmt.Errorf("failed to shut down raft: %v", err)
+	}
+
+	var errs []error
+	if err := s.transport.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close transport: %v", err))
+	}
+	if err := s.logStore.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close log store: %v", err))
+	}
+	if err := s.stableStore.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close stable store: %v", err))
+	}
+	return errors.Join(errs...)
+}
+
+// Join adds a voting member to the cluster. It must be called on the leader.
+func (s *Server) Join(nodeID, addr string) error {
+	if s.raft.State() != raft.Leader {
+		return fmt.Errorf("not the leader")
+	}
+
+	s.ExpectPeer(nodeID, addr)
+
+	// Refuse nodes that belong to another cluster up front; unreachable nodes
+	// are added and caught up once they come up
+	if reply, _ := s.stream.probe(raft.ServerAddress(addr), 2*time.Second); reply.clusterID != "" && reply.clusterID != s.ClusterID() {
+		return fmt.Errorf("node %s belongs to cluster %s", nodeID, reply.clusterID)
+	}
+
+	configFuture := s.raft.GetConfiguration()
+	if err := configFuture.Error(); err != nil {
+		return fmt.Errorf("failed to get raft configuration: %v", err)
+	}
+
+	for _, srv := range configFuture.Configuration().Servers {
+		if srv.ID == raft.ServerID(nodeID) && srv.Address == raft.ServerAddress(addr) {
+			return nil
+		}
+		if srv.ID == raft.ServerID(nodeID) || srv.Address == raft.ServerAddress(addr) {
+			future := s.raft.RemoveServer(srv.ID, 0, 0)
+			if err := future.Error(); err != nil {
+				return fmt.Errorf("failed to remove existing node %s: %v", srv.ID, err)
+			}
+		}
+	}
+
+	future := s.raft.AddVoter(raft.ServerID(nodeID), raft.ServerAddress(addr), 0, 0)
+	if err := future.Error(); err != nil {
+		return fmt.Errorf("failed to add voter: %v", err)
+	}
+
+	return nil
+}
+
+// Remove removes a member from the cluster. It must be called on the leader.
+func (s *Server) Remove(nodeID string) error {
+	if s.raft.State() != raft.Leader {
+		return fmt.Errorf("not the leader")
+	}
+
+	future := s.raft.RemoveServer(raft.ServerID(nodeID), 0, 0)
+	if err := future.Error(); err != nil {
+		return fmt.Errorf("failed to remove server: %v", err)
+	}
+
+	return nil
+}
+
+func (s *Server) Servers() ([]raft.Server, error) {
+	future := s.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return nil, fmt.Errorf("failed to get raft configuration: %v", err)
+	}
+	return future.Configuration().Servers, nil
+}
+
+// IsMember reports whether nodeID is in the Raft configuration.
+func (s *Server) IsMember(nodeID string) bool {
+	servers, err := s.Servers()
+	if err != nil {
+		return false
+	}
+	for _, srv := range servers {
+		if srv.ID == raft.ServerID(nodeID) {
+			return true
+		}
+	}
+	return false
 }
 
 func (s *Server) GetNodeID() string {
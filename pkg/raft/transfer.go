@@ -0,0 +1,141 @@
+package raft
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// maxTransferLag is how many log entries a follower may trail the leader by
+// and still be handed leadership on request.
+const maxTransferLag = 100
+
+// TransferLeadership hands leadership to target, or to the most up-to-date
+// caught-up voter when target is empty, and returns the ID of the new
+// leader. It must be called on the leader. The target must be a voter that
+// answered within the heartbeat timeout and trails the log by no more than
+// a few entries, so that writes are not held up while it catches up.
+func (s *Server) TransferLeadership(target string) (string, error) {
+	if s.raft.State() != raft.Leader {
+		return "", fmt.Errorf("not the leader")
+	}
+
+	voters, err := s.otherVoters()
+	if err != nil {
+		return "", err
+	}
+
+	var srv *raft.Server
+	if target == "" {
+		var caughtUp []raft.Server
+		for _, voter := range voters {
+			if s.checkCaughtUp(voter.ID) == nil {
+				caughtUp = append(caughtUp, voter)
+			}
+		}
+		if srv = s.mostUpToDate(caughtUp); srv == nil {
+			return "", fmt.Errorf("no other voter is caught up with the leader")
+		}
+	} else {
+		if target == s.config.NodeID {
+			return "", fmt.Errorf("%s is already the leader", target)
+		}
+		for i := range voters {
+			if voters[i].ID == raft.ServerID(target) {
+				srv = &voters[i]
+			}
+		}
+		if srv == nil {
+			return "", fmt.Errorf("%s is not a voting member of the cluster", target)
+		}
+		if err := s.checkCaughtUp(srv.ID); err != nil {
+			return "", err
+		}
+	}
+
+	if err := s.handOver(srv); err != nil {
+		return "", err
+	}
+	return string(srv.ID), nil
+}
+
+// transferLeadership hands leadership over before this node shuts down. A
+// caught-up voter is preferred, but any voter is better than an election, as
+// Raft brings the target up to date before handing over. It does nothing
+// when this node is the only voter.
+func (s *Server) transferLeadership() error {
+	voters, err := s.otherVoters()
+	if err != nil {
+		return err
+	}
+
+	var caughtUp []raft.Server
+	for _, voter := range voters {
+		if s.checkCaughtUp(voter.ID) == nil {
+			caughtUp = append(caughtUp, voter)
+		}
+	}
+
+	srv := s.mostUpToDate(caughtUp)
+	if srv == nil {
+		srv = s.mostUpToDate(voters)
+	}
+	if srv == nil {
+		return nil
+	}
+	return s.handOver(srv)
+}
+
+func (s *Server) handOver(srv *raft.Server) error {
+	progress, _ := s.transport.progress(srv.ID)
+	s.logger.Info("transferring leadership", "to", srv.ID, "last_log_index", progress.LastLogIndex)
+
+	if err := s.raft.LeadershipTransferToServer(srv.ID, srv.Address).Error(); err != nil {
+		return fmt.Errorf("failed to transfer leadership to %s: %v", srv.ID, err)
+	}
+	return nil
+}
+
+// otherVoters returns the voting members of the cluster other than this node.
+func (s *Server) otherVoters() ([]raft.Server, error) {
+	servers, err := s.Servers()
+	if err != nil {
+		return nil, err
+	}
+
+	var voters []raft.Server
+	for _, srv := range servers {
+		if srv.ID != raft.ServerID(s.config.NodeID) && srv.Suffrage == raft.Voter {
+			voters = append(voters, srv)
+		}
+	}
+	return voters, nil
+}
+
+// checkCaughtUp reports why a follower is not fit to take over leadership.
+func (s *Server) checkCaughtUp(id raft.ServerID) error {
+	progress, found := s.transport.progress(id)
+	heartbeat := s.raft.ReloadableConfig().HeartbeatTimeout
+	if !found || time.Since(progress.LastContact) > heartbeat {
+		return fmt.Errorf("%s has not answered within %s", id, heartbeat)
+	}
+
+	if lastIndex := s.raft.LastIndex(); lastIndex > progress.LastLogIndex+maxTransferLag {
+		return fmt.Errorf("%s trails the leader by %d log entries", id, lastIndex-progress.LastLogIndex)
+	}
+	return nil
+}
+
+// mostUpToDate returns the server that has replicated the most of the log.
+func (s *Server) mostUpToDate(servers []raft.Server) *raft.Server {
+	var best *raft.Server
+	var bestIndex uint64
+	for i := range servers {
+		progress, _ := s.transport.progress(servers[i].ID)
+		if best == nil || progress.LastLogIndex > bestIndex {
+			best, bestIndex = &servers[i], progress.LastLogIndex
+		}
+	}
+	return best
+}
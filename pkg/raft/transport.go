@@ -0,0 +1,141 @@
+package raft
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/raft3d/pkg/tlsutil"
+)
+
+// tlsStreamLayer carries Raft RPCs over mutually authenticated TLS. Every peer
+// must present a certificate signed by the cluster CA whose common name is its
+// node ID. Incoming connections are only accepted from known nodes, and
+// outgoing connections check that the certificate matches the node ID known
+// for the dialled address.
+type tlsStreamLayer struct {
+	net.Listener
+	advertise net.Addr
+	reloader  *tlsutil.Reloader
+	nodeIDFor func(raft.ServerAddress) string
+}
+
+func newTLSStreamLayer(bindAddr string, advertise net.Addr, reloader *tlsutil.Reloader, nodeIDFor func(raft.ServerAddress) string, knownPeer func(string) error) (*tlsStreamLayer, error) {
+	listener, err := net.Listen("tcp", bindAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %v", bindAddr, err)
+	}
+
+	return &tlsStreamLayer{
+		Listener:  tls.NewListener(listener, reloader.ServerConfig(tls.RequireAndVerifyClientCert, knownPeer)),
+		advertise: advertise,
+		reloader:  reloader,
+		nodeIDFor: nodeIDFor,
+	}, nil
+}
+
+func (t *tlsStreamLayer) Dial(address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	return tls.DialWithDialer(dialer, "tcp", string(address), t.reloader.ClientConfig(tlsutil.ExpectNode(t.nodeIDFor(address))))
+}
+
+func (t *tlsStreamLayer) Addr() net.Addr {
+	if t.advertise != nil {
+		return t.advertise
+	}
+	return t.Listener.Addr()
+}
+
+// tcpStreamLayer carries Raft RPCs over plain TCP. It replaces the stream
+// layer of raft.NewTCPTransport so that connections can be wrapped in the
+// cluster handshake.
+type tcpStreamLayer struct {
+	net.Listener
+	advertise net.Addr
+}
+
+func newTCPStreamLayer(bindAddr string, advertise net.Addr) (*tcpStreamLayer, error) {
+	if tcpAddr, ok := advertise.(*net.TCPAddr); !ok || tcpAddr.IP == nil || tcpAddr.IP.IsUnspecified() {
+		return nil, fmt.Errorf("raft address %s is not advertisable", advertise)
+	}
+
+	listener, err := net.Listen("tcp", bindAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %v", bindAddr, err)
+	}
+	return &tcpStreamLayer{Listener: listener, advertise: advertise}, nil
+}
+
+func (t *tcpStreamLayer) Dial(address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout("tcp", string(address), timeout)
+}
+
+func (t *tcpStreamLayer) Addr() net.Addr {
+	return t.advertise
+}
+
+// ExpectPeer makes a node that is neither in the Raft configuration nor in
+// the configured nodes known to this one, so that it may connect and is
+// expected at addr. A joining node learns the members of the cluster this
+// way, and the leader the node it adds.
+func (s *Server) ExpectPeer(nodeID, addr string) {
+	s.peersMu.Lock()
+	defer s.peersMu.Unlock()
+	s.peers[raft.ServerAddress(addr)] = raft.ServerID(nodeID)
+}
+
+// nodeIDForAddress maps a Raft address to the node ID expected on the other
+// end, using the live configuration and falling back to the expected peers
+// and the configured nodes. It returns "" for unknown addresses.
+func (s *Server) nodeIDForAddress(address raft.ServerAddress) string {
+	if s.raft != nil {
+		for _, srv := range s.raft.GetConfiguration().Configuration().Servers {
+			if srv.Address == address {
+				return string(srv.ID)
+			}
+		}
+	}
+
+	s.peersMu.Lock()
+	id, expected := s.peers[address]
+	s.peersMu.Unlock()
+	if expected {
+		return string(id)
+	}
+
+	for _, node := range s.config.ClusterNodes {
+		id, addr, err := parseNodeString(node)
+		if err == nil && raft.ServerAddress(addr) == address {
+			return id
+		}
+	}
+
+	return ""
+}
+
+// knownPeer accepts connections from nodes in the live configuration, the
+// expected peers or the configured nodes.
+func (s *Server) knownPeer(nodeID string) error {
+	if s.raft != nil && s.IsMember(nodeID) {
+		return nil
+	}
+
+	s.peersMu.Lock()
+	for _, id := range s.peers {
+		if id == raft.ServerID(nodeID) {
+			s.peersMu.Unlock()
+			return nil
+		}
+	}
+	s.peersMu.Unlock()
+
+	for _, node := range s.config.ClusterNodes {
+		if id, _, err := parseNodeString(node); err == nil && id == nodeID {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("node %q is not a known member of the cluster", nodeID)
+}
@@ -0,0 +1,235 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Config points at the PEM files used for TLS. CAFile is required for mutual
+// TLS; without it peers are verified against the system roots.
+type Config struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+}
+
+func (c *Config) Enabled() bool {
+	return c.CertFile != "" && c.KeyFile != ""
+}
+
+// Reloader serves the current certificate and CA pool to TLS handshakes and
+// swaps them when the files on disk change, so certificates can be rotated
+// without restarting the node.
+type Reloader struct {
+	config Config
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	pool     *x509.CertPool
+	modTimes map[string]time.Time
+}
+
+func NewReloader(config Config) (*Reloader, error) {
+	if !config.Enabled() {
+		return nil, fmt.Errorf("TLS certificate and key files are required")
+	}
+
+	r := &Reloader{config: config}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the certificate, key and CA files from disk.
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS key pair: %v", err)
+	}
+
+	var pool *x509.CertPool
+	if r.config.CAFile != "" {
+		caData, err := os.ReadFile(r.config.CAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read CA file: %v", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caData) {
+			return fmt.Errorf("no certificates found in CA file %s", r.config.CAFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.pool = pool
+	r.modTimes = r.currentModTimes()
+	return nil
+}
+
+func (r *Reloader) currentModTimes() map[string]time.Time {
+	modTimes := make(map[string]time.Time)
+	for _, path := range []string{r.config.CertFile, r.config.KeyFile, r.config.CAFile} {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			modTimes[path] = info.ModTime()
+		}
+	}
+	return modTimes
+}
+
+func (r *Reloader) changed() bool {
+	current := r.currentModTimes()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for path, modTime := range current {
+		if !modTime.Equal(r.modTimes[path]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch polls the certificate files and reloads them when they change. It
+// returns when stopCh is closed.
+func (r *Reloader) Watch(interval time.Duration, stopCh <-chan struct{}, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.Reload(); err != nil && onError != nil {
+				onError(err)
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (r *Reloader) certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+func (r *Reloader) caPool() *x509.CertPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.pool
+}
+
+// ServerConfig returns a server side TLS configuration. Client certificates
+// are verified against the CA pool according to clientAuth, and the node
+// they were issued to by verifyPeer, if set.
+func (r *Reloader) ServerConfig(clientAuth tls.ClientAuthType, verifyPeer func(nodeID string) error) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.certificate(), nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.certificate()},
+				ClientAuth:   clientAuth,
+				ClientCAs:    r.caPool(),
+				VerifyConnection: func(state tls.ConnectionState) error {
+					if len(state.PeerCertificates) == 0 {
+						return nil
+					}
+					peerID := NodeID(state.PeerCertificates[0])
+					if clientAuth == tls.RequireAndVerifyClientCert && peerID == "" {
+						return fmt.Errorf("peer certificate has no node ID")
+					}
+					if verifyPeer != nil {
+						return verifyPeer(peerID)
+					}
+					return nil
+				},
+			}, nil
+		},
+	}
+}
+
+// ClientConfig returns a client side TLS configuration that presents the
+// local certificate and verifies that the server certificate was issued by the
+// CA pool to a node verifyPeer accepts.
+func (r *Reloader) ClientConfig(verifyPeer func(nodeID string) error) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// Verification happens in VerifyConnection against the current CA
+		// pool and the node ID instead of the dialled host name.
+		InsecureSkipVerify: true,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return r.certificate(), nil
+		},
+		VerifyConnection: func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return fmt.Errorf("peer did not present a certificate")
+			}
+			if err := r.verify(state.PeerCertificates, x509.ExtKeyUsageServerAuth); err != nil {
+				return err
+			}
+			return verifyPeer(NodeID(state.PeerCertificates[0]))
+		},
+	}
+}
+
+// ExpectNode accepts only the certificate of node expectedID. Without an
+// expected ID nothing is accepted, so that connections to addresses of
+// unknown nodes fail closed.
+func ExpectNode(expectedID string) func(nodeID string) error {
+	return func(nodeID string) error {
+		if expectedID == "" {
+			return fmt.Errorf("no node is known at this address")
+		}
+		if nodeID != expectedID {
+			return fmt.Errorf("peer certificate is for node %q, expected %q", nodeID, expectedID)
+		}
+		return nil
+	}
+}
+
+// AnyNode accepts the certificate of any node the CA issued one to. It is
+// meant for finding a cluster before the IDs of its members are known.
+func AnyNode(nodeID string) error {
+	if nodeID == "" {
+		return fmt.Errorf("peer certificate has no node ID")
+	}
+	return nil
+}
+
+func (r *Reloader) verify(chain []*x509.Certificate, usage x509.ExtKeyUsage) error {
+	opts := x509.VerifyOptions{
+		Roots:         r.caPool(),
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	}
+	for _, cert := range chain[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	if _, err := chain[0].Verify(opts); err != nil {
+		return fmt.Errorf("failed to verify peer certificate: %v", err)
+	}
+	return nil
+}
+
+// NodeID returns the node ID a certificate was issued to, taken from its
+// common name.
+func NodeID(cert *x509.Certificate) string {
+	return cert.Subject.CommonName
+}
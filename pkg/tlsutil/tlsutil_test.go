@@ -0,0 +1,161 @@
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA issues node certificates into a temporary directory.
+type testCA struct {
+	t    *testing.T
+	dir  string
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "raft3d test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca := &testCA{t: t, dir: t.TempDir(), cert: cert, key: key}
+	ca.file = ca.write("ca.pem", "CERTIFICATE", der)
+	return ca
+}
+
+func (ca *testCA) write(name, blockType string, der []byte) string {
+	ca.t.Helper()
+	path := filepath.Join(ca.dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		ca.t.Fatal(err)
+	}
+	return path
+}
+
+// reloader issues a certificate for nodeID and returns a reloader serving it.
+func (ca *testCA) reloader(nodeID string, serial int64) *Reloader {
+	ca.t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: nodeID},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+
+	r, err := NewReloader(Config{
+		CertFile: ca.write(nodeID+".pem", "CERTIFICATE", der),
+		KeyFile:  ca.write(nodeID+".key", "EC PRIVATE KEY", keyDER),
+		CAFile:   ca.file,
+	})
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+	return r
+}
+
+func TestPeerIdentityIsCheckedOnBothEnds(t *testing.T) {
+	ca := newTestCA(t)
+	node1, node2, stranger := ca.reloader("node1", 2), ca.reloader("node2", 3), ca.reloader("stranger", 4)
+
+	members := map[string]bool{"node1": true, "node2": true}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", node1.ServerConfig(tls.RequireAndVerifyClientCert, func(nodeID string) error {
+		if !members[nodeID] {
+			return fmt.Errorf("node %q is not a member", nodeID)
+		}
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				b := make([]byte, 1)
+				if _, err := conn.Read(b); err == nil {
+					conn.Write(b)
+				}
+			}()
+		}
+	}()
+
+	tests := []struct {
+		name   string
+		client *Reloader
+		verify func(string) error
+		ok     bool
+	}{
+		{"member dials the expected node", node2, ExpectNode("node1"), true},
+		{"member dials another node than expected", node2, ExpectNode("node2"), false},
+		{"member dials an unknown address", node2, ExpectNode(""), false},
+		{"member looks for any node", node2, AnyNode, true},
+		{"stranger dials a member", stranger, ExpectNode("node1"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := tls.Dial("tcp", listener.Addr().String(), tt.client.ClientConfig(tt.verify))
+			if err == nil {
+				// The server checks the client certificate after the client
+				// finished its side of the handshake; the echo tells.
+				conn.SetDeadline(time.Now().Add(5 * time.Second))
+				conn.Write([]byte{0})
+				_, err = conn.Read(make([]byte, 1))
+				conn.Close()
+			}
+			if (err == nil) != tt.ok {
+				t.Errorf("connection error = %v, want success %v", err, tt.ok)
+			}
+		})
+	}
+}
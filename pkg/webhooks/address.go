@@ -0,0 +1,72 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// sharedAddressSpace is the carrier-grade NAT range, which cloud providers and
+// overlay networks also use for internal addresses.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// checkAddress rejects addresses that are internal to the network the leader
+// runs in: loopback, private, link-local, shared, unspecified and multicast
+// addresses.
+func checkAddress(ip net.IP) error {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip) {
+		return fmt.Errorf("webhooks may not be sent to internal address %s", ip)
+	}
+	return nil
+}
+
+// CheckURL rejects webhook URLs that are not http or https, or whose host
+// resolves to an internal address. Tenants could otherwise make the leader
+// send requests to services of the cluster's network.
+func CheckURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook URL must be an absolute http or https URL")
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("failed to resolve webhook host: %v", err)
+	}
+	for _, addr := range addrs {
+		if err := checkAddress(addr.IP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newClient returns a client that refuses to connect to internal addresses,
+// so that a host resolving to another address at delivery time than when it
+// was checked is refused too.
+func newClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil {
+				return fmt.Errorf("webhooks may not be sent to %s", host)
+			}
+			return checkAddress(ip)
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
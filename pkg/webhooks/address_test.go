@@ -0,0 +1,49 @@
+package webhooks
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://93.184.216.34/hooks", true},
+		{"http://[2606:2800:220:1:248:1893:25c8:1946]:8080/", true},
+		{"ftp://93.184.216.34/", false},
+		{"/relative", false},
+		{"http://127.0.0.1:8001/api/v1/tokens", false},
+		{"http://localhost/", false},
+		{"http://[::1]/", false},
+		{"http://[::ffff:127.0.0.1]/", false},
+		{"http://0.0.0.0/", false},
+		{"http://10.1.2.3/", false},
+		{"http://172.16.0.1/", false},
+		{"http://192.168.1.20/", false},
+		{"http://[fd00::1]/", false},
+		{"http://169.254.169.254/latest/meta-data/", false},
+		{"http://[fe80::1]/", false},
+		{"http://100.64.0.1/", false},
+		{"http://224.0.0.1/", false},
+	}
+	for _, tt := range tests {
+		if err := CheckURL(context.Background(), tt.url); (err == nil) != tt.allowed {
+			t.Errorf("CheckURL(%q) = %v, want allowed %v", tt.url, err, tt.allowed)
+		}
+	}
+}
+
+func TestClientRefusesInternalAddresses(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	if _, err := newClient(defaultTimeout).Get("http://" + listener.Addr().String()); err == nil {
+		t.Error("the delivery client connected to the loopback address")
+	}
+}
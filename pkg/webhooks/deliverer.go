@@ -0,0 +1,199 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/raft3d/internal/fsm"
+	"github.com/raft3d/pkg/models"
+	"github.com/raft3d/pkg/raft"
+)
+
+const (
+	SignatureHeader = "X-Raft3D-Signature"
+	EventHeader     = "X-Raft3D-Event"
+	DeliveryHeader  = "X-Raft3D-Delivery"
+)
+
+// defaultTimeout bounds each delivery when the client sets no timeout.
+const defaultTimeout = 10 * time.Second
+
+// Sign returns the signature header value of a payload: the hex encoded
+// HMAC-SHA256 of the body keyed with the webhook secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Deliverer runs on the leader and posts pending webhook deliveries. It
+// refuses to post to internal addresses, see CheckURL. Each
+// attempt's outcome is committed through Raft before the next, so a new leader
+// picks up where the old one stopped. Receivers may see a delivery twice if a
+// leader fails between posting and committing, and should deduplicate by the
+// delivery ID header.
+type Deliverer struct {
+	raftServer leader
+	fsm        *fsm.FSM
+	client     *http.Client
+	// checkURL vets a webhook's URL before each delivery.
+	checkURL func(ctx context.Context, rawURL string) error
+
+	// Interval between delivery passes.
+	Interval time.Duration
+	// Concurrency bounds the deliveries attempted at once.
+	Concurrency int
+	// BaseBackoff is the delay before the first retry; it doubles with each
+	// failed attempt up to MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Logger receives failures to record delivery attempts.
+	Logger *slog.Logger
+}
+
+// leader is the part of the Raft server the deliverer needs.
+type leader interface {
+	IsLeader() bool
+	ApplyCommand(cmd *fsm.Command, timeout time.Duration) (interface{}, error)
+}
+
+func NewDeliverer(raftServer *raft.Server, fsm *fsm.FSM, client *http.Client) *Deliverer {
+	if client == nil {
+		client = newClient(defaultTimeout)
+	}
+	return &Deliverer{
+		raftServer:  raftServer,
+		fsm:         fsm,
+		client:      client,
+		checkURL:    CheckURL,
+		Interval:    time.Second,
+		Concurrency: 8,
+		BaseBackoff: 5 * time.Second,
+		MaxBackoff:  time.Hour,
+		Logger:      slog.Default(),
+	}
+}
+
+func (d *Deliverer) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if d.raftServer.IsLeader() {
+				d.deliverDue()
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (d *Deliverer) deliverDue() {
+	due := d.fsm.Store().GetDueDeliveries(time.Now())
+
+	sem := make(chan struct{}, d.Concurrency)
+	var wg sync.WaitGroup
+	for _, delivery := range due {
+		webhook, found := d.fsm.Store().GetWebhook(delivery.TenantID, delivery.WebhookID)
+		if !found {
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(delivery *models.WebhookDelivery, webhook models.Webhook) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			d.attempt(delivery, &webhook)
+		}(delivery, *webhook)
+	}
+	wg.Wait()
+}
+
+func (d *Deliverer) attempt(delivery *models.WebhookDelivery, webhook *models.Webhook) {
+	result := fsm.DeliveryResult{TenantID: delivery.TenantID, ID: delivery.ID}
+
+	statusCode, err := d.post(delivery, webhook)
+	result.StatusCode = statusCode
+	if err != nil {
+		result.Error = err.Error()
+		result.NextAttemptAt = time.Now().UTC().Add(d.backoff(delivery.Attempts))
+	} else {
+		result.Success = true
+	}
+
+	resultData, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+
+	cmd := fsm.Command{
+		Op:         fsm.OpResult,
+		EntityType: fsm.EntityWebhookDelivery,
+		Payload:    resultData,
+	}
+
+	if _, err := d.raftServer.ApplyCommand(&cmd, 5*time.Second); err != nil {
+		d.Logger.Warn("failed to record webhook delivery", "tenant", delivery.TenantID, "delivery", delivery.ID, "err", err)
+	}
+}
+
+func (d *Deliverer) post(delivery *models.WebhookDelivery, webhook *models.Webhook) (int, error) {
+	timeout := d.client.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// The host may resolve differently than when the webhook was registered
+	if err := d.checkURL(ctx, webhook.URL); err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay before retrying a delivery that has failed
+// attempts times before the current failure.
+func (d *Deliverer) backoff(attempts int) time.Duration {
+	delay := d.BaseBackoff
+	for i := 0; i < attempts && delay < d.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxBackoff {
+		delay = d.MaxBackoff
+	}
+	return delay
+}
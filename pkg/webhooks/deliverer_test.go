@@ -0,0 +1,230 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	hraft "github.com/hashicorp/raft"
+	"github.com/raft3d/internal/fsm"
+	"github.com/raft3d/pkg/events"
+	"github.com/raft3d/pkg/models"
+)
+
+// fakeLeader applies commands straight to an FSM, as a single node cluster
+// would.
+type fakeLeader struct {
+	mu    sync.Mutex
+	fsm   *fsm.FSM
+	index uint64
+}
+
+func (l *fakeLeader) IsLeader() bool { return true }
+
+func (l *fakeLeader) ApplyCommand(cmd *fsm.Command, timeout time.Duration) (interface{}, error) {
+	if cmd.Timestamp.IsZero() {
+		cmd.Timestamp = time.Now().UTC()
+	}
+	cmd.Version = fsm.CommandVersion
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.index++
+	resp := l.fsm.Apply(&hraft.Log{Index: l.index, Data: data})
+	if err, ok := resp.(error); ok {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (l *fakeLeader) apply(t *testing.T, op, entityType string, payload interface{}) {
+	t.Helper()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.ApplyCommand(&fsm.Command{Op: op, EntityType: entityType, Payload: data}, time.Second); err != nil {
+		t.Fatalf("%s %s: %v", op, entityType, err)
+	}
+}
+
+// receiver is a webhook endpoint answering with the next of its statuses,
+// repeating the last one.
+type receiver struct {
+	t        *testing.T
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		rc.t.Error(err)
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+	status := rc.statuses[0]
+	if len(rc.statuses) > 1 {
+		rc.statuses = rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (rc *receiver) count() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return len(rc.requests)
+}
+
+// newDelivery subscribes a webhook to filament updates and creates a
+// filament, which queues one delivery to rc.
+func newDelivery(t *testing.T, rc *receiver) (*Deliverer, *fakeLeader) {
+	server := httptest.NewServer(rc)
+	t.Cleanup(server.Close)
+
+	f := fsm.NewFSM()
+	f.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	leader := &fakeLeader{fsm: f}
+	leader.apply(t, fsm.OpCreate, fsm.EntityWebhook, models.Webhook{
+		ID: "orders", URL: server.URL, Secret: "s3cret", EventTypes: []string{events.TypeFilamentUpdated},
+	})
+	leader.apply(t, fsm.OpCreate, fsm.EntityFilament, models.Filament{
+		ID: "f1", Type: "PLA", Color: "red", TotalWeightInGrams: 1000, RemainingWeightInGrams: 1000,
+	})
+
+	d := NewDeliverer(nil, f, server.Client())
+	d.raftServer = leader
+	// The receiver listens on the loopback address
+	d.checkURL = func(context.Context, string) error { return nil }
+	d.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	return d, leader
+}
+
+func delivery(t *testing.T, d *Deliverer) *models.WebhookDelivery {
+	t.Helper()
+	deliveries := d.fsm.Store().GetDeliveries(models.DefaultTenant, "orders")
+	if len(deliveries) != 1 {
+		t.Fatalf("webhook has %d deliveries, want 1", len(deliveries))
+	}
+	return deliveries[0]
+}
+
+func TestDeliveriesAreSigned(t *testing.T) {
+	rc := &receiver{t: t, statuses: []int{http.StatusOK}}
+	d, _ := newDelivery(t, rc)
+	queued := delivery(t, d)
+
+	d.deliverDue()
+	if rc.count() != 1 {
+		t.Fatalf("receiver got %d requests, want 1", rc.count())
+	}
+
+	req, body := rc.requests[0], rc.bodies[0]
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	if got, want := req.Header.Get(SignatureHeader), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+	if Sign("another secret", body) == req.Header.Get(SignatureHeader) {
+		t.Error("the signature does not depend on the secret")
+	}
+	if req.Header.Get(EventHeader) != events.TypeFilamentUpdated || req.Header.Get(DeliveryHeader) != queued.ID {
+		t.Errorf("event %q and delivery %q headers", req.Header.Get(EventHeader), req.Header.Get(DeliveryHeader))
+	}
+	if string(body) != string(queued.Payload) {
+		t.Errorf("body %s, want %s", body, queued.Payload)
+	}
+
+	if done := delivery(t, d); done.Status != models.DeliveryDelivered || done.Attempts != 1 {
+		t.Errorf("delivery is %s after %d attempts, want delivered after 1", done.Status, done.Attempts)
+	}
+}
+
+func TestFailedDeliveriesAreRetried(t *testing.T) {
+	rc := &receiver{t: t, statuses: []int{http.StatusServiceUnavailable, http.StatusOK}}
+	d, _ := newDelivery(t, rc)
+	d.BaseBackoff = 100 * time.Millisecond
+
+	before := time.Now()
+	d.deliverDue()
+	failed := delivery(t, d)
+	if failed.Status != models.DeliveryPending || failed.Attempts != 1 || failed.LastStatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("delivery after a failed attempt: %+v", failed)
+	}
+	if failed.NextAttemptAt.Before(before.Add(d.BaseBackoff)) {
+		t.Errorf("retry scheduled at %s, before the backoff of %s", failed.NextAttemptAt, d.BaseBackoff)
+	}
+
+	// Not due before the backoff has passed
+	d.deliverDue()
+	if rc.count() != 1 {
+		t.Fatalf("retried after %s, before the backoff", time.Since(before))
+	}
+
+	time.Sleep(time.Until(failed.NextAttemptAt))
+	d.deliverDue()
+	if done := delivery(t, d); done.Status != models.DeliveryDelivered || done.Attempts != 2 {
+		t.Errorf("delivery is %s after %d attempts, want delivered after 2", done.Status, done.Attempts)
+	}
+}
+
+func TestDeliveriesFailAfterMaxAttempts(t *testing.T) {
+	rc := &receiver{t: t, statuses: []int{http.StatusInternalServerError}}
+	d, _ := newDelivery(t, rc)
+	d.BaseBackoff, d.MaxBackoff = 0, 0
+
+	for i := 0; i < fsm.MaxDeliveryAttempts+2; i++ {
+		d.deliverDue()
+	}
+	if rc.count() != fsm.MaxDeliveryAttempts {
+		t.Errorf("receiver got %d attempts, want %d", rc.count(), fsm.MaxDeliveryAttempts)
+	}
+	if failed := delivery(t, d); failed.Status != models.DeliveryFailed {
+		t.Errorf("delivery is %s after %d attempts, want failed", failed.Status, failed.Attempts)
+	}
+}
+
+func TestBackoffDoublesUpToTheMaximum(t *testing.T) {
+	d := NewDeliverer(nil, nil, nil)
+	d.BaseBackoff, d.MaxBackoff = 5*time.Second, time.Minute
+
+	want := []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute}
+	for attempts, delay := range want {
+		if got := d.backoff(attempts); got != delay {
+			t.Errorf("backoff(%d) = %s, want %s", attempts, got, delay)
+		}
+	}
+}
+
+func TestDeliveriesToInternalAddressesFail(t *testing.T) {
+	rc := &receiver{t: t, statuses: []int{http.StatusOK}}
+	d, _ := newDelivery(t, rc)
+	d.checkURL = CheckURL
+
+	d.deliverDue()
+	if rc.count() != 0 {
+		t.Fatal("delivered a webhook to the loopback address")
+	}
+	if failed := delivery(t, d); failed.Attempts != 1 || !strings.Contains(failed.LastError, "internal address") {
+		t.Errorf("delivery to an internal address: %+v", failed)
+	}
+}